@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"store/config"
 	"store/internal/handlers"
+	"store/internal/models"
 	"store/internal/repository"
 	"store/internal/services"
 	"store/pkg/auth"
+	"store/pkg/notify"
+	"store/pkg/payment"
+	"store/pkg/storage"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerfiles "github.com/swaggo/files"
@@ -39,6 +46,15 @@ func main() {
 	productRepo := repository.NewProductRepository(db)
 	cartRepo := repository.NewCartRepository(db)
 	orderRepo := repository.NewOrderRepository(db)
+	currencyRepo := repository.NewCurrencyRepository(db)
+	categoryRepo := repository.NewCategoryRepository(db)
+	imageRepo := repository.NewImageRepository(db)
+	reviewRepo := repository.NewReviewRepository(db)
+	stockMovementRepo := repository.NewStockMovementRepository(db)
+	stockAlertRepo := repository.NewStockAlertRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	promotionRepo := repository.NewPromotionRepository(db)
+	taxRepo := repository.NewTaxRepository(db)
 
 	// Initialize JWT service
 	jwtService, err := auth.NewJWTService(cfg)
@@ -46,24 +62,120 @@ func main() {
 		log.Fatalf("Failed to initialize JWT service: %v", err)
 	}
 
+	// Initialize payment gateway
+	var paymentGateway services.PaymentGateway
+	switch cfg.PaymentGateway {
+	case "fake":
+		log.Println("Using fake payment gateway, no real payments will be taken")
+		paymentGateway = payment.NewFakeGateway()
+	case "stripe":
+		paymentGateway = payment.NewStripeGateway(cfg.StripeAPIKey, cfg.StripeAPIURL)
+	default:
+		log.Fatalf("Unknown payment gateway: %s", cfg.PaymentGateway)
+	}
+
+	// Initialize notifier
+	var notifier services.Notifier
+	switch cfg.Notifier {
+	case "log":
+		notifier = notify.NewLogNotifier()
+	case "outbox":
+		notifier = services.NewOutboxNotifier(notificationRepo)
+	default:
+		log.Fatalf("Unknown notifier: %s", cfg.Notifier)
+	}
+
+	// Initialize media storage
+	mediaStorage, err := storage.NewLocalStorage(cfg.MediaDir, cfg.MediaURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize media storage: %v", err)
+	}
+
+	// Stock reservations of unpaid orders
+	reservationTimeout, err := time.ParseDuration(cfg.ReservationTimeout)
+	if err != nil {
+		log.Fatalf("Invalid reservation timeout: %v", err)
+	}
+	reservationSweep, err := time.ParseDuration(cfg.ReservationSweep)
+	if err != nil {
+		log.Fatalf("Invalid reservation sweep interval: %v", err)
+	}
+	refundRetryInterval, err := time.ParseDuration(cfg.RefundRetryInterval)
+	if err != nil {
+		log.Fatalf("Invalid refund retry interval: %v", err)
+	}
+	stockCheckInterval, err := time.ParseDuration(cfg.StockCheckInterval)
+	if err != nil {
+		log.Fatalf("Invalid stock check interval: %v", err)
+	}
+	guestCartTTL, err := time.ParseDuration(cfg.GuestCartTTL)
+	if err != nil {
+		log.Fatalf("Invalid guest cart TTL: %v", err)
+	}
+
+	// Flat shipping cost of an order, in the base currency
+	shippingCost, err := models.ParseMoney(cfg.ShippingCost, cfg.BaseCurrency)
+	if err != nil || shippingCost.IsNegative() {
+		log.Fatalf("Invalid shipping cost: %s", cfg.ShippingCost)
+	}
+
+	// Whether product prices and the shipping cost include tax
+	pricesIncludeTax, err := strconv.ParseBool(cfg.PricesIncludeTax)
+	if err != nil {
+		log.Fatalf("Invalid prices include tax setting: %v", err)
+	}
+
 	// Initialize services
-	userService := services.NewUserService(userRepo, jwtService)
-	productService := services.NewProductService(productRepo)
-	cartService := services.NewCartService(cartRepo, productRepo)
-	orderService := services.NewOrderService(orderRepo, cartRepo, productRepo)
-	paymentService := services.NewPaymentService(cfg, orderRepo)
+	currencyService := services.NewCurrencyService(currencyRepo, cfg.BaseCurrency)
+	taxService := services.NewTaxService(taxRepo, pricesIncludeTax)
+	promotionService := services.NewPromotionService(promotionRepo, categoryRepo, currencyService, taxService, shippingCost)
+	cartService := services.NewCartService(db, cartRepo, productRepo, promotionService, guestCartTTL)
+	userService := services.NewUserService(userRepo, jwtService, cartService)
+	categoryService := services.NewCategoryService(categoryRepo)
+	productService := services.NewProductService(productRepo, categoryRepo, cfg.BaseCurrency)
+	imageService := services.NewImageService(imageRepo, productRepo, mediaStorage)
+	reviewService := services.NewReviewService(reviewRepo, productRepo)
+	stockService := services.NewStockService(db, stockMovementRepo)
+	stockAlertService := services.NewStockAlertService(stockAlertRepo, productRepo, notifier)
+	paymentService := services.NewPaymentService(cfg, orderRepo, paymentGateway)
+	orderService := services.NewOrderService(db, orderRepo, cartRepo, productRepo, paymentService, currencyService, promotionService, reservationTimeout)
+
+	// Release the stock of orders left unpaid
+	go orderService.RunReservationSweeper(context.Background(), reservationSweep)
+
+	// Retry refunds of cancelled orders the payment provider did not accept
+	go orderService.RunRefundRetrier(context.Background(), refundRetryInterval)
+
+	// Delete guest carts nobody came back to
+	go cartService.RunGuestCartCleanup(context.Background(), time.Hour)
+
+	// Raise low-stock alerts and tell subscribers about restocked products
+	go stockAlertService.RunStockWatcher(context.Background(), stockCheckInterval)
 
 	// Initialize handlers
 	userHandler := handlers.NewUserHandler(userService)
-	productHandler := handlers.NewProductHandler(productService)
-	cartHandler := handlers.NewCartHandler(cartService)
+	productHandler := handlers.NewProductHandler(productService, currencyService)
+	cartHandler := handlers.NewCartHandler(cartService, currencyService)
 	orderHandler := handlers.NewOrderHandler(orderService, paymentService)
+	paymentHandler := handlers.NewPaymentHandler(paymentService, orderService)
+	currencyHandler := handlers.NewCurrencyHandler(currencyService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService)
+	imageHandler := handlers.NewImageHandler(imageService, productService)
+	reviewHandler := handlers.NewReviewHandler(reviewService)
+	stockHandler := handlers.NewStockHandler(stockService)
+	stockAlertHandler := handlers.NewStockAlertHandler(stockAlertService)
+	promotionHandler := handlers.NewPromotionHandler(promotionService)
+	taxHandler := handlers.NewTaxHandler(taxService)
 
 	// Initialize Gin router
 	router := gin.Default()
 
+	// Uploaded media
+	router.Static("/media", mediaStorage.Dir())
+
 	// Middleware
 	authMiddleware := handlers.AuthMiddleware(jwtService)
+	optionalAuthMiddleware := handlers.OptionalAuthMiddleware(jwtService)
 	adminMiddleware := handlers.AdminMiddleware()
 
 	// API routes
@@ -85,23 +197,39 @@ func main() {
 		{
 			products.GET("", productHandler.GetProducts)
 			products.GET("/:id", productHandler.GetProduct)
+			products.GET("/:id/reviews", reviewHandler.GetProductReviews)
+			products.POST("/:id/reviews", authMiddleware, reviewHandler.CreateReview)
+			products.POST("/:id/stock-subscription", authMiddleware, stockAlertHandler.Subscribe)
+			products.DELETE("/:id/stock-subscription", authMiddleware, stockAlertHandler.Unsubscribe)
 
 			// Admin-only product management
 			products.Use(authMiddleware, adminMiddleware)
 			products.POST("", productHandler.CreateProduct)
 			products.PUT("/:id", productHandler.UpdateProduct)
 			products.DELETE("/:id", productHandler.DeleteProduct)
+			products.POST("/:id/variants", productHandler.CreateVariant)
+			products.PUT("/:id/variants/:variantId", productHandler.UpdateVariant)
+			products.DELETE("/:id/variants/:variantId", productHandler.DeleteVariant)
+			products.POST("/:id/images", imageHandler.UploadImage)
+			products.PUT("/:id/images/order", imageHandler.ReorderImages)
+			products.DELETE("/:id/images/:imageId", imageHandler.DeleteImage)
 		}
 
-		// Cart routes
+		// Category routes
+		api.GET("/categories", categoryHandler.GetCategories)
+
+		// Cart routes, for signed-in users and guests alike
 		cart := api.Group("/cart")
-		cart.Use(authMiddleware)
+		cart.Use(optionalAuthMiddleware)
 		{
 			cart.GET("", cartHandler.GetCart)
 			cart.POST("", cartHandler.AddToCart)
 			cart.PUT("/:id", cartHandler.UpdateCartItem)
 			cart.DELETE("/:id", cartHandler.RemoveFromCart)
 			cart.POST("/clear", cartHandler.ClearCart)
+			cart.POST("/accept", cartHandler.AcceptCartChanges)
+			cart.POST("/coupon", cartHandler.ApplyCoupon)
+			cart.DELETE("/coupon", cartHandler.RemoveCoupon)
 		}
 
 		// Order routes
@@ -111,6 +239,8 @@ func main() {
 			orders.POST("", orderHandler.CreateOrder)
 			orders.GET("", orderHandler.GetOrders)
 			orders.GET("/:id", orderHandler.GetOrder)
+			orders.GET("/:id/history", orderHandler.GetOrderHistory)
+			orders.POST("/:id/cancel", orderHandler.CancelOrder)
 
 			// Admin-only order management
 			adminOrders := orders.Group("/:id")
@@ -120,6 +250,38 @@ func main() {
 
 		// Payment routes
 		api.POST("/pay", authMiddleware, orderHandler.ProcessPayment)
+		api.POST("/payments/webhook", paymentHandler.Webhook)
+
+		// Currency routes
+		api.GET("/exchange-rates", currencyHandler.GetExchangeRates)
+
+		// Tax routes
+		api.GET("/tax-rates", taxHandler.GetTaxRates)
+
+		// Admin routes
+		admin := api.Group("/admin")
+		admin.Use(authMiddleware, adminMiddleware)
+		{
+			admin.PUT("/exchange-rates", currencyHandler.SetExchangeRates)
+			admin.PUT("/tax-rates", taxHandler.SetTaxRates)
+			admin.DELETE("/tax-rates/:id", taxHandler.DeleteTaxRate)
+			admin.POST("/products/import", productHandler.ImportProducts)
+			admin.GET("/products/export", productHandler.ExportProducts)
+			admin.POST("/products/:id/stock-adjustments", stockHandler.AdjustStock)
+			admin.GET("/products/:id/stock-movements", stockHandler.GetStockMovements)
+			admin.GET("/stock-alerts", stockAlertHandler.GetStockAlerts)
+			admin.GET("/reviews", reviewHandler.GetReviews)
+			admin.PUT("/reviews/:id/status", reviewHandler.ModerateReview)
+			admin.DELETE("/reviews/:id", reviewHandler.DeleteReview)
+			admin.POST("/categories", categoryHandler.CreateCategory)
+			admin.PUT("/categories/:id", categoryHandler.UpdateCategory)
+			admin.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+			admin.GET("/promotions", promotionHandler.GetPromotions)
+			admin.POST("/promotions", promotionHandler.CreatePromotion)
+			admin.GET("/promotions/:id", promotionHandler.GetPromotion)
+			admin.PUT("/promotions/:id", promotionHandler.UpdatePromotion)
+			admin.DELETE("/promotions/:id", promotionHandler.DeletePromotion)
+		}
 
 		// Swagger documentation
 		api.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
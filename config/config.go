@@ -8,15 +8,29 @@ import (
 )
 
 type Config struct {
-	ServerPort      string
-	DBHost          string
-	DBPort          string
-	DBUser          string
-	DBPassword      string
-	DBName          string
-	JWTSecret       string
-	TokenExpiration string
-	StripeAPIKey    string
+	ServerPort          string
+	DBHost              string
+	DBPort              string
+	DBUser              string
+	DBPassword          string
+	DBName              string
+	JWTSecret           string
+	TokenExpiration     string
+	StripeAPIKey        string
+	StripeAPIURL        string
+	StripeWebhookSecret string
+	PaymentGateway      string
+	BaseCurrency        string
+	MediaDir            string
+	MediaURL            string
+	ReservationTimeout  string
+	ReservationSweep    string
+	RefundRetryInterval string
+	Notifier            string
+	StockCheckInterval  string
+	GuestCartTTL        string
+	ShippingCost        string
+	PricesIncludeTax    string
 }
 
 func LoadConfig() *Config {
@@ -27,15 +41,29 @@ func LoadConfig() *Config {
 	}
 
 	config := &Config{
-		ServerPort:      getEnv("SERVER_PORT", "8080"),
-		DBHost:          getEnv("DB_HOST", "localhost"),
-		DBPort:          getEnv("DB_PORT", "5432"),
-		DBUser:          getEnv("DB_USER", "postgres"),
-		DBPassword:      getEnv("DB_PASSWORD", "postgres"),
-		DBName:          getEnv("DB_NAME", "store"),
-		JWTSecret:       getEnv("JWT_SECRET", "your-secret-key"),
-		TokenExpiration: getEnv("TOKEN_EXPIRATION", "24h"),
-		StripeAPIKey:    getEnv("STRIPE_API_KEY", ""),
+		ServerPort:          getEnv("SERVER_PORT", "8080"),
+		DBHost:              getEnv("DB_HOST", "localhost"),
+		DBPort:              getEnv("DB_PORT", "5432"),
+		DBUser:              getEnv("DB_USER", "postgres"),
+		DBPassword:          getEnv("DB_PASSWORD", "postgres"),
+		DBName:              getEnv("DB_NAME", "store"),
+		JWTSecret:           getEnv("JWT_SECRET", "your-secret-key"),
+		TokenExpiration:     getEnv("TOKEN_EXPIRATION", "24h"),
+		StripeAPIKey:        getEnv("STRIPE_API_KEY", ""),
+		StripeAPIURL:        getEnv("STRIPE_API_URL", "https://api.stripe.com"),
+		StripeWebhookSecret: getEnv("STRIPE_WEBHOOK_SECRET", ""),
+		PaymentGateway:      getEnv("PAYMENT_GATEWAY", "stripe"),
+		BaseCurrency:        getEnv("BASE_CURRENCY", "USD"),
+		MediaDir:            getEnv("MEDIA_DIR", "./uploads"),
+		MediaURL:            getEnv("MEDIA_URL", "/media"),
+		ReservationTimeout:  getEnv("RESERVATION_TIMEOUT", "30m"),
+		ReservationSweep:    getEnv("RESERVATION_SWEEP_INTERVAL", "1m"),
+		RefundRetryInterval: getEnv("REFUND_RETRY_INTERVAL", "5m"),
+		Notifier:            getEnv("NOTIFIER", "log"),
+		StockCheckInterval:  getEnv("STOCK_CHECK_INTERVAL", "1m"),
+		GuestCartTTL:        getEnv("GUEST_CART_TTL", "720h"),
+		ShippingCost:        getEnv("SHIPPING_COST", "0"),
+		PricesIncludeTax:    getEnv("PRICES_INCLUDE_TAX", "false"),
 	}
 
 	return config
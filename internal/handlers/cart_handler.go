@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"store/internal/models"
 	"store/internal/services"
 	"strconv"
 
@@ -10,70 +13,45 @@ import (
 
 // CartHandler handles cart-related requests
 type CartHandler struct {
-	cartService *services.CartService
+	cartService     *services.CartService
+	currencyService *services.CurrencyService
 }
 
 // NewCartHandler creates a new CartHandler
-func NewCartHandler(cartService *services.CartService) *CartHandler {
+func NewCartHandler(cartService *services.CartService, currencyService *services.CurrencyService) *CartHandler {
 	return &CartHandler{
-		cartService: cartService,
+		cartService:     cartService,
+		currencyService: currencyService,
 	}
 }
 
 // GetCart handles retrieving the user's cart
 // @Summary Get cart
-// @Description Get the current user's cart
+// @Description Get the current user's cart, or the guest cart with the cart_token cookie or X-Cart-Token header
 // @Tags cart
 // @Produce json
+// @Param currency query string false "Currency to show prices in (default: base currency)"
+// @Param region query string false "Tax region, e.g. DE or US-CA (default: the rates for everywhere)"
 // @Security Bearer
 // @Success 200 {object} CartResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /cart [get]
 func (h *CartHandler) GetCart(c *gin.Context) {
-	// Get user ID from context (set by AuthMiddleware)
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
-		return
-	}
+	owner := cartOwner(c)
 
 	// Get cart
-	cart, err := h.cartService.GetCart(userID.(uint))
+	cart, err := h.cartService.GetCart(owner)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Convert to response format
-	var cartItems []CartItemResponse
-	var total float64
-
-	for _, item := range cart.Items {
-		subtotal := item.Product.Price * float64(item.Quantity)
-		total += subtotal
-
-		cartItems = append(cartItems, CartItemResponse{
-			ID: item.ID,
-			Product: ProductResponse{
-				ID:          item.Product.ID,
-				Name:        item.Product.Name,
-				Description: item.Product.Description,
-				Price:       item.Product.Price,
-				Category:    item.Product.Category,
-				Brand:       item.Product.Brand,
-				ImageURL:    item.Product.ImageURL,
-				Stock:       item.Product.Stock,
-			},
-			Quantity: item.Quantity,
-			Subtotal: subtotal,
-		})
-	}
-
-	response := CartResponse{
-		ID:    cart.ID,
-		Items: cartItems,
-		Total: total,
+	response, err := h.cartResponse(cart, c.Query("currency"), c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -81,7 +59,7 @@ func (h *CartHandler) GetCart(c *gin.Context) {
 
 // AddToCart handles adding an item to the cart
 // @Summary Add to cart
-// @Description Add a product to the cart
+// @Description Add a product to the cart; products with variants are added by variant. A guest without a cart gets one, and its token in the cart_token cookie and X-Cart-Token header
 // @Tags cart
 // @Accept json
 // @Produce json
@@ -90,15 +68,11 @@ func (h *CartHandler) GetCart(c *gin.Context) {
 // @Success 200 {object} CartResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /cart [post]
 func (h *CartHandler) AddToCart(c *gin.Context) {
-	// Get user ID from context
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
-		return
-	}
+	owner := cartOwner(c)
 
 	// Parse request
 	var req CartItemRequest
@@ -108,48 +82,29 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	}
 
 	// Add to cart
-	err := h.cartService.AddToCart(userID.(uint), req.ProductID, req.Quantity)
+	cart, err := h.cartService.AddToCart(owner, req.ProductID, req.VariantID, req.Quantity)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		c.JSON(cartErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// Hand a guest the token of their cart
+	if cart.GuestToken != "" {
+		owner.GuestToken = cart.GuestToken
+		h.setGuestCartToken(c, cart.GuestToken)
+	}
+
 	// Return updated cart
-	cart, err := h.cartService.GetCart(userID.(uint))
+	cart, err = h.cartService.GetCart(owner)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Convert to response format (same as GetCart)
-	var cartItems []CartItemResponse
-	var total float64
-
-	for _, item := range cart.Items {
-		subtotal := item.Product.Price * float64(item.Quantity)
-		total += subtotal
-
-		cartItems = append(cartItems, CartItemResponse{
-			ID: item.ID,
-			Product: ProductResponse{
-				ID:          item.Product.ID,
-				Name:        item.Product.Name,
-				Description: item.Product.Description,
-				Price:       item.Product.Price,
-				Category:    item.Product.Category,
-				Brand:       item.Product.Brand,
-				ImageURL:    item.Product.ImageURL,
-				Stock:       item.Product.Stock,
-			},
-			Quantity: item.Quantity,
-			Subtotal: subtotal,
-		})
-	}
-
-	response := CartResponse{
-		ID:    cart.ID,
-		Items: cartItems,
-		Total: total,
+	response, err := h.cartResponse(cart, c.Query("currency"), c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -157,7 +112,7 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 
 // UpdateCartItem handles updating a cart item's quantity
 // @Summary Update cart item
-// @Description Update the quantity of a cart item
+// @Description Update the quantity of an item in your cart, if that much is in stock
 // @Tags cart
 // @Accept json
 // @Produce json
@@ -167,15 +122,11 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 // @Success 200 {object} CartResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /cart/{id} [put]
 func (h *CartHandler) UpdateCartItem(c *gin.Context) {
-	// Get user ID from context
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
-		return
-	}
+	owner := cartOwner(c)
 
 	// Get item ID from path
 	idStr := c.Param("id")
@@ -193,48 +144,23 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 	}
 
 	// Update cart item
-	err = h.cartService.UpdateCartItem(uint(id), req.Quantity)
+	err = h.cartService.UpdateCartItem(owner, uint(id), req.Quantity)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		c.JSON(cartErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	// Return updated cart
-	cart, err := h.cartService.GetCart(userID.(uint))
+	cart, err := h.cartService.GetCart(owner)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Convert to response format (same as GetCart)
-	var cartItems []CartItemResponse
-	var total float64
-
-	for _, item := range cart.Items {
-		subtotal := item.Product.Price * float64(item.Quantity)
-		total += subtotal
-
-		cartItems = append(cartItems, CartItemResponse{
-			ID: item.ID,
-			Product: ProductResponse{
-				ID:          item.Product.ID,
-				Name:        item.Product.Name,
-				Description: item.Product.Description,
-				Price:       item.Product.Price,
-				Category:    item.Product.Category,
-				Brand:       item.Product.Brand,
-				ImageURL:    item.Product.ImageURL,
-				Stock:       item.Product.Stock,
-			},
-			Quantity: item.Quantity,
-			Subtotal: subtotal,
-		})
-	}
-
-	response := CartResponse{
-		ID:    cart.ID,
-		Items: cartItems,
-		Total: total,
+	response, err := h.cartResponse(cart, c.Query("currency"), c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -242,22 +168,18 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 
 // RemoveFromCart handles removing an item from the cart
 // @Summary Remove from cart
-// @Description Remove an item from the cart
+// @Description Remove an item from your cart
 // @Tags cart
 // @Param id path int true "Cart Item ID"
 // @Security Bearer
 // @Success 200 {object} CartResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /cart/{id} [delete]
 func (h *CartHandler) RemoveFromCart(c *gin.Context) {
-	// Get user ID from context
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
-		return
-	}
+	owner := cartOwner(c)
 
 	// Get item ID from path
 	idStr := c.Param("id")
@@ -268,48 +190,23 @@ func (h *CartHandler) RemoveFromCart(c *gin.Context) {
 	}
 
 	// Remove from cart
-	err = h.cartService.RemoveFromCart(uint(id))
+	err = h.cartService.RemoveFromCart(owner, uint(id))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		c.JSON(cartErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	// Return updated cart
-	cart, err := h.cartService.GetCart(userID.(uint))
+	cart, err := h.cartService.GetCart(owner)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Convert to response format (same as GetCart)
-	var cartItems []CartItemResponse
-	var total float64
-
-	for _, item := range cart.Items {
-		subtotal := item.Product.Price * float64(item.Quantity)
-		total += subtotal
-
-		cartItems = append(cartItems, CartItemResponse{
-			ID: item.ID,
-			Product: ProductResponse{
-				ID:          item.Product.ID,
-				Name:        item.Product.Name,
-				Description: item.Product.Description,
-				Price:       item.Product.Price,
-				Category:    item.Product.Category,
-				Brand:       item.Product.Brand,
-				ImageURL:    item.Product.ImageURL,
-				Stock:       item.Product.Stock,
-			},
-			Quantity: item.Quantity,
-			Subtotal: subtotal,
-		})
-	}
-
-	response := CartResponse{
-		ID:    cart.ID,
-		Items: cartItems,
-		Total: total,
+	response, err := h.cartResponse(cart, c.Query("currency"), c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -325,22 +222,17 @@ func (h *CartHandler) RemoveFromCart(c *gin.Context) {
 // @Failure 500 {object} ErrorResponse
 // @Router /cart/clear [post]
 func (h *CartHandler) ClearCart(c *gin.Context) {
-	// Get user ID from context
-	userID, exists := c.Get("userID")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
-		return
-	}
+	owner := cartOwner(c)
 
 	// Clear cart
-	err := h.cartService.ClearCart(userID.(uint))
+	err := h.cartService.ClearCart(owner)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	// Get empty cart
-	cart, err := h.cartService.GetCart(userID.(uint))
+	cart, err := h.cartService.GetCart(owner)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
@@ -348,10 +240,296 @@ func (h *CartHandler) ClearCart(c *gin.Context) {
 
 	// Return empty cart
 	response := CartResponse{
-		ID:    cart.ID,
-		Items: []CartItemResponse{},
-		Total: 0,
+		ID:        cart.ID,
+		Items:     []CartItemResponse{},
+		Discounts: []DiscountResponse{},
 	}
 
 	c.JSON(http.StatusOK, response)
 }
+
+// AcceptCartChanges handles accepting the changes the cart warns about
+// @Summary Accept cart changes
+// @Description Accept the changes to the items of the cart since they were added: items take on their current price, quantities are lowered to what is in stock, and items that are no longer available are removed
+// @Tags cart
+// @Produce json
+// @Param currency query string false "Currency to show prices in (default: base currency)"
+// @Param region query string false "Tax region, e.g. DE or US-CA (default: the rates for everywhere)"
+// @Security Bearer
+// @Success 200 {object} CartResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/accept [post]
+func (h *CartHandler) AcceptCartChanges(c *gin.Context) {
+	owner := cartOwner(c)
+
+	// Accept changes
+	if err := h.cartService.AcceptCartChanges(owner); err != nil {
+		c.JSON(cartErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Return updated cart
+	cart, err := h.cartService.GetCart(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := h.cartResponse(cart, c.Query("currency"), c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ApplyCoupon handles entering a coupon code for the cart
+// @Summary Apply coupon
+// @Description Enter a coupon code for the cart, replacing any entered before. The code must apply to the cart as it is; it is checked again at checkout.
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param coupon body CouponRequest true "Coupon code"
+// @Param currency query string false "Currency to show prices in (default: base currency)"
+// @Param region query string false "Tax region, e.g. DE or US-CA (default: the rates for everywhere)"
+// @Security Bearer
+// @Success 200 {object} CartResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/coupon [post]
+func (h *CartHandler) ApplyCoupon(c *gin.Context) {
+	owner := cartOwner(c)
+
+	// Parse request
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Apply coupon
+	if err := h.cartService.ApplyCoupon(owner, req.Code); err != nil {
+		c.JSON(cartErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Return updated cart
+	cart, err := h.cartService.GetCart(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := h.cartResponse(cart, c.Query("currency"), c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// RemoveCoupon handles removing the coupon code from the cart
+// @Summary Remove coupon
+// @Description Remove the coupon code from the cart
+// @Tags cart
+// @Produce json
+// @Param currency query string false "Currency to show prices in (default: base currency)"
+// @Param region query string false "Tax region, e.g. DE or US-CA (default: the rates for everywhere)"
+// @Security Bearer
+// @Success 200 {object} CartResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/coupon [delete]
+func (h *CartHandler) RemoveCoupon(c *gin.Context) {
+	owner := cartOwner(c)
+
+	// Remove coupon
+	if err := h.cartService.RemoveCoupon(owner); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Return updated cart
+	cart, err := h.cartService.GetCart(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := h.cartResponse(cart, c.Query("currency"), c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// guestCartCookie and guestCartHeader carry the token of a guest's cart.
+// Browsers keep the cookie; other clients send the header back.
+const (
+	guestCartCookie = "cart_token"
+	guestCartHeader = "X-Cart-Token"
+)
+
+// cartOwner returns whose cart a request is about: the signed-in user's, or
+// the guest's whose cart token it carries
+func cartOwner(c *gin.Context) services.CartOwner {
+	if userID, exists := c.Get("userID"); exists {
+		return services.CartOwner{UserID: userID.(uint)}
+	}
+	return services.CartOwner{GuestToken: guestCartToken(c)}
+}
+
+// guestCartToken returns the guest cart token a request carries, if any
+func guestCartToken(c *gin.Context) string {
+	if token := c.GetHeader(guestCartHeader); token != "" {
+		return token
+	}
+	token, _ := c.Cookie(guestCartCookie)
+	return token
+}
+
+// setGuestCartToken hands a guest the token of their cart, both as a cookie
+// and in a header
+func (h *CartHandler) setGuestCartToken(c *gin.Context, token string) {
+	c.Header(guestCartHeader, token)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(guestCartCookie, token, int(h.cartService.GuestCartTTL().Seconds()), "/api", "", c.Request.TLS != nil, true)
+}
+
+// clearGuestCartToken tells the client to forget its guest cart token
+func clearGuestCartToken(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(guestCartCookie, "", -1, "/api", "", c.Request.TLS != nil, true)
+}
+
+// cartErrorStatus maps a cart service error to an HTTP status code
+func cartErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCartItemNotFound), errors.Is(err, services.ErrProductNotFound),
+		errors.Is(err, services.ErrVariantNotFound), errors.Is(err, services.ErrPromotionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInsufficientStock), errors.Is(err, services.ErrVariantRequired),
+		errors.Is(err, services.ErrCouponNotApplicable):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// cartResponse converts a cart model to its response format, with prices
+// in the given currency (the base currency if empty), its discounts,
+// shipping and the tax of region, and warnings about items that changed
+// since they were added
+func (h *CartHandler) cartResponse(cart *models.Cart, currency, region string) (CartResponse, error) {
+	currency, err := h.currencyService.Resolve(currency)
+	if err != nil {
+		return CartResponse{}, err
+	}
+
+	var cartItems []CartItemResponse
+	warnings := h.cartService.CheckCart(cart)
+
+	for _, item := range cart.Items {
+		product, err := newLocalizedProductResponse(h.currencyService, &item.Product, currency)
+		if err != nil {
+			return CartResponse{}, err
+		}
+		price := product.Price
+
+		var variant *VariantResponse
+		if item.Variant != nil {
+			response, err := newLocalizedVariantResponse(h.currencyService, &item.Product, item.Variant, currency)
+			if err != nil {
+				return CartResponse{}, err
+			}
+			variant = &response
+			price = response.Price
+		}
+
+		subtotal := price.Mul(item.Quantity)
+
+		itemWarnings, err := h.cartWarningResponses(warnings[item.ID], price, currency)
+		if err != nil {
+			return CartResponse{}, err
+		}
+
+		cartItems = append(cartItems, CartItemResponse{
+			ID:       item.ID,
+			Product:  product,
+			Variant:  variant,
+			Quantity: item.Quantity,
+			Subtotal: subtotal,
+			Warnings: itemWarnings,
+		})
+	}
+
+	pricing, err := h.cartService.PriceCart(cart, currency, region)
+	if err != nil {
+		return CartResponse{}, err
+	}
+	discounts := make([]DiscountResponse, 0, len(pricing.Discounts))
+	for _, discount := range pricing.Discounts {
+		discounts = append(discounts, newDiscountResponse(&discount))
+	}
+
+	response := CartResponse{
+		ID:               cart.ID,
+		Items:            cartItems,
+		Subtotal:         pricing.Subtotal,
+		Discounts:        discounts,
+		Discount:         pricing.Discount,
+		Shipping:         pricing.Shipping,
+		Tax:              pricing.Tax,
+		PricesIncludeTax: pricing.PricesIncludeTax,
+		Total:            pricing.Total,
+		CouponCode:       cart.CouponCode,
+		HasWarnings:      len(warnings) > 0,
+	}
+	if pricing.CouponErr != nil {
+		response.CouponError = pricing.CouponErr.Error()
+	}
+	return response, nil
+}
+
+// cartWarningResponses converts the warnings of a cart item to their
+// response format. price is the item's current price in currency.
+func (h *CartHandler) cartWarningResponses(warnings []services.CartWarning, price models.Money, currency string) ([]CartWarningResponse, error) {
+	var responses []CartWarningResponse
+	for _, warning := range warnings {
+		response := CartWarningResponse{Code: warning.Code}
+
+		switch warning.Code {
+		case services.CartWarningPriceIncreased, services.CartWarningPriceDecreased:
+			oldPrice, err := h.currencyService.Convert(warning.OldPrice, currency)
+			if err != nil {
+				return nil, err
+			}
+			newPrice := price
+			response.OldPrice = &oldPrice
+			response.NewPrice = &newPrice
+			direction := "up"
+			if warning.Code == services.CartWarningPriceDecreased {
+				direction = "down"
+			}
+			response.Message = fmt.Sprintf("price went %s from %s to %s", direction, oldPrice, newPrice)
+		case services.CartWarningInsufficientStock:
+			available := warning.Available
+			response.Available = &available
+			response.Message = fmt.Sprintf("only %d left in stock", available)
+		case services.CartWarningUnavailable:
+			response.Message = "no longer available"
+		}
+
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CategoryHandler handles category-related requests
+type CategoryHandler struct {
+	categoryService *services.CategoryService
+}
+
+// NewCategoryHandler creates a new CategoryHandler
+func NewCategoryHandler(categoryService *services.CategoryService) *CategoryHandler {
+	return &CategoryHandler{
+		categoryService: categoryService,
+	}
+}
+
+// GetCategories handles retrieving the category tree
+// @Summary Get categories
+// @Description Get all categories as a tree, each with its subcategories
+// @Tags categories
+// @Produce json
+// @Success 200 {array} CategoryResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /categories [get]
+func (h *CategoryHandler) GetCategories(c *gin.Context) {
+	categories, err := h.categoryService.GetCategoryTree()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	responses := make([]CategoryResponse, 0, len(categories))
+	for i := range categories {
+		responses = append(responses, newCategoryResponse(&categories[i]))
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+// CreateCategory handles creating a new category
+// @Summary Create a category
+// @Description Create a new category, optionally under a parent category (admin only)
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param category body CategoryRequest true "Category details"
+// @Security Bearer
+// @Success 201 {object} CategoryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/categories [post]
+func (h *CategoryHandler) CreateCategory(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	category := models.Category{
+		Name:      req.Name,
+		Slug:      req.Slug,
+		ParentID:  req.ParentID,
+		SortOrder: req.SortOrder,
+	}
+
+	if err := h.categoryService.CreateCategory(&category); err != nil {
+		c.JSON(categoryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newCategoryResponse(&category))
+}
+
+// UpdateCategory handles updating an existing category
+// @Summary Update a category
+// @Description Rename, re-slug, reorder or move a category (admin only)
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param category body CategoryRequest true "Category details"
+// @Security Bearer
+// @Success 200 {object} CategoryResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/categories/{id} [put]
+func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid category id"})
+		return
+	}
+
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	category, err := h.categoryService.GetCategoryByID(uint(id))
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	category.Name = req.Name
+	category.Slug = req.Slug
+	category.ParentID = req.ParentID
+	category.SortOrder = req.SortOrder
+
+	if err := h.categoryService.UpdateCategory(category); err != nil {
+		c.JSON(categoryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newCategoryResponse(category))
+}
+
+// DeleteCategory handles deleting a category
+// @Summary Delete a category
+// @Description Delete a category without subcategories or products (admin only)
+// @Tags categories
+// @Param id path int true "Category ID"
+// @Security Bearer
+// @Success 204 {object} nil
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /admin/categories/{id} [delete]
+func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid category id"})
+		return
+	}
+
+	if err := h.categoryService.DeleteCategory(uint(id)); err != nil {
+		c.JSON(categoryErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// categoryErrorStatus maps a category service error to an HTTP status code
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidCategory):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCategoryInUse):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newCategoryResponse converts a category model and its subcategories to
+// the response format
+func newCategoryResponse(category *models.Category) CategoryResponse {
+	response := CategoryResponse{
+		ID:        category.ID,
+		Name:      category.Name,
+		Slug:      category.Slug,
+		ParentID:  category.ParentID,
+		SortOrder: category.SortOrder,
+	}
+	for i := range category.Children {
+		response.Children = append(response.Children, newCategoryResponse(&category.Children[i]))
+	}
+	return response
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CurrencyHandler handles exchange rate requests
+type CurrencyHandler struct {
+	currencyService *services.CurrencyService
+}
+
+// NewCurrencyHandler creates a new CurrencyHandler
+func NewCurrencyHandler(currencyService *services.CurrencyService) *CurrencyHandler {
+	return &CurrencyHandler{
+		currencyService: currencyService,
+	}
+}
+
+// GetExchangeRates handles retrieving the exchange rates
+// @Summary Get exchange rates
+// @Description Get the exchange rates from the base currency to every supported currency
+// @Tags currencies
+// @Produce json
+// @Success 200 {object} ExchangeRatesResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /exchange-rates [get]
+func (h *CurrencyHandler) GetExchangeRates(c *gin.Context) {
+	rates, err := h.currencyService.GetRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newExchangeRatesResponse(rates))
+}
+
+// SetExchangeRates handles loading exchange rates
+// @Summary Set exchange rates
+// @Description Create or update exchange rates from the base currency (admin only)
+// @Tags currencies
+// @Accept json
+// @Produce json
+// @Param rates body ExchangeRatesRequest true "Rates keyed by currency code"
+// @Security Bearer
+// @Success 200 {object} ExchangeRatesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/exchange-rates [put]
+func (h *CurrencyHandler) SetExchangeRates(c *gin.Context) {
+	var req ExchangeRatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.currencyService.SetRates(req.Rates); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	rates, err := h.currencyService.GetRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newExchangeRatesResponse(rates))
+}
+
+// newExchangeRatesResponse converts exchange rates to their response format
+func (h *CurrencyHandler) newExchangeRatesResponse(rates []models.ExchangeRate) ExchangeRatesResponse {
+	response := ExchangeRatesResponse{
+		BaseCurrency: h.currencyService.BaseCurrency(),
+		Rates:        make(map[string]string, len(rates)),
+	}
+	for _, rate := range rates {
+		response.Rates[rate.Currency] = rate.Rate
+	}
+	return response
+}
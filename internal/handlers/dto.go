@@ -1,6 +1,14 @@
 package handlers
 
+import (
+	"store/internal/models"
+	"time"
+)
+
 // Request DTOs
+//
+// Money amounts in requests are integers in the currency's minor units
+// (e.g. cents); see models.Money for the rounding rules.
 
 // RegisterRequest represents a user registration request
 type RegisterRequest struct {
@@ -18,25 +26,121 @@ type LoginRequest struct {
 
 // ProductRequest represents a product creation/update request
 type ProductRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price" binding:"required,gt=0"`
-	Category    string  `json:"category" binding:"required"`
-	Brand       string  `json:"brand"`
-	ImageURL    string  `json:"image_url"`
-	Stock       int     `json:"stock" binding:"gte=0"`
+	Name        string `json:"name" binding:"required"`
+	SKU         string `json:"sku"`
+	Description string `json:"description"`
+	Price       int64  `json:"price" binding:"required,gt=0"` // in minor units of the store currency
+	CategoryID  uint   `json:"category_id" binding:"required"`
+	Brand       string `json:"brand"`
+	TaxClass    string `json:"tax_class" binding:"max=50"` // defaults to "standard"
+	ImageURL    string `json:"image_url"`
+	Stock       int    `json:"stock" binding:"gte=0"`
+	// ReorderThreshold raises a low-stock alert when the available stock
+	// falls to it; 0 turns alerts off
+	ReorderThreshold int `json:"reorder_threshold" binding:"gte=0"`
+	// Prices holds fixed prices in other currencies, keyed by currency code.
+	// Currencies without one are converted from Price at the current rate.
+	Prices map[string]int64 `json:"prices" binding:"omitempty,dive,keys,len=3,alpha,endkeys,gt=0"`
+}
+
+// CategoryRequest represents a category creation/update request. The slug
+// is made from the name if empty.
+type CategoryRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Slug      string `json:"slug"`
+	ParentID  *uint  `json:"parent_id"`
+	SortOrder int    `json:"sort_order"`
 }
 
 // CartItemRequest represents a request to add/update a cart item
 type CartItemRequest struct {
-	ProductID uint `json:"product_id" binding:"required"`
-	Quantity  int  `json:"quantity" binding:"required,gt=0"`
+	ProductID uint  `json:"product_id" binding:"required"`
+	VariantID *uint `json:"variant_id"` // required for products with variants
+	Quantity  int   `json:"quantity" binding:"required,gt=0"`
+}
+
+// VariantRequest represents a product variant creation/update request
+type VariantRequest struct {
+	SKU     string            `json:"sku"`
+	Options map[string]string `json:"options" binding:"required,min=1"` // e.g. {"size": "M", "colour": "red"}
+	Price   *int64            `json:"price" binding:"omitempty,gt=0"`   // in minor units of the base currency; empty for the product's price
+	Stock   int               `json:"stock" binding:"gte=0"`
+}
+
+// CouponRequest represents a request to enter a coupon code for the cart
+type CouponRequest struct {
+	Code string `json:"code" binding:"required,max=50"`
+}
+
+// PromotionRequest represents a promotion creation/update request. A
+// promotion with a code is a coupon; one without applies by itself to
+// every cart that meets its rules. Amounts are in minor units of the base
+// currency.
+type PromotionRequest struct {
+	Name         string     `json:"name" binding:"required"`
+	Code         string     `json:"code" binding:"max=50"`
+	Type         string     `json:"type" binding:"required,oneof=percentage fixed free_shipping buy_x_get_y"`
+	Percent      int        `json:"percent" binding:"min=0,max=100"` // for percentage
+	Amount       int64      `json:"amount" binding:"gte=0"`          // for fixed
+	BuyQuantity  int        `json:"buy_quantity" binding:"gte=0"`    // for buy_x_get_y
+	GetQuantity  int        `json:"get_quantity" binding:"gte=0"`    // for buy_x_get_y
+	MinSubtotal  int64      `json:"min_subtotal" binding:"gte=0"`
+	CategoryID   *uint      `json:"category_id"` // includes its subcategories
+	Brand        string     `json:"brand"`
+	PerUserLimit int        `json:"per_user_limit" binding:"gte=0"` // 0 for no limit
+	UsageLimit   int        `json:"usage_limit" binding:"gte=0"`    // 0 for no limit
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	Active       *bool      `json:"active"` // defaults to true
+}
+
+// ReviewRequest represents a product review request
+type ReviewRequest struct {
+	Rating int    `json:"rating" binding:"required,min=1,max=5"`
+	Title  string `json:"title" binding:"max=200"`
+	Body   string `json:"body" binding:"max=5000"`
+}
+
+// ReviewStatusRequest represents a review moderation request
+type ReviewStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=pending approved rejected"`
+}
+
+// StockAdjustmentRequest represents a manual stock adjustment. Give either
+// quantity, the change, or count, the stock counted on hand.
+type StockAdjustmentRequest struct {
+	VariantID *uint  `json:"variant_id"` // required for products with variants
+	Quantity  int    `json:"quantity"`   // negative to take stock out
+	Count     *int   `json:"count" binding:"omitempty,min=0"`
+	Reason    string `json:"reason" binding:"required,oneof=restock adjustment return"`
+	Reference string `json:"reference" binding:"max=100"` // e.g. a delivery note number
+	Note      string `json:"note" binding:"max=1000"`
+}
+
+// StockSubscriptionRequest represents a back-in-stock subscription request
+type StockSubscriptionRequest struct {
+	VariantID *uint `json:"variant_id"` // required for products with variants
+}
+
+// ImageOrderRequest represents a new order for a product's gallery
+type ImageOrderRequest struct {
+	ImageIDs []uint `json:"image_ids" binding:"required"` // every image of the product, first one first
 }
 
 // OrderRequest represents an order creation request
 type OrderRequest struct {
 	Address      string `json:"address" binding:"required"`
 	ShippingType string `json:"shipping_type" binding:"required"`
+	Currency     string `json:"currency"` // defaults to the base currency
+	// Region is the region of the shipping address, e.g. "DE" or "US-CA",
+	// which picks the tax rates
+	Region string `json:"region" binding:"required"`
+}
+
+// OrderStatusRequest represents an order status update request
+type OrderStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+	Reason string `json:"reason"`
 }
 
 // PaymentRequest represents a payment request
@@ -44,6 +148,27 @@ type PaymentRequest struct {
 	OrderID uint `json:"order_id" binding:"required"`
 }
 
+// ExchangeRatesRequest represents a request to load exchange rates. Rates
+// are decimal strings: units of the currency per unit of the base currency.
+type ExchangeRatesRequest struct {
+	Rates map[string]string `json:"rates" binding:"required,min=1"`
+}
+
+// TaxRatesRequest represents a request to create or update tax rates
+type TaxRatesRequest struct {
+	Rates []TaxRateRequest `json:"rates" binding:"required,min=1,dive"`
+}
+
+// TaxRateRequest represents one tax rate: a percentage as a decimal string,
+// e.g. "19" or "8.875", for a tax class in a region. An empty region is
+// everywhere no other rate applies.
+type TaxRateRequest struct {
+	Region   string `json:"region"`
+	TaxClass string `json:"tax_class"` // defaults to "standard"
+	Rate     string `json:"rate" binding:"required"`
+	Name     string `json:"name"`
+}
+
 // Response DTOs
 
 // TokenResponse represents a JWT token response
@@ -58,58 +183,329 @@ type ErrorResponse struct {
 
 // ProductsResponse represents a paginated list of products
 type ProductsResponse struct {
-	Products []ProductResponse `json:"products"`
-	Total    int64             `json:"total"`
-	Page     int               `json:"page"`
-	Limit    int               `json:"limit"`
+	Products   []ProductResponse `json:"products"`
+	Total      int64             `json:"total"`
+	Page       int               `json:"page"`
+	Limit      int               `json:"limit"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+	// Facets is set when requested with facets=true
+	Facets *ProductFacetsResponse `json:"facets,omitempty"`
+}
+
+// ProductFacetsResponse summarises the products matching a query. Each
+// facet is counted with every other filter of the query applied.
+type ProductFacetsResponse struct {
+	Categories   []FacetCountResponse  `json:"categories"`
+	Brands       []FacetCountResponse  `json:"brands"`
+	Prices       []PriceBucketResponse `json:"prices"`
+	Availability AvailabilityResponse  `json:"availability"`
+}
+
+// FacetCountResponse represents the number of products with a facet value
+type FacetCountResponse struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// PriceBucketResponse represents the number of products priced from Min up
+// to, but not including, Max
+type PriceBucketResponse struct {
+	Min   models.Money `json:"min"`
+	Max   models.Money `json:"max"`
+	Count int64        `json:"count"`
+}
+
+// AvailabilityResponse represents the number of products in and out of stock
+type AvailabilityResponse struct {
+	InStock    int64 `json:"in_stock"`
+	OutOfStock int64 `json:"out_of_stock"`
 }
 
 // ProductResponse represents a product response
 type ProductResponse struct {
-	ID          uint    `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Category    string  `json:"category"`
-	Brand       string  `json:"brand"`
-	ImageURL    string  `json:"image_url"`
-	Stock       int     `json:"stock"`
+	ID          uint         `json:"id"`
+	Name        string       `json:"name"`
+	SKU         string       `json:"sku"`
+	Description string       `json:"description"`
+	Price       models.Money `json:"price"`
+	// Prices holds fixed prices in other currencies, keyed by currency code
+	Prices     map[string]int64 `json:"prices,omitempty"`
+	CategoryID uint             `json:"category_id"`
+	Category   string           `json:"category"`
+	Brand      string           `json:"brand"`
+	TaxClass   string           `json:"tax_class"`
+	ImageURL   string           `json:"image_url"`
+	Images     []ImageResponse  `json:"images,omitempty"`
+	Stock      int              `json:"stock"`
+	// Reserved is the stock held for unpaid orders; Available is what is
+	// left to sell
+	Reserved         int `json:"reserved"`
+	Available        int `json:"available"`
+	ReorderThreshold int `json:"reorder_threshold"`
+	// Rating is the average of the approved reviews, 0 without any
+	Rating      float64           `json:"rating"`
+	ReviewCount int               `json:"review_count"`
+	Variants    []VariantResponse `json:"variants,omitempty"`
+	// Highlight is set in search results
+	Highlight *ProductHighlightResponse `json:"highlight,omitempty"`
+}
+
+// VariantResponse represents a product variant response
+type VariantResponse struct {
+	ID        uint              `json:"id"`
+	SKU       string            `json:"sku"`
+	Options   map[string]string `json:"options"`
+	Price     models.Money      `json:"price"`
+	Stock     int               `json:"stock"`
+	Reserved  int               `json:"reserved"`
+	Available int               `json:"available"`
+}
+
+// ReviewResponse represents a product review response
+type ReviewResponse struct {
+	ID        uint   `json:"id"`
+	ProductID uint   `json:"product_id"`
+	UserID    uint   `json:"user_id"`
+	Author    string `json:"author"`
+	Rating    int    `json:"rating"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
 }
 
-// CartResponse represents a shopping cart response
+// ReviewsResponse represents a paginated list of reviews
+type ReviewsResponse struct {
+	Reviews []ReviewResponse `json:"reviews"`
+	Total   int64            `json:"total"`
+	Page    int              `json:"page"`
+	Limit   int              `json:"limit"`
+}
+
+// StockMovementResponse represents an entry of the stock ledger
+type StockMovementResponse struct {
+	ID         uint   `json:"id"`
+	ProductID  uint   `json:"product_id"`
+	VariantID  *uint  `json:"variant_id,omitempty"`
+	Quantity   int    `json:"quantity"`
+	StockAfter int    `json:"stock_after"`
+	Reason     string `json:"reason"`
+	Reference  string `json:"reference"`
+	Note       string `json:"note"`
+	ActorID    *uint  `json:"actor_id"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// StockMovementsResponse represents a paginated list of stock movements
+type StockMovementsResponse struct {
+	Movements []StockMovementResponse `json:"movements"`
+	Total     int64                   `json:"total"`
+	Page      int                     `json:"page"`
+	Limit     int                     `json:"limit"`
+}
+
+// StockAlertResponse represents a low-stock alert
+type StockAlertResponse struct {
+	ID         uint    `json:"id"`
+	ProductID  uint    `json:"product_id"`
+	Product    string  `json:"product"`
+	SKU        string  `json:"sku"`
+	Available  int     `json:"available"`
+	Threshold  int     `json:"threshold"`
+	CreatedAt  string  `json:"created_at"`
+	ResolvedAt *string `json:"resolved_at"`
+}
+
+// StockAlertsResponse represents a paginated list of stock alerts
+type StockAlertsResponse struct {
+	Alerts []StockAlertResponse `json:"alerts"`
+	Total  int64                `json:"total"`
+	Page   int                  `json:"page"`
+	Limit  int                  `json:"limit"`
+}
+
+// ProductImportResponse represents the outcome of a product import
+type ProductImportResponse struct {
+	DryRun  bool                       `json:"dry_run"`
+	Created int                        `json:"created"`
+	Updated int                        `json:"updated"`
+	Failed  int                        `json:"failed"`
+	Rows    []ProductImportRowResponse `json:"rows"`
+}
+
+// ProductImportRowResponse represents the outcome of one row of a product
+// import. Row is the line in a CSV file, or the position in a JSON array.
+type ProductImportRowResponse struct {
+	Row    int    `json:"row"`
+	SKU    string `json:"sku"`
+	Action string `json:"action,omitempty"` // create or update
+	Error  string `json:"error,omitempty"`
+}
+
+// ImageResponse represents a product image response
+type ImageResponse struct {
+	ID      uint   `json:"id"`
+	AltText string `json:"alt_text"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	// URLs holds the URL of the original and of each thumbnail: small,
+	// medium and large
+	URLs map[string]string `json:"urls"`
+}
+
+// ProductHighlightResponse shows where a product matched a search, with
+// the matching words wrapped in <b></b>
+type ProductHighlightResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// CategoryResponse represents a category with its subcategories
+type CategoryResponse struct {
+	ID        uint               `json:"id"`
+	Name      string             `json:"name"`
+	Slug      string             `json:"slug"`
+	ParentID  *uint              `json:"parent_id"`
+	SortOrder int                `json:"sort_order"`
+	Children  []CategoryResponse `json:"children,omitempty"`
+}
+
+// CartResponse represents a shopping cart response. Total is Subtotal less
+// Discount plus Shipping. HasWarnings is set when any item has warnings;
+// checkout is refused until they are accepted. CouponError says why the
+// coupon code entered does not apply, if it does not.
 type CartResponse struct {
-	ID    uint               `json:"id"`
-	Items []CartItemResponse `json:"items"`
-	Total float64            `json:"total"`
+	ID        uint               `json:"id"`
+	Items     []CartItemResponse `json:"items"`
+	Subtotal  models.Money       `json:"subtotal"`
+	Discounts []DiscountResponse `json:"discounts"`
+	Discount  models.Money       `json:"discount"`
+	Shipping  models.Money       `json:"shipping"`
+	// Tax is included in the prices, and so in Total, when PricesIncludeTax,
+	// and added to Total otherwise
+	Tax              models.Money `json:"tax"`
+	PricesIncludeTax bool         `json:"prices_include_tax"`
+	Total            models.Money `json:"total"`
+	CouponCode       string       `json:"coupon_code,omitempty"`
+	CouponError      string       `json:"coupon_error,omitempty"`
+	HasWarnings      bool         `json:"has_warnings"`
+}
+
+// DiscountResponse represents a discount line of a cart or order
+type DiscountResponse struct {
+	PromotionID uint         `json:"promotion_id"`
+	Code        string       `json:"code,omitempty"`
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	Amount      models.Money `json:"amount"`
+}
+
+// PromotionResponse represents a promotion response
+type PromotionResponse struct {
+	ID           uint         `json:"id"`
+	Name         string       `json:"name"`
+	Code         string       `json:"code,omitempty"`
+	Type         string       `json:"type"`
+	Percent      int          `json:"percent,omitempty"`
+	Amount       models.Money `json:"amount"`
+	BuyQuantity  int          `json:"buy_quantity,omitempty"`
+	GetQuantity  int          `json:"get_quantity,omitempty"`
+	MinSubtotal  models.Money `json:"min_subtotal"`
+	CategoryID   *uint        `json:"category_id"`
+	Brand        string       `json:"brand,omitempty"`
+	PerUserLimit int          `json:"per_user_limit"`
+	UsageLimit   int          `json:"usage_limit"`
+	UsageCount   int          `json:"usage_count"`
+	StartsAt     *time.Time   `json:"starts_at"`
+	EndsAt       *time.Time   `json:"ends_at"`
+	Active       bool         `json:"active"`
+}
+
+// PromotionsResponse represents a paginated list of promotions
+type PromotionsResponse struct {
+	Promotions []PromotionResponse `json:"promotions"`
+	Total      int64               `json:"total"`
+	Page       int                 `json:"page"`
+	Limit      int                 `json:"limit"`
 }
 
 // CartItemResponse represents a cart item response
 type CartItemResponse struct {
-	ID       uint            `json:"id"`
-	Product  ProductResponse `json:"product"`
-	Quantity int             `json:"quantity"`
-	Subtotal float64         `json:"subtotal"`
+	ID       uint                  `json:"id"`
+	Product  ProductResponse       `json:"product"`
+	Variant  *VariantResponse      `json:"variant,omitempty"`
+	Quantity int                   `json:"quantity"`
+	Subtotal models.Money          `json:"subtotal"`
+	Warnings []CartWarningResponse `json:"warnings,omitempty"`
 }
 
-// OrderResponse represents an order response
+// CartWarningResponse represents a change to a cart item since it was
+// added: price_increased, price_decreased, insufficient_stock or
+// unavailable
+type CartWarningResponse struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	OldPrice  *models.Money `json:"old_price,omitempty"`
+	NewPrice  *models.Money `json:"new_price,omitempty"`
+	Available *int          `json:"available,omitempty"`
+}
+
+// OrderResponse represents an order response. TotalAmount is Subtotal
+// less Discount plus Shipping, plus Tax unless PricesIncludeTax.
 type OrderResponse struct {
-	ID           uint                `json:"id"`
-	Status       string              `json:"status"`
-	TotalAmount  float64             `json:"total_amount"`
-	Items        []OrderItemResponse `json:"items"`
-	Address      string              `json:"address"`
-	ShippingType string              `json:"shipping_type"`
-	PaymentID    string              `json:"payment_id,omitempty"`
-	PaymentType  string              `json:"payment_type,omitempty"`
-	CreatedAt    string              `json:"created_at"`
-}
-
-// OrderItemResponse represents an order item response
+	ID               uint                `json:"id"`
+	Status           string              `json:"status"`
+	Subtotal         models.Money        `json:"subtotal"`
+	Discounts        []DiscountResponse  `json:"discounts"`
+	Discount         models.Money        `json:"discount"`
+	Shipping         models.Money        `json:"shipping"`
+	Tax              models.Money        `json:"tax"`
+	TaxRegion        string              `json:"tax_region,omitempty"`
+	PricesIncludeTax bool                `json:"prices_include_tax"`
+	TotalAmount      models.Money        `json:"total_amount"`
+	ExchangeRate     string              `json:"exchange_rate"`
+	Items            []OrderItemResponse `json:"items"`
+	Address          string              `json:"address"`
+	ShippingType     string              `json:"shipping_type"`
+	PaymentID        string              `json:"payment_id,omitempty"`
+	PaymentType      string              `json:"payment_type,omitempty"`
+	// RefundDue is set while the refund of a cancelled paid order waits to
+	// be accepted by the payment provider; RefundError says why it was not
+	RefundDue   bool   `json:"refund_due,omitempty"`
+	RefundError string `json:"refund_error,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// OrderItemResponse represents an order item response.
+// ProductName, ProductSKU and ImageURL describe the product as it was when
+// the order was placed.
 type OrderItemResponse struct {
-	ID       uint            `json:"id"`
-	Product  ProductResponse `json:"product"`
-	Quantity int             `json:"quantity"`
-	Price    float64         `json:"price"`
+	ID          uint            `json:"id"`
+	Product     ProductResponse `json:"product"`
+	ProductName string          `json:"product_name"`
+	ProductSKU  string          `json:"product_sku"`
+	ImageURL    string          `json:"image_url"`
+	// VariantID and VariantOptions are set for products sold by variant
+	VariantID      *uint             `json:"variant_id,omitempty"`
+	VariantOptions map[string]string `json:"variant_options,omitempty"`
+	Quantity       int               `json:"quantity"`
+	Price          models.Money      `json:"price"`
+	// TaxRate is the percentage the item was taxed at and Tax the tax on
+	// its line, after discounts
+	TaxClass string       `json:"tax_class"`
+	TaxRate  string       `json:"tax_rate"`
+	Tax      models.Money `json:"tax"`
+}
+
+// OrderStatusEventResponse represents one entry of an order's status history.
+// ActorID is empty for changes made by the system.
+type OrderStatusEventResponse struct {
+	FromStatus string `json:"from_status,omitempty"`
+	ToStatus   string `json:"to_status"`
+	ActorID    *uint  `json:"actor_id,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	CreatedAt  string `json:"created_at"`
 }
 
 // PaymentResponse represents a payment response
@@ -118,15 +514,76 @@ type PaymentResponse struct {
 	ClientSecret string `json:"client_secret,omitempty"` // For Stripe
 }
 
+// ExchangeRatesResponse represents the store's exchange rates
+type ExchangeRatesResponse struct {
+	BaseCurrency string            `json:"base_currency"`
+	Rates        map[string]string `json:"rates"`
+}
+
+// TaxRatesResponse represents the store's tax rates
+type TaxRatesResponse struct {
+	PricesIncludeTax bool              `json:"prices_include_tax"`
+	Rates            []TaxRateResponse `json:"rates"`
+}
+
+// TaxRateResponse represents a tax rate response
+type TaxRateResponse struct {
+	ID       uint   `json:"id"`
+	Region   string `json:"region"`
+	TaxClass string `json:"tax_class"`
+	Rate     string `json:"rate"`
+	Name     string `json:"name,omitempty"`
+}
+
+// WebhookResponse acknowledges a payment provider webhook
+type WebhookResponse struct {
+	Received bool `json:"received"`
+}
+
 // QueryParams for filtering/pagination
 
+// ReviewQueryParams represents query parameters for paging through reviews
+type ReviewQueryParams struct {
+	Page  int `form:"page,default=1" binding:"min=1"`
+	Limit int `form:"limit,default=10" binding:"min=1,max=100"`
+}
+
+// StockMovementQueryParams represents query parameters for paging through
+// stock movements
+type StockMovementQueryParams struct {
+	VariantID *uint `form:"variant_id"`
+	Page      int   `form:"page,default=1" binding:"min=1"`
+	Limit     int   `form:"limit,default=20" binding:"min=1,max=100"`
+}
+
+// PromotionQueryParams represents query parameters for paging through
+// promotions
+type PromotionQueryParams struct {
+	Page  int `form:"page,default=1" binding:"min=1"`
+	Limit int `form:"limit,default=20" binding:"min=1,max=100"`
+}
+
+// StockAlertQueryParams represents query parameters for paging through
+// stock alerts
+type StockAlertQueryParams struct {
+	Status string `form:"status,default=open" binding:"oneof=open resolved"`
+	Page   int    `form:"page,default=1" binding:"min=1"`
+	Limit  int    `form:"limit,default=20" binding:"min=1,max=100"`
+}
+
 // ProductQueryParams represents query parameters for product filtering
 type ProductQueryParams struct {
-	Category string  `form:"category"`
-	Brand    string  `form:"brand"`
-	MinPrice float64 `form:"min_price"`
-	MaxPrice float64 `form:"max_price"`
-	Search   string  `form:"search"`
-	Page     int     `form:"page,default=1"`
-	Limit    int     `form:"limit,default=10"`
+	Category  string  `form:"category"` // category slug
+	Brand     string  `form:"brand"`
+	MinPrice  int64   `form:"min_price"` // in minor units of Currency
+	MaxPrice  int64   `form:"max_price"` // in minor units of Currency
+	InStock   *bool   `form:"in_stock"`
+	MinRating float64 `form:"min_rating" binding:"omitempty,min=1,max=5"`
+	Search    string  `form:"search"`
+	Currency  string  `form:"currency"`
+	Facets    bool    `form:"facets"`
+	Sort      string  `form:"sort"`
+	Cursor    string  `form:"cursor"`
+	Page      int     `form:"page,default=1" binding:"min=1"`
+	Limit     int     `form:"limit,default=10" binding:"min=1,max=100"`
 }
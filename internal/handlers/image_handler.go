@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImageHandler handles product image requests
+type ImageHandler struct {
+	imageService   *services.ImageService
+	productService *services.ProductService
+}
+
+// NewImageHandler creates a new ImageHandler
+func NewImageHandler(imageService *services.ImageService, productService *services.ProductService) *ImageHandler {
+	return &ImageHandler{
+		imageService:   imageService,
+		productService: productService,
+	}
+}
+
+// UploadImage handles adding an image to a product's gallery
+// @Summary Upload a product image
+// @Description Upload a JPEG, PNG or WebP image of at most 10 MB to the end of a product's gallery. The image is stored without its metadata, along with small (150px), medium (400px) and large (800px) thumbnails (admin only)
+// @Tags products
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param image formData file true "Image file"
+// @Param alt formData string false "Alternative text"
+// @Security Bearer
+// @Success 201 {object} ImageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Router /products/{id}/images [post]
+func (h *ImageHandler) UploadImage(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	if _, err := h.productService.GetProductByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Leave room for the rest of the multipart form
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxImageSize+1<<20)
+
+	header, err := c.FormFile("image")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: services.ErrImageTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "image file is required"})
+		return
+	}
+	if header.Size > services.MaxImageSize {
+		c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: services.ErrImageTooLarge.Error()})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer file.Close()
+
+	image, err := h.imageService.UploadImage(c.Request.Context(), uint(id), file, c.PostForm("alt"))
+	if err != nil {
+		c.JSON(imageErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newImageResponse(image))
+}
+
+// ReorderImages handles changing the order of a product's gallery
+// @Summary Reorder product images
+// @Description Put a product's images in a new order. The first image becomes the product's main image (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param order body ImageOrderRequest true "Image IDs in their new order"
+// @Security Bearer
+// @Success 200 {array} ImageResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /products/{id}/images/order [put]
+func (h *ImageHandler) ReorderImages(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	var req ImageOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if _, err := h.productService.GetProductByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	images, err := h.imageService.ReorderImages(uint(id), req.ImageIDs)
+	if err != nil {
+		c.JSON(imageErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	responses := make([]ImageResponse, 0, len(images))
+	for i := range images {
+		responses = append(responses, newImageResponse(&images[i]))
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+// DeleteImage handles removing an image from a product's gallery
+// @Summary Delete a product image
+// @Description Remove an image from a product's gallery and delete its files (admin only)
+// @Tags products
+// @Param id path int true "Product ID"
+// @Param imageId path int true "Image ID"
+// @Security Bearer
+// @Success 204 {object} nil
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /products/{id}/images/{imageId} [delete]
+func (h *ImageHandler) DeleteImage(c *gin.Context) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+	imageID, err := strconv.ParseUint(c.Param("imageId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid image id"})
+		return
+	}
+
+	if err := h.imageService.DeleteImage(c.Request.Context(), uint(productID), uint(imageID)); err != nil {
+		c.JSON(imageErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// imageErrorStatus maps an image service error to an HTTP status code
+func imageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrImageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrImageTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrInvalidImageOrder):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newImageResponse converts a product image to its response format
+func newImageResponse(image *models.ProductImage) ImageResponse {
+	return ImageResponse{
+		ID:      image.ID,
+		AltText: image.AltText,
+		Width:   image.Width,
+		Height:  image.Height,
+		URLs:    image.URLs,
+	}
+}
@@ -44,6 +44,19 @@ func AuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthMiddleware authenticates requests that carry a JWT like
+// AuthMiddleware, and lets requests without one through as guests
+func OptionalAuthMiddleware(jwtService *auth.JWTService) gin.HandlerFunc {
+	authMiddleware := AuthMiddleware(jwtService)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		authMiddleware(c)
+	}
+}
+
 // AdminMiddleware creates a middleware for admin-only access
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
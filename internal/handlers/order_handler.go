@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"store/internal/services"
 	"strconv"
@@ -27,7 +28,7 @@ func NewOrderHandler(orderService *services.OrderService, paymentService *servic
 
 // CreateOrder handles creating a new order from the cart
 // @Summary Create order
-// @Description Create a new order from the cart
+// @Description Create a new order from the cart, with the discounts of the promotions that apply and of the cart's coupon, and the tax of the region it ships to; a region no tax rate applies in is refused with 400. Refused with 409 while the cart has warnings about changed prices or stock (accept them with POST /cart/accept first) or its coupon no longer applies.
 // @Tags orders
 // @Accept json
 // @Produce json
@@ -36,6 +37,7 @@ func NewOrderHandler(orderService *services.OrderService, paymentService *servic
 // @Success 201 {object} OrderResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /orders [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
@@ -54,41 +56,17 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	}
 
 	// Create order
-	order, err := h.orderService.CreateOrder(userID.(uint), req.Address, req.ShippingType)
+	order, err := h.orderService.CreateOrder(userID.(uint), req.Address, req.Region, req.ShippingType, req.Currency)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrCartChanged) || errors.Is(err, services.ErrCouponNotApplicable) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Convert to response format
-	var orderItems []OrderItemResponse
-	for _, item := range order.Items {
-		orderItems = append(orderItems, OrderItemResponse{
-			ID: item.ID,
-			Product: ProductResponse{
-				ID:          item.Product.ID,
-				Name:        item.Product.Name,
-				Description: item.Product.Description,
-				Price:       item.Product.Price,
-				Category:    item.Product.Category,
-				Brand:       item.Product.Brand,
-				ImageURL:    item.Product.ImageURL,
-				Stock:       item.Product.Stock,
-			},
-			Quantity: item.Quantity,
-			Price:    item.Price,
-		})
-	}
-
-	response := OrderResponse{
-		ID:           order.ID,
-		Status:       string(order.Status),
-		TotalAmount:  order.TotalAmount,
-		Items:        orderItems,
-		Address:      order.Address,
-		ShippingType: order.ShippingType,
-		CreatedAt:    order.CreatedAt.Format(time.RFC3339),
-	}
+	response := newOrderResponse(order)
 
 	c.JSON(http.StatusCreated, response)
 }
@@ -120,37 +98,8 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 
 	// Convert to response format
 	var responses []OrderResponse
-	for _, order := range orders {
-		var orderItems []OrderItemResponse
-		for _, item := range order.Items {
-			orderItems = append(orderItems, OrderItemResponse{
-				ID: item.ID,
-				Product: ProductResponse{
-					ID:          item.Product.ID,
-					Name:        item.Product.Name,
-					Description: item.Product.Description,
-					Price:       item.Product.Price,
-					Category:    item.Product.Category,
-					Brand:       item.Product.Brand,
-					ImageURL:    item.Product.ImageURL,
-					Stock:       item.Product.Stock,
-				},
-				Quantity: item.Quantity,
-				Price:    item.Price,
-			})
-		}
-
-		responses = append(responses, OrderResponse{
-			ID:           order.ID,
-			Status:       string(order.Status),
-			TotalAmount:  order.TotalAmount,
-			Items:        orderItems,
-			Address:      order.Address,
-			ShippingType: order.ShippingType,
-			PaymentID:    order.PaymentID,
-			PaymentType:  order.PaymentType,
-			CreatedAt:    order.CreatedAt.Format(time.RFC3339),
-		})
+	for i := range orders {
+		responses = append(responses, newOrderResponse(&orders[i]))
 	}
 
 	c.JSON(http.StatusOK, responses)
@@ -192,49 +141,124 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 
 	// Check if the order belongs to the user (unless admin)
 	role, _ := c.Get("userRole")
-	if order.UserID != userID.(uint) && role != "admin" {
+	if order.UserID != userID.(uint) && role != models.RoleAdmin {
 		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
 		return
 	}
 
+	response := newOrderResponse(order)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetOrderHistory handles retrieving the status history of an order
+// @Summary Get order status history
+// @Description Get the timeline of status changes of an order
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Security Bearer
+// @Success 200 {array} OrderStatusEventResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/history [get]
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	// Get order ID from path
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid order id"})
+		return
+	}
+
+	// Get order
+	order, err := h.orderService.GetOrderByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Check if the order belongs to the user (unless admin)
+	role, _ := c.Get("userRole")
+	if order.UserID != userID.(uint) && role != models.RoleAdmin {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	// Get history
+	events, err := h.orderService.GetStatusHistory(order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Convert to response format
-	var orderItems []OrderItemResponse
-	for _, item := range order.Items {
-		orderItems = append(orderItems, OrderItemResponse{
-			ID: item.ID,
-			Product: ProductResponse{
-				ID:          item.Product.ID,
-				Name:        item.Product.Name,
-				Description: item.Product.Description,
-				Price:       item.Product.Price,
-				Category:    item.Product.Category,
-				Brand:       item.Product.Brand,
-				ImageURL:    item.Product.ImageURL,
-				Stock:       item.Product.Stock,
-			},
-			Quantity: item.Quantity,
-			Price:    item.Price,
+	responses := make([]OrderStatusEventResponse, 0, len(events))
+	for _, event := range events {
+		responses = append(responses, OrderStatusEventResponse{
+			FromStatus: string(event.FromStatus),
+			ToStatus:   string(event.ToStatus),
+			ActorID:    event.ActorID,
+			Reason:     event.Reason,
+			CreatedAt:  event.CreatedAt.Format(time.RFC3339),
 		})
 	}
 
-	response := OrderResponse{
-		ID:           order.ID,
-		Status:       string(order.Status),
-		TotalAmount:  order.TotalAmount,
-		Items:        orderItems,
-		Address:      order.Address,
-		ShippingType: order.ShippingType,
-		PaymentID:    order.PaymentID,
-		PaymentType:  order.PaymentType,
-		CreatedAt:    order.CreatedAt.Format(time.RFC3339),
+	c.JSON(http.StatusOK, responses)
+}
+
+// CancelOrder handles a customer cancelling their own order
+// @Summary Cancel order
+// @Description Cancel an order that has not shipped yet. Items are restocked and paid orders are refunded; if the payment provider does not accept the refund, the order is still cancelled and comes back with refund_due and refund_error set while the refund is retried.
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Security Bearer
+// @Success 200 {object} OrderResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{id}/cancel [post]
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	// Get order ID from path
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid order id"})
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	// Cancel order
+	order, err := h.orderService.CancelOrder(c.Request.Context(), userID.(uint), uint(id))
+	if err != nil {
+		c.JSON(orderErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newOrderResponse(order))
 }
 
 // ProcessPayment handles payment processing for an order
 // @Summary Process payment
-// @Description Create payment intent for order
+// @Description Create payment intent for an order that is pending or whose payment failed; other orders are refused with 409
 // @Tags payments
 // @Accept json
 // @Produce json
@@ -243,6 +267,7 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 // @Success 200 {object} PaymentResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /pay [post]
 func (h *OrderHandler) ProcessPayment(c *gin.Context) {
@@ -274,24 +299,21 @@ func (h *OrderHandler) ProcessPayment(c *gin.Context) {
 	}
 
 	// Create payment intent
-	paymentID, err := h.paymentService.CreatePaymentIntent(req.OrderID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	// Process payment
-	err = h.orderService.ProcessPayment(req.OrderID, paymentID, "stripe")
+	intent, err := h.paymentService.CreatePaymentIntent(c.Request.Context(), req.OrderID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrOrderNotPayable) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Return response
+	// Return response. The order stays pending until the payment provider
+	// confirms the payment through the webhook
 	response := PaymentResponse{
-		PaymentID: paymentID,
-		// In a real implementation, we would include the client secret
-		// ClientSecret: "...",
+		PaymentID:    intent.ID,
+		ClientSecret: intent.ClientSecret,
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -299,20 +321,28 @@ func (h *OrderHandler) ProcessPayment(c *gin.Context) {
 
 // UpdateOrderStatus handles updating the status of an order (admin only)
 // @Summary Update order status
-// @Description Update the status of an order (admin only)
+// @Description Update the status of an order; cancelling a paid order refunds it (admin only)
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param id path int true "Order ID"
-// @Param status body string true "New status"
+// @Param status body OrderStatusRequest true "New status"
 // @Security Bearer
 // @Success 200 {object} OrderResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /orders/{id}/status [put]
 func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
+	// Get user ID from context
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
 	// Get order ID from path
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
@@ -322,18 +352,16 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	// Parse request
-	var statusReq struct {
-		Status string `json:"status" binding:"required"`
-	}
-	if err := c.ShouldBindJSON(&statusReq); err != nil {
+	var req OrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	// Update status
-	err = h.orderService.UpdateOrderStatus(uint(id), models.OrderStatus(statusReq.Status))
+	err = h.orderService.UpdateOrderStatus(c.Request.Context(), uint(id), models.OrderStatus(req.Status), userID.(uint), req.Reason)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		c.JSON(orderErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
@@ -344,37 +372,70 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// Convert to response format
+	response := newOrderResponse(order)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// orderErrorStatus maps order service errors to HTTP status codes
+func orderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrUnknownOrderStatus):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInvalidStatusTransition),
+		errors.Is(err, services.ErrOrderNotCancellable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newOrderResponse converts an order model to its response format
+func newOrderResponse(order *models.Order) OrderResponse {
 	var orderItems []OrderItemResponse
 	for _, item := range order.Items {
 		orderItems = append(orderItems, OrderItemResponse{
-			ID: item.ID,
-			Product: ProductResponse{
-				ID:          item.Product.ID,
-				Name:        item.Product.Name,
-				Description: item.Product.Description,
-				Price:       item.Product.Price,
-				Category:    item.Product.Category,
-				Brand:       item.Product.Brand,
-				ImageURL:    item.Product.ImageURL,
-				Stock:       item.Product.Stock,
-			},
-			Quantity: item.Quantity,
-			Price:    item.Price,
+			ID:             item.ID,
+			Product:        newProductResponse(&item.Product),
+			ProductName:    item.ProductName,
+			ProductSKU:     item.ProductSKU,
+			ImageURL:       item.ProductImageURL,
+			VariantID:      item.VariantID,
+			VariantOptions: item.VariantOptions,
+			Quantity:       item.Quantity,
+			Price:          item.Price,
+			TaxClass:       item.TaxClass,
+			TaxRate:        item.TaxRate,
+			Tax:            item.Tax,
 		})
 	}
 
-	response := OrderResponse{
-		ID:           order.ID,
-		Status:       string(order.Status),
-		TotalAmount:  order.TotalAmount,
-		Items:        orderItems,
-		Address:      order.Address,
-		ShippingType: order.ShippingType,
-		PaymentID:    order.PaymentID,
-		PaymentType:  order.PaymentType,
-		CreatedAt:    order.CreatedAt.Format(time.RFC3339),
+	discounts := make([]DiscountResponse, 0, len(order.Discounts))
+	for _, discount := range order.Discounts {
+		discounts = append(discounts, newDiscountResponse(&discount))
 	}
 
-	c.JSON(http.StatusOK, response)
+	return OrderResponse{
+		ID:               order.ID,
+		Status:           string(order.Status),
+		Subtotal:         order.Subtotal,
+		Discounts:        discounts,
+		Discount:         order.Discount,
+		Shipping:         order.Shipping,
+		Tax:              order.Tax,
+		TaxRegion:        order.TaxRegion,
+		PricesIncludeTax: order.PricesIncludeTax,
+		TotalAmount:      order.Total,
+		ExchangeRate:     order.ExchangeRate,
+		Items:            orderItems,
+		Address:          order.Address,
+		ShippingType:     order.ShippingType,
+		PaymentID:        order.PaymentID,
+		PaymentType:      order.PaymentType,
+		RefundDue:        order.RefundDue,
+		RefundError:      order.RefundError,
+		CreatedAt:        order.CreatedAt.Format(time.RFC3339),
+	}
 }
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"store/internal/services"
+	"store/pkg/payment"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBodySize limits the size of webhook payloads we accept
+const maxWebhookBodySize = 64 << 10
+
+// PaymentHandler handles callbacks from the payment provider
+type PaymentHandler struct {
+	paymentService *services.PaymentService
+	orderService   *services.OrderService
+}
+
+// NewPaymentHandler creates a new PaymentHandler
+func NewPaymentHandler(paymentService *services.PaymentService, orderService *services.OrderService) *PaymentHandler {
+	return &PaymentHandler{
+		paymentService: paymentService,
+		orderService:   orderService,
+	}
+}
+
+// Webhook handles payment events sent by the payment provider
+// @Summary Payment webhook
+// @Description Receive signed payment events (succeeded, failed, refunded) from the payment provider
+// @Tags payments
+// @Accept json
+// @Produce json
+// @Param Stripe-Signature header string true "Webhook signature"
+// @Success 200 {object} WebhookResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/webhook [post]
+func (h *PaymentHandler) Webhook(c *gin.Context) {
+	// Read the raw body, the signature is computed over it
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize)
+	payload, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	// Verify signature and decode event
+	event, err := h.paymentService.ParseWebhook(payload, c.GetHeader(payment.SignatureHeader))
+	if err != nil {
+		if errors.Is(err, payment.ErrWebhookNotConfigured) {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Apply event; a failure makes the provider retry later
+	if err := h.orderService.HandlePaymentEvent(c.Request.Context(), event); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookResponse{Received: true})
+}
@@ -1,23 +1,27 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"store/internal/models"
 	"store/internal/services"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 // ProductHandler handles product-related requests
 type ProductHandler struct {
-	productService *services.ProductService
+	productService  *services.ProductService
+	currencyService *services.CurrencyService
 }
 
 // NewProductHandler creates a new ProductHandler
-func NewProductHandler(productService *services.ProductService) *ProductHandler {
+func NewProductHandler(productService *services.ProductService, currencyService *services.CurrencyService) *ProductHandler {
 	return &ProductHandler{
-		productService: productService,
+		productService:  productService,
+		currencyService: currencyService,
 	}
 }
 
@@ -26,13 +30,19 @@ func NewProductHandler(productService *services.ProductService) *ProductHandler
 // @Description Get a list of products with optional filters
 // @Tags products
 // @Produce json
-// @Param category query string false "Category filter"
+// @Param category query string false "Category slug; includes its subcategories"
 // @Param brand query string false "Brand filter"
-// @Param min_price query number false "Minimum price filter"
-// @Param max_price query number false "Maximum price filter"
-// @Param search query string false "Search term"
+// @Param min_price query int false "Minimum price filter, in minor units of currency"
+// @Param max_price query int false "Maximum price filter, in minor units of currency"
+// @Param in_stock query bool false "Only products in stock (true) or out of stock (false)"
+// @Param min_rating query number false "Only products rated at least this much, from 1 to 5"
+// @Param search query string false "Full-text search, combined with the other filters"
+// @Param currency query string false "Currency to show prices in (default: base currency)"
+// @Param sort query string false "Sort order: newest (default), relevance (default when searching), price_asc, price_desc, name_asc, name_desc, popularity, rating"
 // @Param page query int false "Page number (default: 1)"
-// @Param limit query int false "Page size (default: 10)"
+// @Param limit query int false "Page size, at most 100 (default: 10)"
+// @Param cursor query string false "Cursor from next_cursor of the previous page; overrides page"
+// @Param facets query bool false "Include category, brand, price and availability counts"
 // @Success 200 {object} ProductsResponse
 // @Failure 400 {object} ErrorResponse
 // @Router /products [get]
@@ -43,41 +53,81 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		return
 	}
 
-	products, err := h.productService.GetProducts(params.Category, params.Brand, params.MinPrice, params.MaxPrice)
+	currency, err := h.currencyService.Resolve(params.Currency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	minPrice, maxPrice, err := h.currencyService.BasePriceRange(params.MinPrice, params.MaxPrice, currency)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// If search is provided, use search instead of filters
-	if params.Search != "" {
-		products, err = h.productService.SearchProducts(params.Search)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	page := services.ProductPage{
+		Sort:   services.ProductSort(params.Sort),
+		Page:   params.Page,
+		Limit:  params.Limit,
+		Cursor: params.Cursor,
+	}
+
+	filter := services.ProductFilter{
+		Search:    params.Search,
+		Category:  params.Category,
+		Brand:     params.Brand,
+		MinPrice:  minPrice,
+		MaxPrice:  maxPrice,
+		InStock:   params.InStock,
+		MinRating: params.MinRating,
+	}
+
+	list, err := h.productService.GetProducts(filter, page)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidProductSort) || errors.Is(err, services.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
 	}
 
 	// Convert to response format
-	var productResponses []ProductResponse
-	for _, product := range products {
-		productResponses = append(productResponses, ProductResponse{
-			ID:          product.ID,
-			Name:        product.Name,
-			Description: product.Description,
-			Price:       product.Price,
-			Category:    product.Category,
-			Brand:       product.Brand,
-			ImageURL:    product.ImageURL,
-			Stock:       product.Stock,
-		})
+	productResponses := make([]ProductResponse, 0, len(list.Products))
+	for i := range list.Products {
+		response, err := newLocalizedProductResponse(h.currencyService, &list.Products[i], currency)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if highlight, ok := list.Highlights[list.Products[i].ID]; ok {
+			response.Highlight = &ProductHighlightResponse{
+				Name:        highlight.Name,
+				Description: highlight.Description,
+			}
+		}
+		productResponses = append(productResponses, response)
 	}
 
 	response := ProductsResponse{
-		Products: productResponses,
-		Total:    int64(len(productResponses)),
-		Page:     params.Page,
-		Limit:    params.Limit,
+		Products:   productResponses,
+		Total:      list.Total,
+		Page:       params.Page,
+		Limit:      params.Limit,
+		NextCursor: list.NextCursor,
+	}
+
+	if params.Facets {
+		facets, err := h.productService.GetProductFacets(filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		response.Facets, err = h.newProductFacetsResponse(facets, currency)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -89,7 +139,9 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 // @Tags products
 // @Produce json
 // @Param id path int true "Product ID"
+// @Param currency query string false "Currency to show prices in (default: base currency)"
 // @Success 200 {object} ProductResponse
+// @Failure 400 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /products/{id} [get]
 func (h *ProductHandler) GetProduct(c *gin.Context) {
@@ -106,15 +158,16 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 		return
 	}
 
-	response := ProductResponse{
-		ID:          product.ID,
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-		Category:    product.Category,
-		Brand:       product.Brand,
-		ImageURL:    product.ImageURL,
-		Stock:       product.Stock,
+	currency, err := h.currencyService.Resolve(c.Query("currency"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := newLocalizedProductResponse(h.currencyService, product, currency)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -134,40 +187,28 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 // @Failure 403 {object} ErrorResponse
 // @Router /products [post]
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
 	var req ProductRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	product := models.Product{
-		Name:        req.Name,
-		Description: req.Description,
-		Price:       req.Price,
-		Category:    req.Category,
-		Brand:       req.Brand,
-		ImageURL:    req.ImageURL,
-		Stock:       req.Stock,
-	}
+	var product models.Product
+	applyProductRequest(&product, &req)
 
-	err := h.productService.CreateProduct(&product)
+	err := h.productService.CreateProduct(&product, userID.(uint))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		c.JSON(productErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	response := ProductResponse{
-		ID:          product.ID,
-		Name:        product.Name,
-		Description: product.Description,
-		Price:       product.Price,
-		Category:    product.Category,
-		Brand:       product.Brand,
-		ImageURL:    product.ImageURL,
-		Stock:       product.Stock,
-	}
-
-	c.JSON(http.StatusCreated, response)
+	c.JSON(http.StatusCreated, newProductResponse(&product))
 }
 
 // UpdateProduct handles updating an existing product
@@ -184,8 +225,15 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
 // @Router /products/{id} [put]
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
 	idStr := c.Param("id")
 	id, err := strconv.ParseUint(idStr, 10, 32)
 	if err != nil {
@@ -207,33 +255,16 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	}
 
 	// Update fields
-	existingProduct.Name = req.Name
-	existingProduct.Description = req.Description
-	existingProduct.Price = req.Price
-	existingProduct.Category = req.Category
-	existingProduct.Brand = req.Brand
-	existingProduct.ImageURL = req.ImageURL
-	existingProduct.Stock = req.Stock
+	applyProductRequest(existingProduct, &req)
 
 	// Save updates
-	err = h.productService.UpdateProduct(existingProduct)
+	err = h.productService.UpdateProduct(existingProduct, userID.(uint))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		c.JSON(productErrorStatus(err), ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	response := ProductResponse{
-		ID:          existingProduct.ID,
-		Name:        existingProduct.Name,
-		Description: existingProduct.Description,
-		Price:       existingProduct.Price,
-		Category:    existingProduct.Category,
-		Brand:       existingProduct.Brand,
-		ImageURL:    existingProduct.ImageURL,
-		Stock:       existingProduct.Stock,
-	}
-
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, newProductResponse(existingProduct))
 }
 
 // DeleteProduct handles deleting a product
@@ -272,3 +303,364 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// CreateVariant handles adding a variant to a product
+// @Summary Create a product variant
+// @Description Add a variant with its own options, SKU, price and stock to a product (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param variant body VariantRequest true "Variant details"
+// @Security Bearer
+// @Success 201 {object} VariantResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /products/{id}/variants [post]
+func (h *ProductHandler) CreateVariant(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	var req VariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	product, err := h.productService.GetProductByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	variant := models.ProductVariant{
+		ProductID:   product.ID,
+		SKU:         req.SKU,
+		Options:     req.Options,
+		PriceAmount: req.Price,
+		Stock:       req.Stock,
+	}
+
+	if err := h.productService.CreateVariant(&variant, userID.(uint)); err != nil {
+		c.JSON(productErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newVariantResponse(product, &variant))
+}
+
+// UpdateVariant handles updating a product variant
+// @Summary Update a product variant
+// @Description Update the options, SKU, price or stock of a product variant (admin only)
+// @Tags products
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param variantId path int true "Variant ID"
+// @Param variant body VariantRequest true "Variant details"
+// @Security Bearer
+// @Success 200 {object} VariantResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /products/{id}/variants/{variantId} [put]
+func (h *ProductHandler) UpdateVariant(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	productID, variantID, ok := parseVariantPath(c)
+	if !ok {
+		return
+	}
+
+	var req VariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	product, err := h.productService.GetProductByID(productID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	variant, err := h.productService.GetVariantByID(productID, variantID)
+	if err != nil {
+		c.JSON(productErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	variant.SKU = req.SKU
+	variant.Options = req.Options
+	variant.PriceAmount = req.Price
+	variant.Stock = req.Stock
+
+	if err := h.productService.UpdateVariant(variant, userID.(uint)); err != nil {
+		c.JSON(productErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newVariantResponse(product, variant))
+}
+
+// DeleteVariant handles deleting a product variant
+// @Summary Delete a product variant
+// @Description Delete a product variant (admin only)
+// @Tags products
+// @Param id path int true "Product ID"
+// @Param variantId path int true "Variant ID"
+// @Security Bearer
+// @Success 204 {object} nil
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /products/{id}/variants/{variantId} [delete]
+func (h *ProductHandler) DeleteVariant(c *gin.Context) {
+	productID, variantID, ok := parseVariantPath(c)
+	if !ok {
+		return
+	}
+
+	if err := h.productService.DeleteVariant(productID, variantID); err != nil {
+		c.JSON(productErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseVariantPath reads the product and variant IDs from the path. It
+// writes an error response and returns false if either is invalid.
+func parseVariantPath(c *gin.Context) (uint, uint, bool) {
+	productID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return 0, 0, false
+	}
+	variantID, err := strconv.ParseUint(c.Param("variantId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid variant id"})
+		return 0, 0, false
+	}
+	return uint(productID), uint(variantID), true
+}
+
+// productErrorStatus maps a product service error to an HTTP status code
+func productErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrVariantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrStockBelowReserved):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newProductResponse converts a product model to its response format, with
+// the price in the base currency
+func newProductResponse(product *models.Product) ProductResponse {
+	var prices map[string]int64
+	if len(product.Prices) > 0 {
+		prices = make(map[string]int64, len(product.Prices))
+		for _, price := range product.Prices {
+			prices[price.Currency] = price.Amount
+		}
+	}
+
+	var images []ImageResponse
+	for i := range product.Images {
+		images = append(images, newImageResponse(&product.Images[i]))
+	}
+
+	var variants []VariantResponse
+	for i := range product.Variants {
+		variants = append(variants, newVariantResponse(product, &product.Variants[i]))
+	}
+
+	return ProductResponse{
+		ID:               product.ID,
+		Name:             product.Name,
+		SKU:              product.SKU,
+		Description:      product.Description,
+		Price:            product.Price,
+		Prices:           prices,
+		CategoryID:       product.CategoryID,
+		Category:         product.CategoryName,
+		Brand:            product.Brand,
+		TaxClass:         product.TaxClass,
+		ImageURL:         product.ImageURL,
+		Images:           images,
+		Stock:            product.Stock,
+		Reserved:         product.Reserved,
+		Available:        product.Available(),
+		ReorderThreshold: product.ReorderThreshold,
+		Rating:           product.Rating,
+		ReviewCount:      product.ReviewCount,
+		Variants:         variants,
+	}
+}
+
+// newVariantResponse converts a product variant to its response format,
+// with the price in the base currency
+func newVariantResponse(product *models.Product, variant *models.ProductVariant) VariantResponse {
+	return VariantResponse{
+		ID:        variant.ID,
+		SKU:       variant.SKU,
+		Options:   variant.Options,
+		Price:     variant.Price(product),
+		Stock:     variant.Stock,
+		Reserved:  variant.Reserved,
+		Available: variant.Available(),
+	}
+}
+
+// newLocalizedVariantResponse converts a product variant to its response
+// format, with the price in currency
+func newLocalizedVariantResponse(currencyService *services.CurrencyService, product *models.Product, variant *models.ProductVariant, currency string) (VariantResponse, error) {
+	response := newVariantResponse(product, variant)
+
+	price, err := currencyService.Price(product, variant, currency)
+	if err != nil {
+		return VariantResponse{}, err
+	}
+	response.Price = price
+
+	return response, nil
+}
+
+// newProductFacetsResponse converts product facets to their response
+// format, with the price bucket bounds converted to currency
+func (h *ProductHandler) newProductFacetsResponse(facets *services.ProductFacets, currency string) (*ProductFacetsResponse, error) {
+	response := &ProductFacetsResponse{
+		Categories: newFacetCountResponses(facets.Categories),
+		Brands:     newFacetCountResponses(facets.Brands),
+		Prices:     make([]PriceBucketResponse, 0, len(facets.Prices)),
+		Availability: AvailabilityResponse{
+			InStock:    facets.InStock,
+			OutOfStock: facets.OutOfStock,
+		},
+	}
+
+	baseCurrency := h.currencyService.BaseCurrency()
+	for _, bucket := range facets.Prices {
+		minPrice, err := h.currencyService.Convert(models.NewMoney(bucket.Min, baseCurrency), currency)
+		if err != nil {
+			return nil, err
+		}
+		maxPrice, err := h.currencyService.Convert(models.NewMoney(bucket.Max, baseCurrency), currency)
+		if err != nil {
+			return nil, err
+		}
+		response.Prices = append(response.Prices, PriceBucketResponse{
+			Min:   minPrice,
+			Max:   maxPrice,
+			Count: bucket.Count,
+		})
+	}
+
+	return response, nil
+}
+
+// newFacetCountResponses converts facet counts to their response format
+func newFacetCountResponses(counts []services.FacetCount) []FacetCountResponse {
+	responses := make([]FacetCountResponse, 0, len(counts))
+	for _, count := range counts {
+		responses = append(responses, FacetCountResponse{Value: count.Value, Label: count.Label, Count: count.Count})
+	}
+	return responses
+}
+
+// newLocalizedProductResponse converts a product model to its response
+// format, with the price in currency
+func newLocalizedProductResponse(currencyService *services.CurrencyService, product *models.Product, currency string) (ProductResponse, error) {
+	response := newProductResponse(product)
+
+	price, err := currencyService.Price(product, nil, currency)
+	if err != nil {
+		return ProductResponse{}, err
+	}
+	response.Price = price
+
+	for i := range product.Variants {
+		variant, err := newLocalizedVariantResponse(currencyService, product, &product.Variants[i], currency)
+		if err != nil {
+			return ProductResponse{}, err
+		}
+		response.Variants[i] = variant
+	}
+
+	return response, nil
+}
+
+// applyProductRequest sets the fields of a product from a request
+func applyProductRequest(product *models.Product, req *ProductRequest) {
+	product.Name = req.Name
+	product.SKU = req.SKU
+	product.Description = req.Description
+	product.Price.Amount = req.Price
+	product.CategoryID = req.CategoryID
+	product.Brand = req.Brand
+	product.TaxClass = req.TaxClass
+	product.ImageURL = req.ImageURL
+	product.Stock = req.Stock
+	product.ReorderThreshold = req.ReorderThreshold
+	product.Prices = newProductPrices(req.Prices)
+}
+
+// newProductRequest converts a product to the request that would create it
+// as it is
+func newProductRequest(product *models.Product) ProductRequest {
+	req := ProductRequest{
+		Name:             product.Name,
+		SKU:              product.SKU,
+		Description:      product.Description,
+		Price:            product.Price.Amount,
+		CategoryID:       product.CategoryID,
+		Brand:            product.Brand,
+		TaxClass:         product.TaxClass,
+		ImageURL:         product.ImageURL,
+		Stock:            product.Stock,
+		ReorderThreshold: product.ReorderThreshold,
+	}
+	if len(product.Prices) > 0 {
+		req.Prices = make(map[string]int64, len(product.Prices))
+		for _, price := range product.Prices {
+			req.Prices[price.Currency] = price.Amount
+		}
+	}
+	return req
+}
+
+// newProductPrices converts per-currency price overrides from a request
+func newProductPrices(prices map[string]int64) []models.ProductPrice {
+	var productPrices []models.ProductPrice
+	for currency, amount := range prices {
+		productPrices = append(productPrices, models.ProductPrice{
+			Currency: strings.ToUpper(currency),
+			Amount:   amount,
+		})
+	}
+	return productPrices
+}
@@ -0,0 +1,551 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// maxImportSize is the largest product import file accepted, in bytes
+const maxImportSize = 32 << 20
+
+// productCSVColumns are the columns of a product CSV file, named after the
+// fields of ProductRequest. Fixed prices in other currencies go in extra
+// columns named productCSVPricePrefix followed by the currency code, e.g.
+// price_rub.
+var productCSVColumns = []string{"sku", "name", "description", "price", "category_id", "brand", "tax_class", "image_url", "stock", "reorder_threshold"}
+
+const productCSVPricePrefix = "price_"
+
+// csvFormulaPrefixes are the characters spreadsheets read as the start of a
+// formula. Exported text cells starting with one get a leading quote, which
+// the import strips again.
+const csvFormulaPrefixes = "=+-@"
+
+// errUnsupportedImportFormat is returned for an import file that is neither
+// CSV nor JSON
+var errUnsupportedImportFormat = errors.New("import file must be CSV (text/csv) or JSON (application/json)")
+
+// productImportRecord is a row read from an import file. apply sets the
+// fields the row gives on a request, which starts out as the product
+// already saved under sku, if there is one.
+type productImportRecord struct {
+	row   int
+	sku   string
+	apply func(req *ProductRequest) error
+}
+
+// ImportProducts handles creating and updating products in bulk
+// @Summary Import products
+// @Description Create or update products from a CSV or JSON file, matching them by SKU. The file is sent as the request body (text/csv or application/json) or as the "file" field of a multipart form. Each row is validated like a product request; if any row is invalid nothing is imported. Columns or fields left out keep the product's current values (admin only)
+// @Tags products
+// @Accept text/csv
+// @Accept json
+// @Accept multipart/form-data
+// @Produce json
+// @Param dry_run query bool false "Only validate the file and report what would change"
+// @Param file formData file false "CSV or JSON file"
+// @Security Bearer
+// @Success 200 {object} ProductImportResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 422 {object} ProductImportResponse
+// @Router /admin/products/import [post]
+func (h *ProductHandler) ImportProducts(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid dry_run"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	records, err := readProductImport(c)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("import file is larger than %d MB", maxImportSize>>20)})
+		case errors.Is(err, errUnsupportedImportFormat):
+			c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+
+	skus := make([]string, 0, len(records))
+	for _, record := range records {
+		if record.sku != "" {
+			skus = append(skus, record.sku)
+		}
+	}
+	existing, err := h.productService.GetProductsBySKU(skus)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	rows := make([]services.ProductImportRow, 0, len(records))
+	for _, record := range records {
+		product, req := existing[record.sku], ProductRequest{}
+		if product != nil {
+			req = newProductRequest(product)
+		} else {
+			product = &models.Product{}
+		}
+
+		row := services.ProductImportRow{Row: record.row, Product: product}
+		if err := record.apply(&req); err != nil {
+			row.Err = err
+		} else if err := binding.Validator.ValidateStruct(&req); err != nil {
+			row.Err = err
+		} else {
+			applyProductRequest(product, &req)
+		}
+		if row.Err != nil {
+			row.Product = &models.Product{SKU: record.sku}
+		}
+		rows = append(rows, row)
+	}
+
+	results, err := h.productService.ImportProducts(rows, dryRun, userID.(uint))
+	if err != nil && !errors.Is(err, services.ErrInvalidImport) {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := ProductImportResponse{
+		DryRun: dryRun,
+		Rows:   make([]ProductImportRowResponse, 0, len(results)),
+	}
+	for _, result := range results {
+		rowResponse := ProductImportRowResponse{Row: result.Row, SKU: result.SKU, Action: result.Action}
+		switch {
+		case result.Err != nil:
+			rowResponse.Error = result.Err.Error()
+			response.Failed++
+		case result.Action == services.ProductImportCreate:
+			response.Created++
+		case result.Action == services.ProductImportUpdate:
+			response.Updated++
+		}
+		response.Rows = append(response.Rows, rowResponse)
+	}
+
+	if errors.Is(err, services.ErrInvalidImport) {
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportProducts handles downloading the whole catalog
+// @Summary Export products
+// @Description Download every product as CSV or JSON, in the format accepted by the import (admin only)
+// @Tags products
+// @Produce text/csv
+// @Produce json
+// @Param format query string false "csv (default) or json"
+// @Security Bearer
+// @Success 200 {array} ProductRequest
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/products/export [get]
+func (h *ProductHandler) ExportProducts(c *gin.Context) {
+	switch c.DefaultQuery("format", "csv") {
+	case "csv":
+		h.exportProductsCSV(c)
+	case "json":
+		h.exportProductsJSON(c)
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "format must be csv or json"})
+	}
+}
+
+// exportProductsCSV streams the catalog as CSV, with a price column for
+// every currency any product has a fixed price in
+func (h *ProductHandler) exportProductsCSV(c *gin.Context) {
+	currencies, err := h.productService.GetPriceCurrencies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	header := append([]string{}, productCSVColumns...)
+	for _, currency := range currencies {
+		header = append(header, productCSVPricePrefix+strings.ToLower(currency))
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="products.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(header); err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	err = h.productService.ExportProducts(func(products []models.Product) error {
+		for i := range products {
+			req := newProductRequest(&products[i])
+			record := []string{
+				escapeCSVText(req.SKU),
+				escapeCSVText(req.Name),
+				escapeCSVText(req.Description),
+				strconv.FormatInt(req.Price, 10),
+				strconv.FormatUint(uint64(req.CategoryID), 10),
+				escapeCSVText(req.Brand),
+				escapeCSVText(req.TaxClass),
+				escapeCSVText(req.ImageURL),
+				strconv.Itoa(req.Stock),
+				strconv.Itoa(req.ReorderThreshold),
+			}
+			for _, currency := range currencies {
+				amount, ok := req.Prices[currency]
+				if ok {
+					record = append(record, strconv.FormatInt(amount, 10))
+				} else {
+					record = append(record, "")
+				}
+			}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		c.Writer.Flush()
+		return w.Error()
+	})
+	if err != nil {
+		// The response has started, so the error can only be logged
+		_ = c.Error(err)
+	}
+}
+
+// exportProductsJSON streams the catalog as a JSON array of product requests
+func (h *ProductHandler) exportProductsJSON(c *gin.Context) {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="products.json"`)
+	c.Status(http.StatusOK)
+
+	separator := "[\n"
+	err := h.productService.ExportProducts(func(products []models.Product) error {
+		for i := range products {
+			data, err := json.Marshal(newProductRequest(&products[i]))
+			if err != nil {
+				return err
+			}
+			if _, err := c.Writer.WriteString(separator); err != nil {
+				return err
+			}
+			if _, err := c.Writer.Write(data); err != nil {
+				return err
+			}
+			separator = ",\n"
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		// The response has started, so the error can only be logged
+		_ = c.Error(err)
+		return
+	}
+
+	if separator == "[\n" {
+		_, _ = c.Writer.WriteString("[")
+	}
+	_, _ = c.Writer.WriteString("\n]\n")
+}
+
+// readProductImport reads the rows of an import file sent as the request
+// body or as the "file" field of a multipart form
+func readProductImport(c *gin.Context) ([]productImportRecord, error) {
+	switch c.ContentType() {
+	case "text/csv":
+		return parseProductCSV(c.Request.Body)
+	case "application/json":
+		return parseProductJSON(c.Request.Body)
+	case "multipart/form-data":
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("import file is required: %w", err)
+		}
+		return parseProductFile(header)
+	default:
+		return nil, errUnsupportedImportFormat
+	}
+}
+
+// parseProductFile reads the rows of an uploaded import file, telling CSV
+// from JSON by its extension
+func parseProductFile(header *multipart.FileHeader) ([]productImportRecord, error) {
+	var parse func(io.Reader) ([]productImportRecord, error)
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".csv":
+		parse = parseProductCSV
+	case ".json":
+		parse = parseProductJSON
+	default:
+		return nil, errUnsupportedImportFormat
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parse(file)
+}
+
+// parseProductCSV reads the rows of a CSV import file. The first line names
+// the columns; only sku is required. Rows are numbered by their line in the
+// file, so they match the row numbers of a spreadsheet.
+func parseProductCSV(r io.Reader) ([]productImportRecord, error) {
+	br := bufio.NewReader(r)
+
+	// Spreadsheets add a byte order mark, and separate columns with
+	// semicolons in locales that use a decimal comma
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte("\xEF\xBB\xBF")) {
+		_, _ = br.Discard(3)
+	}
+	head, _ := br.Peek(br.Size())
+	firstLine, _, _ := bytes.Cut(head, []byte("\n"))
+
+	reader := csv.NewReader(br)
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = ';'
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("import file is empty")
+		}
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	columns, err := parseProductCSVHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []productImportRecord
+	for {
+		values, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if strings.TrimSpace(strings.Join(values, "")) == "" {
+			// Spreadsheets often end with empty rows
+			continue
+		}
+
+		line, _ := reader.FieldPos(0)
+		record := productImportRecord{row: line}
+		for i, column := range columns {
+			if column == "sku" && i < len(values) {
+				record.sku = strings.TrimSpace(values[i])
+			}
+		}
+		if len(values) != len(columns) {
+			count := len(values)
+			record.apply = func(*ProductRequest) error {
+				return fmt.Errorf("row has %d columns, the header has %d", count, len(columns))
+			}
+			records = append(records, record)
+			continue
+		}
+
+		record.apply = func(req *ProductRequest) error {
+			for i, column := range columns {
+				if err := setProductCSVField(req, column, strings.TrimSpace(values[i])); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// parseProductCSVHeader checks the column names of a CSV import file and
+// returns them in lower case
+func parseProductCSVHeader(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		column := strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, c := range productCSVColumns {
+			known = known || c == column
+		}
+		if currency, ok := strings.CutPrefix(column, productCSVPricePrefix); ok && len(currency) == 3 {
+			known = true
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("column %q appears more than once", name)
+		}
+		seen[column] = true
+		columns[i] = column
+	}
+
+	if !seen["sku"] {
+		return nil, errors.New("column \"sku\" is required")
+	}
+	return columns, nil
+}
+
+// setProductCSVField sets the field of a request a CSV column holds. An
+// empty price_xxx cell removes the fixed price in that currency.
+func setProductCSVField(req *ProductRequest, column, value string) error {
+	var err error
+	switch column {
+	case "sku":
+		req.SKU = unescapeCSVText(value)
+	case "name":
+		req.Name = unescapeCSVText(value)
+	case "description":
+		req.Description = unescapeCSVText(value)
+	case "price":
+		req.Price, err = parseCSVInt(value)
+	case "category_id":
+		var id int64
+		id, err = parseCSVInt(value)
+		if err == nil && id < 0 {
+			err = strconv.ErrRange
+		}
+		req.CategoryID = uint(id)
+	case "brand":
+		req.Brand = unescapeCSVText(value)
+	case "tax_class":
+		req.TaxClass = unescapeCSVText(value)
+	case "image_url":
+		req.ImageURL = unescapeCSVText(value)
+	case "stock":
+		var stock int64
+		stock, err = parseCSVInt(value)
+		req.Stock = int(stock)
+	case "reorder_threshold":
+		var threshold int64
+		threshold, err = parseCSVInt(value)
+		req.ReorderThreshold = int(threshold)
+	default:
+		currency := strings.ToUpper(strings.TrimPrefix(column, productCSVPricePrefix))
+		if value == "" {
+			delete(req.Prices, currency)
+			return nil
+		}
+		var amount int64
+		amount, err = parseCSVInt(value)
+		if req.Prices == nil {
+			req.Prices = make(map[string]int64)
+		}
+		req.Prices[currency] = amount
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %q is not a whole number", column, value)
+	}
+	return nil
+}
+
+// escapeCSVText quotes a text cell a spreadsheet would run as a formula
+func escapeCSVText(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVText removes the quote escapeCSVText puts before a text cell
+func unescapeCSVText(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+// parseCSVInt parses a whole number from a CSV cell; an empty cell is zero
+func parseCSVInt(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// parseProductJSON reads the rows of a JSON import file: an array of
+// product requests, numbered from 1. Fields left out of an object keep the
+// product's current values.
+func parseProductJSON(r io.Reader) ([]productImportRecord, error) {
+	var objects []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&objects); err != nil {
+		return nil, fmt.Errorf("invalid JSON: import file must be an array of products: %w", err)
+	}
+
+	records := make([]productImportRecord, 0, len(objects))
+	for i, object := range objects {
+		record := productImportRecord{row: i + 1}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(object, &fields); err != nil {
+			record.apply = func(*ProductRequest) error { return errors.New("invalid product: must be a JSON object") }
+			records = append(records, record)
+			continue
+		}
+		if sku, ok := fields["sku"]; ok {
+			_ = json.Unmarshal(sku, &record.sku)
+			record.sku = strings.TrimSpace(record.sku)
+		}
+
+		record.apply = func(req *ProductRequest) error {
+			if _, ok := fields["prices"]; ok {
+				// Given prices replace the current ones rather than adding to them
+				req.Prices = nil
+			}
+			if err := json.Unmarshal(object, req); err != nil {
+				return fmt.Errorf("invalid product: %w", err)
+			}
+			req.SKU = strings.TrimSpace(req.SKU)
+			return nil
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
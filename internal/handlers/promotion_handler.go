@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromotionHandler handles promotion-related requests
+type PromotionHandler struct {
+	promotionService *services.PromotionService
+}
+
+// NewPromotionHandler creates a new PromotionHandler
+func NewPromotionHandler(promotionService *services.PromotionService) *PromotionHandler {
+	return &PromotionHandler{
+		promotionService: promotionService,
+	}
+}
+
+// GetPromotions handles listing promotions
+// @Summary Get promotions
+// @Description Get a page of promotions and coupons, newest first (admin only)
+// @Tags promotions
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Page size, at most 100 (default: 20)"
+// @Security Bearer
+// @Success 200 {object} PromotionsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/promotions [get]
+func (h *PromotionHandler) GetPromotions(c *gin.Context) {
+	var params PromotionQueryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	promotions, total, err := h.promotionService.GetPromotions(params.Page, params.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := PromotionsResponse{
+		Promotions: make([]PromotionResponse, 0, len(promotions)),
+		Total:      total,
+		Page:       params.Page,
+		Limit:      params.Limit,
+	}
+	for i := range promotions {
+		response.Promotions = append(response.Promotions, newPromotionResponse(&promotions[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetPromotion handles retrieving a promotion
+// @Summary Get a promotion
+// @Description Get a promotion or coupon by ID (admin only)
+// @Tags promotions
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Security Bearer
+// @Success 200 {object} PromotionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/promotions/{id} [get]
+func (h *PromotionHandler) GetPromotion(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid promotion id"})
+		return
+	}
+
+	promotion, err := h.promotionService.GetPromotionByID(uint(id))
+	if err != nil {
+		c.JSON(promotionErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newPromotionResponse(promotion))
+}
+
+// CreatePromotion handles creating a new promotion
+// @Summary Create a promotion
+// @Description Create a promotion, or a coupon if it has a code (admin only)
+// @Tags promotions
+// @Accept json
+// @Produce json
+// @Param promotion body PromotionRequest true "Promotion details"
+// @Security Bearer
+// @Success 201 {object} PromotionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/promotions [post]
+func (h *PromotionHandler) CreatePromotion(c *gin.Context) {
+	var req PromotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var promotion models.Promotion
+	applyPromotionRequest(&promotion, &req)
+
+	if err := h.promotionService.CreatePromotion(&promotion); err != nil {
+		c.JSON(promotionErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newPromotionResponse(&promotion))
+}
+
+// UpdatePromotion handles updating an existing promotion
+// @Summary Update a promotion
+// @Description Change the rules of a promotion or coupon, or turn it off (admin only)
+// @Tags promotions
+// @Accept json
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Param promotion body PromotionRequest true "Promotion details"
+// @Security Bearer
+// @Success 200 {object} PromotionResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/promotions/{id} [put]
+func (h *PromotionHandler) UpdatePromotion(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid promotion id"})
+		return
+	}
+
+	var req PromotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	promotion, err := h.promotionService.GetPromotionByID(uint(id))
+	if err != nil {
+		c.JSON(promotionErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	applyPromotionRequest(promotion, &req)
+
+	if err := h.promotionService.UpdatePromotion(promotion); err != nil {
+		c.JSON(promotionErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newPromotionResponse(promotion))
+}
+
+// DeletePromotion handles deleting a promotion
+// @Summary Delete a promotion
+// @Description Delete a promotion or coupon; orders that used it keep their discounts (admin only)
+// @Tags promotions
+// @Param id path int true "Promotion ID"
+// @Security Bearer
+// @Success 204 {object} nil
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/promotions/{id} [delete]
+func (h *PromotionHandler) DeletePromotion(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid promotion id"})
+		return
+	}
+
+	if err := h.promotionService.DeletePromotion(uint(id)); err != nil {
+		c.JSON(promotionErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// promotionErrorStatus maps a promotion service error to an HTTP status
+// code
+func promotionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrPromotionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidPromotion):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// applyPromotionRequest copies the fields of a promotion request to a
+// promotion
+func applyPromotionRequest(promotion *models.Promotion, req *PromotionRequest) {
+	promotion.Name = req.Name
+	promotion.Code = req.Code
+	promotion.Type = models.PromotionType(req.Type)
+	promotion.Percent = req.Percent
+	promotion.Amount.Amount = req.Amount
+	promotion.BuyQuantity = req.BuyQuantity
+	promotion.GetQuantity = req.GetQuantity
+	promotion.MinSubtotal.Amount = req.MinSubtotal
+	promotion.CategoryID = req.CategoryID
+	promotion.Brand = req.Brand
+	promotion.PerUserLimit = req.PerUserLimit
+	promotion.UsageLimit = req.UsageLimit
+	promotion.StartsAt = req.StartsAt
+	promotion.EndsAt = req.EndsAt
+	promotion.Active = req.Active == nil || *req.Active
+}
+
+// newPromotionResponse converts a promotion to its response format
+func newPromotionResponse(promotion *models.Promotion) PromotionResponse {
+	return PromotionResponse{
+		ID:           promotion.ID,
+		Name:         promotion.Name,
+		Code:         promotion.Code,
+		Type:         string(promotion.Type),
+		Percent:      promotion.Percent,
+		Amount:       promotion.Amount,
+		BuyQuantity:  promotion.BuyQuantity,
+		GetQuantity:  promotion.GetQuantity,
+		MinSubtotal:  promotion.MinSubtotal,
+		CategoryID:   promotion.CategoryID,
+		Brand:        promotion.Brand,
+		PerUserLimit: promotion.PerUserLimit,
+		UsageLimit:   promotion.UsageLimit,
+		UsageCount:   promotion.UsageCount,
+		StartsAt:     promotion.StartsAt,
+		EndsAt:       promotion.EndsAt,
+		Active:       promotion.Active,
+	}
+}
+
+// newDiscountResponse converts a discount line to its response format
+func newDiscountResponse(discount *models.OrderDiscount) DiscountResponse {
+	return DiscountResponse{
+		PromotionID: discount.PromotionID,
+		Code:        discount.Code,
+		Name:        discount.Name,
+		Type:        string(discount.Type),
+		Amount:      discount.Amount,
+	}
+}
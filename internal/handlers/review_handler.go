@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReviewHandler handles product review requests
+type ReviewHandler struct {
+	reviewService *services.ReviewService
+}
+
+// NewReviewHandler creates a new ReviewHandler
+func NewReviewHandler(reviewService *services.ReviewService) *ReviewHandler {
+	return &ReviewHandler{
+		reviewService: reviewService,
+	}
+}
+
+// GetProductReviews handles retrieving the reviews of a product
+// @Summary Get product reviews
+// @Description Get a page of a product's approved reviews, newest first
+// @Tags reviews
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Page size, at most 100 (default: 10)"
+// @Success 200 {object} ReviewsResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /products/{id}/reviews [get]
+func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	var params ReviewQueryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	reviews, total, err := h.reviewService.GetProductReviews(uint(id), params.Page, params.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newReviewsResponse(reviews, total, params))
+}
+
+// CreateReview handles reviewing a product
+// @Summary Review a product
+// @Description Rate and review a product from one of your delivered orders. Reviews are shown once a moderator approves them
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param review body ReviewRequest true "Review"
+// @Security Bearer
+// @Success 201 {object} ReviewResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /products/{id}/reviews [post]
+func (h *ReviewHandler) CreateReview(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	var req ReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	review := models.Review{
+		ProductID: uint(id),
+		UserID:    userID.(uint),
+		Rating:    req.Rating,
+		Title:     req.Title,
+		Body:      req.Body,
+	}
+
+	if err := h.reviewService.CreateReview(&review); err != nil {
+		c.JSON(reviewErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newReviewResponse(&review))
+}
+
+// GetReviews handles listing reviews for moderation
+// @Summary Get reviews for moderation
+// @Description Get a page of reviews of all products with a status, oldest first (admin only)
+// @Tags reviews
+// @Produce json
+// @Param status query string false "pending (default), approved or rejected"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Page size, at most 100 (default: 10)"
+// @Security Bearer
+// @Success 200 {object} ReviewsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/reviews [get]
+func (h *ReviewHandler) GetReviews(c *gin.Context) {
+	var params ReviewQueryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	status := models.ReviewStatus(c.DefaultQuery("status", string(models.ReviewStatusPending)))
+	reviews, total, err := h.reviewService.GetReviews(status, params.Page, params.Limit)
+	if err != nil {
+		c.JSON(reviewErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newReviewsResponse(reviews, total, params))
+}
+
+// ModerateReview handles approving or rejecting a review
+// @Summary Moderate a review
+// @Description Approve or reject a review, or send it back to pending. Only approved reviews are shown and counted in the product's rating (admin only)
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Review ID"
+// @Param status body ReviewStatusRequest true "New status"
+// @Security Bearer
+// @Success 200 {object} ReviewResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/reviews/{id}/status [put]
+func (h *ReviewHandler) ModerateReview(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid review id"})
+		return
+	}
+
+	var req ReviewStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	review, err := h.reviewService.ModerateReview(uint(id), models.ReviewStatus(req.Status))
+	if err != nil {
+		c.JSON(reviewErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newReviewResponse(review))
+}
+
+// DeleteReview handles deleting a review
+// @Summary Delete a review
+// @Description Delete a review (admin only)
+// @Tags reviews
+// @Param id path int true "Review ID"
+// @Security Bearer
+// @Success 204 {object} nil
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/reviews/{id} [delete]
+func (h *ReviewHandler) DeleteReview(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid review id"})
+		return
+	}
+
+	if err := h.reviewService.DeleteReview(uint(id)); err != nil {
+		c.JSON(reviewErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// reviewErrorStatus maps a review service error to an HTTP status code
+func reviewErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrReviewNotFound), errors.Is(err, services.ErrProductNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotVerifiedBuyer):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrAlreadyReviewed):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrInvalidReviewStatus):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newReviewResponse converts a review to its response format
+func newReviewResponse(review *models.Review) ReviewResponse {
+	response := ReviewResponse{
+		ID:        review.ID,
+		ProductID: review.ProductID,
+		UserID:    review.UserID,
+		Rating:    review.Rating,
+		Title:     review.Title,
+		Body:      review.Body,
+		Status:    string(review.Status),
+		CreatedAt: review.CreatedAt.Format(time.RFC3339),
+	}
+	if review.User != nil {
+		response.Author = review.User.Name
+	}
+	return response
+}
+
+// newReviewsResponse converts a page of reviews to its response format
+func newReviewsResponse(reviews []models.Review, total int64, params ReviewQueryParams) ReviewsResponse {
+	response := ReviewsResponse{
+		Reviews: make([]ReviewResponse, 0, len(reviews)),
+		Total:   total,
+		Page:    params.Page,
+		Limit:   params.Limit,
+	}
+	for i := range reviews {
+		response.Reviews = append(response.Reviews, newReviewResponse(&reviews[i]))
+	}
+	return response
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StockAlertHandler handles low-stock alert and back-in-stock subscription
+// requests
+type StockAlertHandler struct {
+	stockAlertService *services.StockAlertService
+}
+
+// NewStockAlertHandler creates a new StockAlertHandler
+func NewStockAlertHandler(stockAlertService *services.StockAlertService) *StockAlertHandler {
+	return &StockAlertHandler{
+		stockAlertService: stockAlertService,
+	}
+}
+
+// Subscribe handles subscribing to a product coming back in stock
+// @Summary Subscribe to back in stock
+// @Description Get notified when an out-of-stock product, or variant, is back in stock
+// @Tags stock
+// @Accept json
+// @Param id path int true "Product ID"
+// @Param subscription body StockSubscriptionRequest false "Variant to wait for"
+// @Security Bearer
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /products/{id}/stock-subscription [post]
+func (h *StockAlertHandler) Subscribe(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	// The body is optional for products without variants
+	var req StockSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.stockAlertService.Subscribe(userID.(uint), uint(id), req.VariantID); err != nil {
+		c.JSON(stockAlertErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Unsubscribe handles cancelling a back-in-stock subscription
+// @Summary Unsubscribe from back in stock
+// @Description Stop waiting for a product, or variant, to be back in stock
+// @Tags stock
+// @Param id path int true "Product ID"
+// @Param variant_id query int false "Variant ID"
+// @Security Bearer
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /products/{id}/stock-subscription [delete]
+func (h *StockAlertHandler) Unsubscribe(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	var variantID *uint
+	if variantStr := c.Query("variant_id"); variantStr != "" {
+		variant, err := strconv.ParseUint(variantStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid variant id"})
+			return
+		}
+		variantID = new(uint)
+		*variantID = uint(variant)
+	}
+
+	if err := h.stockAlertService.Unsubscribe(userID.(uint), uint(id), variantID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetStockAlerts handles listing low-stock alerts
+// @Summary Get stock alerts
+// @Description Get a page of open or resolved low-stock alerts, newest first (admin only)
+// @Tags stock
+// @Produce json
+// @Param status query string false "open (default) or resolved"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Page size, at most 100 (default: 20)"
+// @Security Bearer
+// @Success 200 {object} StockAlertsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/stock-alerts [get]
+func (h *StockAlertHandler) GetStockAlerts(c *gin.Context) {
+	var params StockAlertQueryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	alerts, total, err := h.stockAlertService.GetAlerts(params.Status == "open", params.Page, params.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := StockAlertsResponse{
+		Alerts: make([]StockAlertResponse, 0, len(alerts)),
+		Total:  total,
+		Page:   params.Page,
+		Limit:  params.Limit,
+	}
+	for i := range alerts {
+		response.Alerts = append(response.Alerts, newStockAlertResponse(&alerts[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// stockAlertErrorStatus maps a stock alert service error to an HTTP status
+// code
+func stockAlertErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrVariantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrVariantRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrInStock):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newStockAlertResponse converts a stock alert to its response format
+func newStockAlertResponse(alert *models.StockAlert) StockAlertResponse {
+	response := StockAlertResponse{
+		ID:        alert.ID,
+		ProductID: alert.ProductID,
+		Available: alert.Available,
+		Threshold: alert.Threshold,
+		CreatedAt: alert.CreatedAt.Format(time.RFC3339),
+	}
+	if alert.Product != nil {
+		response.Product = alert.Product.Name
+		response.SKU = alert.Product.SKU
+	}
+	if alert.ResolvedAt != nil {
+		resolvedAt := alert.ResolvedAt.Format(time.RFC3339)
+		response.ResolvedAt = &resolvedAt
+	}
+	return response
+}
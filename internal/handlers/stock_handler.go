@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StockHandler handles stock ledger requests
+type StockHandler struct {
+	stockService *services.StockService
+}
+
+// NewStockHandler creates a new StockHandler
+func NewStockHandler(stockService *services.StockService) *StockHandler {
+	return &StockHandler{
+		stockService: stockService,
+	}
+}
+
+// AdjustStock handles a manual stock adjustment
+// @Summary Adjust stock
+// @Description Change the stock of a product, or of one of its variants, by a quantity or to a counted amount, and record it in the stock ledger (admin only)
+// @Tags stock
+// @Accept json
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param adjustment body StockAdjustmentRequest true "Stock adjustment"
+// @Security Bearer
+// @Success 201 {object} StockMovementResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /admin/products/{id}/stock-adjustments [post]
+func (h *StockHandler) AdjustStock(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	var req StockAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if (req.Quantity != 0) == (req.Count != nil) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "give either quantity or count"})
+		return
+	}
+
+	movement, err := h.stockService.AdjustStock(services.StockAdjustment{
+		ProductID: uint(id),
+		VariantID: req.VariantID,
+		Quantity:  req.Quantity,
+		Count:     req.Count,
+		Reason:    models.StockMovementReason(req.Reason),
+		Reference: req.Reference,
+		Note:      req.Note,
+	}, userID.(uint))
+	if err != nil {
+		c.JSON(stockErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newStockMovementResponse(movement))
+}
+
+// GetStockMovements handles retrieving the stock ledger of a product
+// @Summary Get stock movements
+// @Description Get a page of the stock movements of a product, or of one of its variants, newest first (admin only)
+// @Tags stock
+// @Produce json
+// @Param id path int true "Product ID"
+// @Param variant_id query int false "Only movements of this variant"
+// @Param page query int false "Page number (default: 1)"
+// @Param limit query int false "Page size, at most 100 (default: 20)"
+// @Security Bearer
+// @Success 200 {object} StockMovementsResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/products/{id}/stock-movements [get]
+func (h *StockHandler) GetStockMovements(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid product id"})
+		return
+	}
+
+	var params StockMovementQueryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	movements, total, err := h.stockService.GetMovements(uint(id), params.VariantID, params.Page, params.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := StockMovementsResponse{
+		Movements: make([]StockMovementResponse, 0, len(movements)),
+		Total:     total,
+		Page:      params.Page,
+		Limit:     params.Limit,
+	}
+	for i := range movements {
+		response.Movements = append(response.Movements, newStockMovementResponse(&movements[i]))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// stockErrorStatus maps a stock service error to an HTTP status code
+func stockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrVariantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidStockAdjustment), errors.Is(err, services.ErrVariantRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrStockBelowReserved):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newStockMovementResponse converts a stock movement to its response format
+func newStockMovementResponse(movement *models.StockMovement) StockMovementResponse {
+	return StockMovementResponse{
+		ID:         movement.ID,
+		ProductID:  movement.ProductID,
+		VariantID:  movement.VariantID,
+		Quantity:   movement.Quantity,
+		StockAfter: movement.StockAfter,
+		Reason:     string(movement.Reason),
+		Reference:  movement.Reference,
+		Note:       movement.Note,
+		ActorID:    movement.ActorID,
+		CreatedAt:  movement.CreatedAt.Format(time.RFC3339),
+	}
+}
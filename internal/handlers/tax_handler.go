@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"store/internal/models"
+	"store/internal/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaxHandler handles tax rate requests
+type TaxHandler struct {
+	taxService *services.TaxService
+}
+
+// NewTaxHandler creates a new TaxHandler
+func NewTaxHandler(taxService *services.TaxService) *TaxHandler {
+	return &TaxHandler{
+		taxService: taxService,
+	}
+}
+
+// GetTaxRates handles retrieving the tax rates
+// @Summary Get tax rates
+// @Description Get the tax rates per region and tax class, and whether prices include tax
+// @Tags taxes
+// @Produce json
+// @Success 200 {object} TaxRatesResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /tax-rates [get]
+func (h *TaxHandler) GetTaxRates(c *gin.Context) {
+	h.respondWithRates(c)
+}
+
+// SetTaxRates handles creating and updating tax rates
+// @Summary Set tax rates
+// @Description Create or update tax rates, matching them by region and tax class; rates not listed are left unchanged (admin only)
+// @Tags taxes
+// @Accept json
+// @Produce json
+// @Param rates body TaxRatesRequest true "Tax rates"
+// @Security Bearer
+// @Success 200 {object} TaxRatesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/tax-rates [put]
+func (h *TaxHandler) SetTaxRates(c *gin.Context) {
+	var req TaxRatesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	rates := make([]models.TaxRate, 0, len(req.Rates))
+	for _, rate := range req.Rates {
+		rates = append(rates, models.TaxRate{
+			Region:   rate.Region,
+			TaxClass: rate.TaxClass,
+			Rate:     rate.Rate,
+			Name:     rate.Name,
+		})
+	}
+
+	if err := h.taxService.SetRates(rates); err != nil {
+		c.JSON(taxErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.respondWithRates(c)
+}
+
+// DeleteTaxRate handles deleting a tax rate
+// @Summary Delete a tax rate
+// @Description Delete a tax rate; orders keep the tax they were charged (admin only)
+// @Tags taxes
+// @Param id path int true "Tax rate ID"
+// @Security Bearer
+// @Success 204 {object} nil
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/tax-rates/{id} [delete]
+func (h *TaxHandler) DeleteTaxRate(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid tax rate id"})
+		return
+	}
+
+	if err := h.taxService.DeleteRate(uint(id)); err != nil {
+		c.JSON(taxErrorStatus(err), ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// respondWithRates writes all tax rates as the response
+func (h *TaxHandler) respondWithRates(c *gin.Context) {
+	rates, err := h.taxService.GetRates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := TaxRatesResponse{
+		PricesIncludeTax: h.taxService.PricesIncludeTax(),
+		Rates:            make([]TaxRateResponse, 0, len(rates)),
+	}
+	for _, rate := range rates {
+		response.Rates = append(response.Rates, TaxRateResponse{
+			ID:       rate.ID,
+			Region:   rate.Region,
+			TaxClass: rate.TaxClass,
+			Rate:     rate.Rate,
+			Name:     rate.Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// taxErrorStatus maps a tax service error to an HTTP status code
+func taxErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTaxRateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTaxRegion), errors.Is(err, services.ErrInvalidTaxRate):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -51,19 +51,26 @@ func (h *UserHandler) Register(c *gin.Context) {
 		return
 	}
 
-	// Log in the user automatically after registration
-	token, err := h.userService.LoginUser(req.Email, req.Password)
+	// Log in the user automatically after registration, keeping their
+	// guest cart
+	cartToken := guestCartToken(c)
+	token, cartMerged, err := h.userService.LoginUser(req.Email, req.Password, cartToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Registration successful but couldn't log in"})
 		return
 	}
+	// A guest cart that could not be merged keeps its token, so the merge
+	// is tried again at the next login
+	if cartToken != "" && cartMerged {
+		clearGuestCartToken(c)
+	}
 
 	c.JSON(http.StatusCreated, TokenResponse{Token: token})
 }
 
 // Login handles user login
 // @Summary Login a user
-// @Description Login with email and password
+// @Description Login with email and password. A guest cart sent with the cart_token cookie or X-Cart-Token header is merged into the user's cart
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -79,11 +86,18 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.userService.LoginUser(req.Email, req.Password)
+	// The guest cart, if any, is merged into the user's cart
+	cartToken := guestCartToken(c)
+	token, cartMerged, err := h.userService.LoginUser(req.Email, req.Password, cartToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
 		return
 	}
+	// A guest cart that could not be merged keeps its token, so the merge
+	// is tried again at the next login
+	if cartToken != "" && cartMerged {
+		clearGuestCartToken(c)
+	}
 
 	c.JSON(http.StatusOK, TokenResponse{Token: token})
 }
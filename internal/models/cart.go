@@ -6,24 +6,36 @@ import (
 	"gorm.io/gorm"
 )
 
+// Cart belongs to a signed-in user, or to a guest who holds its GuestToken
 type Cart struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	UserID    uint           `gorm:"not null" json:"user_id"`
-	User      User           `gorm:"foreignKey:UserID" json:"-"`
-	Items     []CartItem     `json:"items"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID     uint  `gorm:"primaryKey" json:"id"`
+	UserID *uint `gorm:"index" json:"user_id"`
+	User   *User `gorm:"foreignKey:UserID" json:"-"`
+	// GuestToken identifies a guest's cart; it is empty for users' carts
+	GuestToken string `gorm:"size:64;index:idx_carts_guest_token,unique,where:guest_token <> ''" json:"-"`
+	// CouponCode is the promotion code entered for the cart, if any
+	CouponCode string         `gorm:"size:50;not null;default:''" json:"coupon_code"`
+	Items      []CartItem     `json:"items"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// CartItem is a product, or one of its variants, in a cart. Price is what
+// it cost in the store currency when it was added, or when the shopper last
+// accepted a change of price; it is zero for items added before prices were
+// kept.
 type CartItem struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	CartID    uint           `gorm:"not null" json:"cart_id"`
-	Cart      Cart           `gorm:"foreignKey:CartID" json:"-"`
-	ProductID uint           `gorm:"not null" json:"product_id"`
-	Product   Product        `json:"product"`
-	Quantity  int            `gorm:"default:1" json:"quantity"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	CartID    uint            `gorm:"not null" json:"cart_id"`
+	Cart      Cart            `gorm:"foreignKey:CartID" json:"-"`
+	ProductID uint            `gorm:"not null" json:"product_id"`
+	Product   Product         `json:"product"`
+	VariantID *uint           `gorm:"index" json:"variant_id"`
+	Variant   *ProductVariant `json:"variant,omitempty"`
+	Quantity  int             `gorm:"default:1" json:"quantity"`
+	Price     Money           `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	DeletedAt gorm.DeletedAt  `gorm:"index" json:"-"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Category groups products. Categories nest: a category with a ParentID is
+// a subcategory of its parent.
+type Category struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Name      string     `gorm:"not null" json:"name"`
+	Slug      string     `gorm:"uniqueIndex;not null" json:"slug"`
+	ParentID  *uint      `gorm:"index" json:"parent_id"`
+	Parent    *Category  `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	Children  []Category `gorm:"foreignKey:ParentID" json:"children,omitempty"`
+	SortOrder int        `gorm:"not null;default:0" json:"sort_order"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
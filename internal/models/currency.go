@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ExchangeRate is the number of units of Currency one unit of the store's
+// base currency buys. Rate is a decimal string, kept exact in the database.
+type ExchangeRate struct {
+	Currency  string    `gorm:"primaryKey;type:varchar(3)" json:"currency"`
+	Rate      string    `gorm:"type:numeric(20,10);not null" json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProductPrice is a fixed price for a product in a currency other than the
+// base currency. It takes precedence over converting the base price.
+type ProductPrice struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ProductID uint      `gorm:"not null;uniqueIndex:idx_product_prices_product_currency" json:"product_id"`
+	Currency  string    `gorm:"type:varchar(3);not null;uniqueIndex:idx_product_prices_product_currency" json:"currency"`
+	Amount    int64     `gorm:"not null" json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Money returns the price as Money
+func (p ProductPrice) Money() Money {
+	return NewMoney(p.Amount, p.Currency)
+}
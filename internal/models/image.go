@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Image sizes stored for every product image. ImageOriginal is the upload
+// itself, re-encoded without metadata; the others are thumbnails that fit
+// within a square of the given number of pixels.
+const (
+	ImageOriginal = "original"
+	ImageSmall    = "small"  // 150px
+	ImageMedium   = "medium" // 400px
+	ImageLarge    = "large"  // 800px
+)
+
+// ProductImage is one picture in a product's gallery. Images are shown in
+// Position order; the first one is the product's main image.
+type ProductImage struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ProductID uint   `gorm:"not null;index" json:"product_id"`
+	Position  int    `gorm:"not null;default:0" json:"position"`
+	AltText   string `json:"alt_text"`
+	Width     int    `gorm:"not null" json:"width"`
+	Height    int    `gorm:"not null" json:"height"`
+	// Files holds the storage key of each size, URLs its public URL
+	Files     map[string]string `gorm:"serializer:json;type:jsonb;not null" json:"-"`
+	URLs      map[string]string `gorm:"serializer:json;type:jsonb;not null" json:"urls"`
+	CreatedAt time.Time         `json:"created_at"`
+}
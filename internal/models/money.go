@@ -0,0 +1,198 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Money is an amount of money in a currency's minor units (e.g. cents for
+// USD, kopecks for RUB). Amounts are never stored or computed as floats.
+//
+// Rounding rules:
+//   - Adding, subtracting and multiplying by a quantity are exact.
+//   - Parsing a decimal amount ("19.99") with more fractional digits than the
+//     currency has rounds half away from zero to the nearest minor unit.
+//   - Multiplying by a fraction (percentages, rates) computes the exact
+//     result and rounds it half away from zero once, at the end.
+//
+// The zero value is zero in no particular currency; it can be added to or
+// subtracted from an amount in any currency.
+type Money struct {
+	Amount   int64  `gorm:"column:amount;not null;default:0" json:"amount"`
+	Currency string `gorm:"column:currency;type:varchar(3);not null" json:"currency"`
+}
+
+// minorUnits holds the number of decimal places of currencies that do not
+// use the default of two
+var minorUnits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+// MinorUnits returns the number of decimal places used by a currency
+func MinorUnits(currency string) int {
+	if units, ok := minorUnits[strings.ToUpper(currency)]; ok {
+		return units
+	}
+	return 2
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 currency code
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewMoney creates an amount from minor units
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// ParseMoney parses a decimal amount in major units, e.g. "19.99"
+func ParseMoney(value, currency string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(MinorUnits(currency))), nil)
+	r.Mul(r, new(big.Rat).SetInt(scale))
+
+	amount := roundHalfAwayFromZero(r)
+	if !amount.IsInt64() {
+		return Money{}, fmt.Errorf("amount %q out of range", value)
+	}
+	return NewMoney(amount.Int64(), currency), nil
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative reports whether the amount is below zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Add returns m + o. It panics if the currencies differ.
+func (m Money) Add(o Money) Money {
+	currency := m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: currency}
+}
+
+// Sub returns m - o. It panics if the currencies differ.
+func (m Money) Sub(o Money) Money {
+	currency := m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: currency}
+}
+
+// Mul returns m multiplied by a quantity
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// MulRat returns m multiplied by a fraction, rounded half away from zero
+func (m Money) MulRat(r *big.Rat) Money {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), r)
+	return Money{Amount: roundHalfAwayFromZero(product).Int64(), Currency: m.Currency}
+}
+
+// Convert converts m to another currency. rate is the number of units of
+// the target currency per unit of m's currency; the result is rounded half
+// away from zero to the target currency's minor units.
+func (m Money) Convert(currency string, rate *big.Rat) Money {
+	shift := MinorUnits(currency) - MinorUnits(m.Currency)
+	factor := new(big.Rat).Set(rate)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift >= 0 {
+		factor.Mul(factor, scale)
+	} else {
+		factor.Quo(factor, scale)
+	}
+
+	converted := m.MulRat(factor)
+	converted.Currency = strings.ToUpper(currency)
+	return converted
+}
+
+// Less reports whether m is smaller than o. It panics if the currencies differ.
+func (m Money) Less(o Money) bool {
+	m.mustMatch(o)
+	return m.Amount < o.Amount
+}
+
+// String formats the amount in major units, e.g. "19.99 USD"
+func (m Money) String() string {
+	units := MinorUnits(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if units == 0 {
+		return fmt.Sprintf("%s%d %s", sign, amount, m.Currency)
+	}
+
+	scale := int64(1)
+	for i := 0; i < units; i++ {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/scale, units, amount%scale, m.Currency)
+}
+
+// errCurrencyMismatch is the panic value for arithmetic across currencies
+var errCurrencyMismatch = errors.New("money: currency mismatch")
+
+// mustMatch returns the currency shared by m and o. A zero amount without a
+// currency matches any currency.
+func (m Money) mustMatch(o Money) string {
+	switch {
+	case m.Currency == o.Currency:
+		return m.Currency
+	case m.Currency == "" && m.Amount == 0:
+		return o.Currency
+	case o.Currency == "" && o.Amount == 0:
+		return m.Currency
+	}
+	panic(fmt.Errorf("%w: %s and %s", errCurrencyMismatch, m.Currency, o.Currency))
+}
+
+// roundHalfAwayFromZero rounds r to the nearest integer, with halves
+// rounded away from zero
+func roundHalfAwayFromZero(r *big.Rat) *big.Int {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	// (2*num + den) / (2*den) rounds a non-negative fraction half up
+	num.Mul(num, big.NewInt(2))
+	num.Add(num, den)
+	result := num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+
+	if negative {
+		result.Neg(result)
+	}
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+	}{
+		{value: "19.99", currency: "USD", want: Money{Amount: 1999, Currency: "USD"}},
+		{value: "19.99", currency: "usd", want: Money{Amount: 1999, Currency: "USD"}},
+		{value: " 5 ", currency: "EUR", want: Money{Amount: 500, Currency: "EUR"}},
+		{value: "0.005", currency: "USD", want: Money{Amount: 1, Currency: "USD"}},
+		{value: "0.0049", currency: "USD", want: Money{Amount: 0, Currency: "USD"}},
+		{value: "-0.005", currency: "USD", want: Money{Amount: -1, Currency: "USD"}},
+		{value: "-19.99", currency: "USD", want: Money{Amount: -1999, Currency: "USD"}},
+		{value: "1500", currency: "JPY", want: Money{Amount: 1500, Currency: "JPY"}},
+		{value: "1500.5", currency: "JPY", want: Money{Amount: 1501, Currency: "JPY"}},
+		{value: "1.2345", currency: "KWD", want: Money{Amount: 1235, Currency: "KWD"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.value, tt.currency)
+			if err != nil {
+				t.Fatalf("ParseMoney: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMoney = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoneyRejects(t *testing.T) {
+	for _, value := range []string{"", "abc", "1,99", "99999999999999999999"} {
+		if got, err := ParseMoney(value, "USD"); err == nil {
+			t.Errorf("ParseMoney(%q) = %+v, want an error", value, got)
+		}
+	}
+}
+
+func TestMulRat(t *testing.T) {
+	tests := []struct {
+		name  string
+		money Money
+		rat   *big.Rat
+		want  int64
+	}{
+		{name: "exact", money: NewMoney(1000, "USD"), rat: big.NewRat(19, 100), want: 190},
+		{name: "half up", money: NewMoney(250, "USD"), rat: big.NewRat(1, 100), want: 3},
+		{name: "half down on negative", money: NewMoney(-250, "USD"), rat: big.NewRat(1, 100), want: -3},
+		{name: "below half", money: NewMoney(1999, "USD"), rat: big.NewRat(1, 10), want: 200},
+		{name: "above half", money: NewMoney(1999, "USD"), rat: big.NewRat(19, 100), want: 380},
+		{name: "zero", money: NewMoney(0, "USD"), rat: big.NewRat(7, 3), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.money.MulRat(tt.rat)
+			if got.Amount != tt.want || got.Currency != tt.money.Currency {
+				t.Errorf("MulRat = %+v, want %d %s", got, tt.want, tt.money.Currency)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		money    Money
+		currency string
+		rate     string
+		want     Money
+	}{
+		{name: "same decimal places", money: NewMoney(1999, "USD"), currency: "RUB", rate: "92.5", want: NewMoney(184908, "RUB")},
+		{name: "to fewer decimal places", money: NewMoney(1999, "USD"), currency: "JPY", rate: "150", want: NewMoney(2999, "JPY")},
+		{name: "to more decimal places", money: NewMoney(1000, "USD"), currency: "KWD", rate: "0.3075", want: NewMoney(3075, "KWD")},
+		{name: "from fewer decimal places", money: NewMoney(1500, "JPY"), currency: "USD", rate: "0.0066667", want: NewMoney(1000, "USD")},
+		{name: "negative", money: NewMoney(-1999, "USD"), currency: "RUB", rate: "92.5", want: NewMoney(-184908, "RUB")},
+		{name: "lower-case code", money: NewMoney(100, "USD"), currency: "eur", rate: "0.9", want: NewMoney(90, "EUR")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := new(big.Rat).SetString(tt.rate)
+			if !ok {
+				t.Fatalf("invalid rate %q", tt.rate)
+			}
+			if got := tt.money.Convert(tt.currency, rate); got != tt.want {
+				t.Errorf("Convert = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundHalfAwayFromZero(t *testing.T) {
+	tests := []struct {
+		num, den int64
+		want     int64
+	}{
+		{num: 5, den: 2, want: 3},
+		{num: -5, den: 2, want: -3},
+		{num: 3, den: 2, want: 2},
+		{num: -3, den: 2, want: -2},
+		{num: 1, den: 2, want: 1},
+		{num: -1, den: 2, want: -1},
+		{num: 49, den: 100, want: 0},
+		{num: -49, den: 100, want: 0},
+		{num: 51, den: 100, want: 1},
+		{num: -51, den: 100, want: -1},
+		{num: 7, den: 1, want: 7},
+		{num: 0, den: 1, want: 0},
+	}
+
+	for _, tt := range tests {
+		r := big.NewRat(tt.num, tt.den)
+		if got := roundHalfAwayFromZero(r); got.Int64() != tt.want {
+			t.Errorf("roundHalfAwayFromZero(%s) = %s, want %d", r, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Notification is a message waiting in the outbox to be delivered to a
+// customer, or to the store's staff when UserID is nil. SentAt is set once
+// it has been delivered.
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Kind      string     `gorm:"type:varchar(30);not null" json:"kind"`
+	UserID    *uint      `gorm:"index" json:"user_id"`
+	Email     string     `json:"email"`
+	Subject   string     `gorm:"not null" json:"subject"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `gorm:"index" json:"sent_at"`
+}
@@ -13,33 +13,95 @@ const (
 	OrderStatusProcessing OrderStatus = "processing"
 	OrderStatusShipped    OrderStatus = "shipped"
 	OrderStatusDelivered  OrderStatus = "delivered"
+	OrderStatusCancelled  OrderStatus = "cancelled"
+	OrderStatusReturned   OrderStatus = "returned"
+	// Payment outcomes reported by the payment provider
+	OrderStatusPaymentFailed OrderStatus = "payment_failed"
+	OrderStatusRefunded      OrderStatus = "refunded"
 )
 
+// Valid reports whether s is a known order status
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusProcessing, OrderStatusShipped, OrderStatusDelivered,
+		OrderStatusCancelled, OrderStatusReturned, OrderStatusPaymentFailed, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// Order is a user's purchase. Total is what the user pays: Subtotal, the
+// sum of the items, less Discount, the sum of the Discounts, plus Shipping,
+// plus Tax unless PricesIncludeTax, in which case the tax is already part
+// of the prices. Tax is charged at the rates of TaxRegion.
 type Order struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	UserID       uint           `gorm:"not null" json:"user_id"`
-	User         User           `gorm:"foreignKey:UserID" json:"-"`
-	Items        []OrderItem    `json:"items"`
-	TotalAmount  float64        `gorm:"not null" json:"total_amount"`
-	Status       OrderStatus    `gorm:"type:varchar(20);default:'pending'" json:"status"`
-	Address      string         `gorm:"not null" json:"address"`
-	PaymentID    string         `json:"payment_id"`
-	PaymentType  string         `json:"payment_type"`
+	ID        uint            `gorm:"primaryKey" json:"id"`
+	UserID    uint            `gorm:"not null" json:"user_id"`
+	User      User            `gorm:"foreignKey:UserID" json:"-"`
+	Items     []OrderItem     `json:"items"`
+	Discounts []OrderDiscount `json:"discounts"`
+	Subtotal  Money           `gorm:"embedded;embeddedPrefix:subtotal_" json:"subtotal"`
+	Discount  Money           `gorm:"embedded;embeddedPrefix:discount_" json:"discount"`
+	Shipping  Money           `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping"`
+	Tax       Money           `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
+	Total     Money           `gorm:"embedded;embeddedPrefix:total_" json:"total"`
+	TaxRegion string          `gorm:"size:10;not null;default:''" json:"tax_region"`
+	// PricesIncludeTax is set when the prices of the order include tax
+	PricesIncludeTax bool        `gorm:"not null;default:false" json:"prices_include_tax"`
+	ExchangeRate     string      `gorm:"type:numeric(20,10);not null;default:1" json:"exchange_rate"`
+	Status           OrderStatus `gorm:"type:varchar(20);default:'pending'" json:"status"`
+	Address          string      `gorm:"not null" json:"address"`
+	PaymentID        string      `gorm:"index" json:"payment_id"`
+	PaymentType      string      `json:"payment_type"`
+	// RefundDue is set from when a paid order is cancelled until its refund
+	// has been requested from the payment provider; RefundError says why the
+	// last request failed
+	RefundDue    bool           `gorm:"not null;default:false;index" json:"refund_due"`
+	RefundError  string         `json:"refund_error"`
 	ShippingType string         `json:"shipping_type"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// OrderItem is a line of an order. ProductName, ProductSKU,
+// ProductImageURL and VariantOptions are copied from the product and variant
+// at purchase time so the order keeps showing what was bought after the
+// product is edited or deleted. ProductSKU is the variant's SKU if it has one.
 type OrderItem struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	OrderID   uint           `gorm:"not null" json:"order_id"`
-	Order     Order          `gorm:"foreignKey:OrderID" json:"-"`
-	ProductID uint           `gorm:"not null" json:"product_id"`
-	Product   Product        `json:"product"`
-	Quantity  int            `gorm:"default:1" json:"quantity"`
-	Price     float64        `gorm:"not null" json:"price"`
+	ID              uint              `gorm:"primaryKey" json:"id"`
+	OrderID         uint              `gorm:"not null" json:"order_id"`
+	Order           Order             `gorm:"foreignKey:OrderID" json:"-"`
+	ProductID       uint              `gorm:"not null" json:"product_id"`
+	Product         Product           `json:"product"`
+	ProductName     string            `gorm:"not null;default:''" json:"product_name"`
+	ProductSKU      string            `json:"product_sku"`
+	ProductImageURL string            `json:"product_image_url"`
+	VariantID       *uint             `json:"variant_id"`
+	Variant         *ProductVariant   `json:"-"`
+	VariantOptions  map[string]string `gorm:"serializer:json;type:jsonb" json:"variant_options,omitempty"`
+	Quantity        int               `gorm:"default:1" json:"quantity"`
+	Price           Money             `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	// TaxClass and TaxRate, a percentage, are what the item was taxed at;
+	// Tax is the tax on the whole line, after its share of the discounts
+	TaxClass  string         `gorm:"size:50;not null;default:''" json:"tax_class"`
+	TaxRate   string         `gorm:"type:numeric(7,4);not null;default:0" json:"tax_rate"`
+	Tax       Money          `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
+
+// OrderStatusEvent records one change of an order's status. ActorID is the
+// user who made the change, or nil when the system made it (e.g. a payment
+// webhook).
+type OrderStatusEvent struct {
+	ID         uint        `gorm:"primaryKey" json:"id"`
+	OrderID    uint        `gorm:"not null;index" json:"order_id"`
+	FromStatus OrderStatus `gorm:"type:varchar(20)" json:"from_status"`
+	ToStatus   OrderStatus `gorm:"type:varchar(20);not null" json:"to_status"`
+	ActorID    *uint       `json:"actor_id"`
+	Actor      *User       `gorm:"foreignKey:ActorID" json:"-"`
+	Reason     string      `json:"reason"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PaymentEvent records a processed payment provider webhook event, so that
+// redelivered events are applied only once
+type PaymentEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	EventID   string    `gorm:"uniqueIndex;not null" json:"event_id"`
+	Type      string    `gorm:"not null" json:"type"`
+	PaymentID string    `gorm:"index" json:"payment_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -9,13 +9,46 @@ import (
 type Product struct {
 	ID          uint           `gorm:"primaryKey" json:"id"`
 	Name        string         `gorm:"not null" json:"name"`
+	SKU         string         `gorm:"index:idx_products_sku,unique,where:sku <> ''" json:"sku"`
 	Description string         `json:"description"`
-	Price       float64        `gorm:"not null" json:"price"`
-	Category    string         `gorm:"not null" json:"category"`
-	Brand       string         `json:"brand"`
-	ImageURL    string         `json:"image_url"`
-	Stock       int            `gorm:"default:0" json:"stock"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	Price       Money          `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	Prices      []ProductPrice `gorm:"constraint:OnDelete:CASCADE" json:"prices"`
+	CategoryID  uint           `gorm:"not null;index" json:"category_id"`
+	Category    *Category      `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	// CategoryName copies the category's name for full-text search. The
+	// repositories keep it in sync.
+	CategoryName string `gorm:"column:category;not null" json:"category"`
+	Brand        string `json:"brand"`
+	// TaxClass picks the tax rate the product is charged at
+	TaxClass string `gorm:"size:50;not null;default:'standard'" json:"tax_class"`
+	// ImageURL is the main image: the first image of the gallery when the
+	// product has one, otherwise a URL hosted elsewhere
+	ImageURL string           `json:"image_url"`
+	Images   []ProductImage   `gorm:"constraint:OnDelete:CASCADE" json:"images"`
+	Variants []ProductVariant `gorm:"constraint:OnDelete:CASCADE" json:"variants"`
+	// Stock is the sum of the variants' stock for products with variants
+	Stock int `gorm:"default:0;check:chk_products_stock,stock >= 0" json:"stock"`
+	// Reserved is the part of Stock held for unpaid orders, likewise summed
+	// over the variants
+	Reserved  int `gorm:"not null;default:0;check:chk_products_reserved,reserved >= 0" json:"reserved"`
+	SoldCount int `gorm:"not null;default:0;index" json:"sold_count"` // units sold, for sorting by popularity
+	// ReorderThreshold raises a stock alert when the available stock falls
+	// to it; 0 turns alerts off
+	ReorderThreshold int `gorm:"not null;default:0;check:chk_products_reorder_threshold,reorder_threshold >= 0" json:"reorder_threshold"`
+	// Rating is the average rating of the approved reviews, 0 without any.
+	// The review repository keeps it and ReviewCount up to date.
+	Rating      float64 `gorm:"type:numeric(3,2);not null;default:0;index" json:"rating"`
+	ReviewCount int     `gorm:"not null;default:0" json:"review_count"`
+	// SearchVector indexes name, brand, category and description for
+	// full-text search. The database keeps it up to date.
+	SearchVector string         `gorm:"->:false;<-:false;type:tsvector GENERATED ALWAYS AS (setweight(to_tsvector('russian', coalesce(name, '')), 'A') || setweight(to_tsvector('russian', coalesce(brand, '') || ' ' || coalesce(category, '')), 'B') || setweight(to_tsvector('russian', coalesce(description, '')), 'C')) STORED;index:idx_products_search,type:gin" json:"-"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Available returns how much of the product can still be ordered: the
+// stock on hand less what is reserved for unpaid orders
+func (p *Product) Available() int {
+	return max(p.Stock-p.Reserved, 0)
 }
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PromotionType is the kind of discount a promotion gives
+type PromotionType string
+
+const (
+	// PromotionPercentage takes Percent off the qualifying items
+	PromotionPercentage PromotionType = "percentage"
+	// PromotionFixed takes Amount off the qualifying items
+	PromotionFixed PromotionType = "fixed"
+	// PromotionFreeShipping waives the shipping cost
+	PromotionFreeShipping PromotionType = "free_shipping"
+	// PromotionBuyXGetY makes GetQuantity of every BuyQuantity plus
+	// GetQuantity units of a qualifying product free
+	PromotionBuyXGetY PromotionType = "buy_x_get_y"
+)
+
+// Valid reports whether t is a known promotion type
+func (t PromotionType) Valid() bool {
+	switch t {
+	case PromotionPercentage, PromotionFixed, PromotionFreeShipping, PromotionBuyXGetY:
+		return true
+	}
+	return false
+}
+
+// Promotion is a discount the store gives. A promotion with a Code is a
+// coupon and only applies to carts the code was entered for; one without
+// applies by itself to every cart that meets its rules. Amounts are in the
+// base currency.
+type Promotion struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"not null" json:"name"`
+	// Code is kept in upper case; it is empty for automatic promotions
+	Code        string        `gorm:"size:50;index:idx_promotions_code,unique,where:code <> '' AND deleted_at IS NULL" json:"code"`
+	Type        PromotionType `gorm:"type:varchar(20);not null" json:"type"`
+	Percent     int           `gorm:"not null;default:0" json:"percent"`
+	Amount      Money         `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	BuyQuantity int           `gorm:"not null;default:0" json:"buy_quantity"`
+	GetQuantity int           `gorm:"not null;default:0" json:"get_quantity"`
+	// MinSubtotal is the smallest cart subtotal the promotion applies to
+	MinSubtotal Money `gorm:"embedded;embeddedPrefix:min_subtotal_" json:"min_subtotal"`
+	// CategoryID and Brand, when set, limit the promotion to products of
+	// the category, or any category under it, and of the brand
+	CategoryID *uint  `json:"category_id"`
+	Brand      string `json:"brand"`
+	// PerUserLimit and UsageLimit cap how many orders may use the
+	// promotion, per user and in all; 0 means no limit. UsageCount counts
+	// the orders using it that were not cancelled.
+	PerUserLimit int            `gorm:"not null;default:0" json:"per_user_limit"`
+	UsageLimit   int            `gorm:"not null;default:0" json:"usage_limit"`
+	UsageCount   int            `gorm:"not null;default:0" json:"usage_count"`
+	StartsAt     *time.Time     `json:"starts_at"`
+	EndsAt       *time.Time     `json:"ends_at"`
+	Active       bool           `gorm:"not null" json:"active"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// OrderDiscount is a discount line of an order: what a promotion took off
+// it, in the order currency. Code and Name are copied from the promotion so
+// the order keeps showing them after the promotion is changed or deleted.
+type OrderDiscount struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	OrderID     uint          `gorm:"not null;index" json:"order_id"`
+	PromotionID uint          `gorm:"not null;index" json:"promotion_id"`
+	Code        string        `json:"code"`
+	Name        string        `gorm:"not null" json:"name"`
+	Type        PromotionType `gorm:"type:varchar(20);not null" json:"type"`
+	Amount      Money         `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// ReservationStatus is the state of a stock reservation
+type ReservationStatus string
+
+const (
+	// ReservationStatusActive reservations hold stock for an unpaid order
+	ReservationStatusActive ReservationStatus = "active"
+	// ReservationStatusCommitted reservations were taken out of stock when
+	// the order was paid
+	ReservationStatusCommitted ReservationStatus = "committed"
+	// ReservationStatusReleased reservations gave their stock back when the
+	// order was cancelled or not paid in time
+	ReservationStatusReleased ReservationStatus = "released"
+)
+
+// StockReservation holds stock of a product, or of one of its variants, for
+// an order line until the order is paid or the reservation expires. Active
+// reservations are counted in the product's and variant's Reserved.
+type StockReservation struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	OrderID   uint              `gorm:"not null;index" json:"order_id"`
+	ProductID uint              `gorm:"not null;index" json:"product_id"`
+	VariantID *uint             `gorm:"index" json:"variant_id"`
+	Quantity  int               `gorm:"not null" json:"quantity"`
+	Status    ReservationStatus `gorm:"type:varchar(20);not null;default:'active'" json:"status"`
+	ExpiresAt time.Time         `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// ReviewStatus is the moderation state of a review
+type ReviewStatus string
+
+const (
+	// ReviewStatusPending reviews wait for a moderator and are not shown
+	ReviewStatusPending  ReviewStatus = "pending"
+	ReviewStatusApproved ReviewStatus = "approved"
+	ReviewStatusRejected ReviewStatus = "rejected"
+)
+
+// Valid reports whether s is a known review status
+func (s ReviewStatus) Valid() bool {
+	switch s {
+	case ReviewStatusPending, ReviewStatusApproved, ReviewStatusRejected:
+		return true
+	}
+	return false
+}
+
+// Review is a customer's rating of a product they bought. Only approved
+// reviews are shown and counted in the product's rating.
+type Review struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	ProductID uint         `gorm:"not null;uniqueIndex:idx_reviews_product_user" json:"product_id"`
+	Product   *Product     `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	UserID    uint         `gorm:"not null;uniqueIndex:idx_reviews_product_user;index" json:"user_id"`
+	User      *User        `json:"-"`
+	Rating    int          `gorm:"not null;check:chk_reviews_rating,rating BETWEEN 1 AND 5" json:"rating"`
+	Title     string       `json:"title"`
+	Body      string       `gorm:"type:text" json:"body"`
+	Status    ReviewStatus `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
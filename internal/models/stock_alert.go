@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// StockAlert tells the store's staff that a product's available stock fell
+// to its reorder threshold. A product has at most one open alert, which is
+// resolved once its stock is above the threshold again.
+type StockAlert struct {
+	ID        uint     `gorm:"primaryKey" json:"id"`
+	ProductID uint     `gorm:"not null;uniqueIndex:idx_stock_alerts_open,where:resolved_at IS NULL" json:"product_id"`
+	Product   *Product `json:"-"`
+	// Available and Threshold are the product's available stock and reorder
+	// threshold when the alert was raised
+	Available  int        `gorm:"not null" json:"available"`
+	Threshold  int        `gorm:"not null" json:"threshold"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `gorm:"index" json:"resolved_at"`
+}
+
+// StockSubscription asks for a customer to be told when an out-of-stock
+// product, or variant, is back in stock. NotifiedAt is set once they have
+// been. A user has at most one pending subscription to a product, or
+// variant; the unique index is created by
+// migrations/22_stock_subscriptions_unique.sql.
+type StockSubscription struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	ProductID  uint       `gorm:"not null;index" json:"product_id"`
+	Product    *Product   `json:"-"`
+	VariantID  *uint      `gorm:"index" json:"variant_id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	User       *User      `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	NotifiedAt *time.Time `gorm:"index" json:"notified_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// StockMovementReason says why stock changed
+type StockMovementReason string
+
+const (
+	// StockMovementSale takes the items of a paid order out of stock
+	StockMovementSale StockMovementReason = "sale"
+	// StockMovementRestock adds delivered goods to stock
+	StockMovementRestock StockMovementReason = "restock"
+	// StockMovementAdjustment corrects stock, e.g. after a physical count or
+	// an admin edit
+	StockMovementAdjustment StockMovementReason = "adjustment"
+	// StockMovementReturn puts items returned by a customer back in stock
+	StockMovementReturn StockMovementReason = "return"
+	// StockMovementCancellation puts the items of a cancelled paid order back
+	// in stock
+	StockMovementCancellation StockMovementReason = "cancellation"
+)
+
+// Valid reports whether r is a known stock movement reason
+func (r StockMovementReason) Valid() bool {
+	switch r {
+	case StockMovementSale, StockMovementRestock, StockMovementAdjustment, StockMovementReturn, StockMovementCancellation:
+		return true
+	}
+	return false
+}
+
+// StockMovement records one change of the stock of a product, or of one of
+// its variants. Quantity is the change, negative when stock went down, and
+// StockAfter the stock it left. ActorID is the user who made the change, or
+// nil when the system made it (e.g. a payment webhook).
+type StockMovement struct {
+	ID         uint                `gorm:"primaryKey" json:"id"`
+	ProductID  uint                `gorm:"not null;index" json:"product_id"`
+	VariantID  *uint               `gorm:"index" json:"variant_id"`
+	Quantity   int                 `gorm:"not null" json:"quantity"`
+	StockAfter int                 `gorm:"not null" json:"stock_after"`
+	Reason     StockMovementReason `gorm:"type:varchar(20);not null" json:"reason"`
+	// Reference identifies what caused the movement, e.g. "order:42" or a
+	// delivery note number
+	Reference string    `gorm:"size:100;index" json:"reference"`
+	Note      string    `json:"note"`
+	ActorID   *uint     `json:"actor_id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
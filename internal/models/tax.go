@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Tax classes with a meaning of their own. Any other class can be given to
+// products and rated per region.
+const (
+	// TaxClassStandard is the tax class of products not given another
+	TaxClassStandard = "standard"
+	// TaxClassShipping is the tax class of shipping costs
+	TaxClassShipping = "shipping"
+)
+
+// TaxRate is the tax charged on a tax class in a region: a country code
+// such as "DE", or a country code and subdivision such as "US-CA". The rate
+// for an empty region applies wherever no other rate does. Rate is a
+// percentage.
+type TaxRate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Region    string    `gorm:"size:10;not null;uniqueIndex:idx_tax_rates_region_class" json:"region"`
+	TaxClass  string    `gorm:"size:50;not null;uniqueIndex:idx_tax_rates_region_class" json:"tax_class"`
+	Rate      string    `gorm:"type:numeric(7,4);not null" json:"rate"`
+	Name      string    `json:"name"` // e.g. "VAT"
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
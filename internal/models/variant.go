@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductVariant is one purchasable version of a product, e.g. a shirt in
+// size M and colour red. A product with variants is sold by variant: each
+// variant has its own stock, and the product's Stock is the sum of them.
+type ProductVariant struct {
+	ID        uint              `gorm:"primaryKey" json:"id"`
+	ProductID uint              `gorm:"not null;index" json:"product_id"`
+	SKU       string            `gorm:"index:idx_product_variants_sku,unique,where:sku <> ''" json:"sku"`
+	Options   map[string]string `gorm:"serializer:json;type:jsonb;not null" json:"options"` // e.g. {"size": "M", "colour": "red"}
+	// PriceAmount overrides the product's base price, in minor units of the
+	// base currency. Nil means the variant costs the same as the product.
+	PriceAmount *int64         `json:"price_amount"`
+	Stock       int            `gorm:"default:0;check:chk_product_variants_stock,stock >= 0" json:"stock"`
+	Reserved    int            `gorm:"not null;default:0;check:chk_product_variants_reserved,reserved >= 0" json:"reserved"` // held for unpaid orders
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Price returns the variant's price in the base currency, given its product
+func (v *ProductVariant) Price(product *Product) Money {
+	if v.PriceAmount == nil {
+		return product.Price
+	}
+	return NewMoney(*v.PriceAmount, product.Price.Currency)
+}
+
+// Available returns how much of the variant can still be ordered
+func (v *ProductVariant) Available() int {
+	return max(v.Stock-v.Reserved, 0)
+}
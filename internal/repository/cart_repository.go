@@ -3,10 +3,19 @@ package repository
 import (
 	"errors"
 	"store/internal/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrCartNotFound is returned when a cart does not exist
+var ErrCartNotFound = errors.New("cart not found")
+
+// ErrCartItemNotFound is returned when a cart item does not exist in the
+// cart it was looked up in
+var ErrCartItemNotFound = errors.New("cart item not found")
+
 // CartRepository handles database operations for carts
 type CartRepository struct {
 	db *gorm.DB
@@ -22,11 +31,11 @@ func (r *CartRepository) GetOrCreateCart(userID uint) (*models.Cart, error) {
 	var cart models.Cart
 
 	// Try to get existing cart
-	err := r.db.Where("user_id = ?", userID).Preload("Items.Product").First(&cart).Error
+	err := r.db.Where("user_id = ?", userID).Scopes(withCartProducts).First(&cart).Error
 
 	// If not found, create a new one
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		cart = models.Cart{UserID: userID}
+		cart = models.Cart{UserID: &userID}
 		err = r.db.Create(&cart).Error
 		if err != nil {
 			return nil, err
@@ -41,16 +50,127 @@ func (r *CartRepository) GetOrCreateCart(userID uint) (*models.Cart, error) {
 	return &cart, nil
 }
 
-// AddToCart adds a product to the cart
-func (r *CartRepository) AddToCart(cartID, productID uint, quantity int) error {
+// withCartProducts preloads the products and variants of a cart's items,
+// including ones that have since been deleted, so that the cart can say
+// they are no longer available
+func withCartProducts(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items.Product", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Items.Product.Prices").Preload("Items.Variant", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	})
+}
+
+// GetCartForUpdate retrieves a user's cart with its items and locks the cart
+// row until the surrounding transaction ends
+func (r *CartRepository) GetCartForUpdate(userID uint) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ?", userID).
+		Preload("Items").
+		First(&cart).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCartNotFound
+		}
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// GetGuestCart retrieves the guest cart with the given token
+func (r *CartRepository) GetGuestCart(token string) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.db.Where("guest_token = ? AND user_id IS NULL", token).
+		Scopes(withCartProducts).
+		First(&cart).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCartNotFound
+		}
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// GetGuestCartForUpdate retrieves the guest cart with the given token and
+// its items and locks the cart row until the surrounding transaction ends
+func (r *CartRepository) GetGuestCartForUpdate(token string) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("guest_token = ? AND user_id IS NULL", token).
+		Preload("Items").
+		First(&cart).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCartNotFound
+		}
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// CreateGuestCart creates an empty guest cart with the given token
+func (r *CartRepository) CreateGuestCart(token string) (*models.Cart, error) {
+	cart := models.Cart{GuestToken: token}
+	if err := r.db.Create(&cart).Error; err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// DeleteCart deletes a cart and its items for good
+func (r *CartRepository) DeleteCart(cartID uint) error {
+	if err := r.db.Unscoped().Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error; err != nil {
+		return err
+	}
+	return r.db.Unscoped().Delete(&models.Cart{}, cartID).Error
+}
+
+// DeleteIdleGuestCarts deletes for good up to limit guest carts that have
+// not changed since before, with their items, and returns how many it
+// deleted
+func (r *CartRepository) DeleteIdleGuestCarts(before time.Time, limit int) (int64, error) {
+	var ids []uint
+	err := r.db.Unscoped().Model(&models.Cart{}).
+		Where("guest_token <> '' AND user_id IS NULL AND updated_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM cart_items i WHERE i.cart_id = carts.id AND i.updated_at >= ?)", before).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	var deleted int64
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("cart_id IN ?", ids).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Delete(&models.Cart{}, ids)
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// AddToCart adds a product, or one of its variants, to the cart at the
+// given price. An item already in the cart keeps the price it was added at,
+// so a price change still has to be accepted.
+func (r *CartRepository) AddToCart(cartID, productID uint, variantID *uint, quantity int, price models.Money) error {
 	// Check if item already exists in cart
 	var item models.CartItem
-	err := r.db.Where("cart_id = ? AND product_id = ?", cartID, productID).First(&item).Error
+	query := r.db.Where("cart_id = ? AND product_id = ?", cartID, productID)
+	if variantID != nil {
+		query = query.Where("variant_id = ?", *variantID)
+	} else {
+		query = query.Where("variant_id IS NULL")
+	}
+	err := query.First(&item).Error
 
 	// If item already exists, update quantity
 	if err == nil {
-		item.Quantity += quantity
-		return r.db.Save(&item).Error
+		return r.db.Model(&item).Update("quantity", item.Quantity+quantity).Error
 	}
 
 	// If not found, create new item
@@ -58,7 +178,9 @@ func (r *CartRepository) AddToCart(cartID, productID uint, quantity int) error {
 		item = models.CartItem{
 			CartID:    cartID,
 			ProductID: productID,
+			VariantID: variantID,
 			Quantity:  quantity,
+			Price:     price,
 		}
 		return r.db.Create(&item).Error
 	}
@@ -66,17 +188,69 @@ func (r *CartRepository) AddToCart(cartID, productID uint, quantity int) error {
 	return err
 }
 
+// GetCartItem retrieves an item of a cart. Items of other carts are not
+// found.
+func (r *CartRepository) GetCartItem(cartID, itemID uint) (*models.CartItem, error) {
+	var item models.CartItem
+	err := r.db.Where("cart_id = ? AND id = ?", cartID, itemID).First(&item).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCartItemNotFound
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
 // UpdateCartItem updates the quantity of an item in the cart
-func (r *CartRepository) UpdateCartItem(itemID uint, quantity int) error {
-	return r.db.Model(&models.CartItem{}).Where("id = ?", itemID).Update("quantity", quantity).Error
+func (r *CartRepository) UpdateCartItem(cartID, itemID uint, quantity int) error {
+	result := r.db.Model(&models.CartItem{}).
+		Where("id = ? AND cart_id = ?", itemID, cartID).
+		Update("quantity", quantity)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCartItemNotFound
+	}
+	return nil
+}
+
+// UpdateCartItemPrice updates the price an item of the cart was added at
+func (r *CartRepository) UpdateCartItemPrice(cartID, itemID uint, price models.Money) error {
+	result := r.db.Model(&models.CartItem{}).
+		Where("id = ? AND cart_id = ?", itemID, cartID).
+		Updates(map[string]interface{}{"price_amount": price.Amount, "price_currency": price.Currency})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCartItemNotFound
+	}
+	return nil
 }
 
 // RemoveFromCart removes an item from the cart
-func (r *CartRepository) RemoveFromCart(itemID uint) error {
-	return r.db.Delete(&models.CartItem{}, itemID).Error
+func (r *CartRepository) RemoveFromCart(cartID, itemID uint) error {
+	result := r.db.Where("cart_id = ?", cartID).Delete(&models.CartItem{}, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCartItemNotFound
+	}
+	return nil
 }
 
-// ClearCart removes all items from a cart
+// SetCouponCode sets the coupon code of a cart; an empty code removes it
+func (r *CartRepository) SetCouponCode(cartID uint, code string) error {
+	return r.db.Model(&models.Cart{}).Where("id = ?", cartID).Update("coupon_code", code).Error
+}
+
+// ClearCart removes all items and the coupon code from a cart
 func (r *CartRepository) ClearCart(cartID uint) error {
-	return r.db.Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error
+	if err := r.db.Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error; err != nil {
+		return err
+	}
+	return r.SetCouponCode(cartID, "")
 }
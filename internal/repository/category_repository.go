@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"errors"
+	"store/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrCategoryNotFound is returned when a category does not exist
+var ErrCategoryNotFound = errors.New("category not found")
+
+// categoryTreeQuery selects the IDs of the category with the given slug and
+// of all categories nested under it
+const categoryTreeQuery = `WITH RECURSIVE tree AS (
+	SELECT id FROM categories WHERE slug = ?
+	UNION ALL
+	SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+) SELECT id FROM tree`
+
+// CategoryRepository handles database operations for categories
+type CategoryRepository struct {
+	db *gorm.DB
+}
+
+// NewCategoryRepository creates a new CategoryRepository
+func NewCategoryRepository(database *Database) *CategoryRepository {
+	return &CategoryRepository{db: database.DB}
+}
+
+// CreateCategory adds a new category to the database
+func (r *CategoryRepository) CreateCategory(category *models.Category) error {
+	return r.db.Create(category).Error
+}
+
+// GetCategories retrieves all categories in display order
+func (r *CategoryRepository) GetCategories() ([]models.Category, error) {
+	var categories []models.Category
+	err := r.db.Order("sort_order").Order("name").Find(&categories).Error
+	return categories, err
+}
+
+// GetCategoryByID retrieves a category by ID
+func (r *CategoryRepository) GetCategoryByID(id uint) (*models.Category, error) {
+	var category models.Category
+	err := r.db.First(&category, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetCategoryBySlug retrieves a category by slug
+func (r *CategoryRepository) GetCategoryBySlug(slug string) (*models.Category, error) {
+	var category models.Category
+	err := r.db.Where("slug = ?", slug).First(&category).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetDescendantIDs retrieves the IDs of all categories nested under a
+// category, at any depth
+func (r *CategoryRepository) GetDescendantIDs(id uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Raw(`WITH RECURSIVE tree AS (
+	SELECT id FROM categories WHERE parent_id = ?
+	UNION ALL
+	SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id
+) SELECT id FROM tree`, id).Scan(&ids).Error
+	return ids, err
+}
+
+// UpdateCategory updates an existing category and copies its name to the
+// products in it
+func (r *CategoryRepository) UpdateCategory(category *models.Category) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Parent", "Children").Save(category).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&models.Product{}).
+			Where("category_id = ?", category.ID).
+			Update("category", category.Name).Error
+	})
+}
+
+// CountChildren counts the direct subcategories of a category
+func (r *CategoryRepository) CountChildren(id uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Category{}).Where("parent_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// CountProducts counts the products in a category, including soft-deleted
+// ones, which still reference it
+func (r *CategoryRepository) CountProducts(id uint) (int64, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&models.Product{}).Where("category_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+// DeleteCategory deletes a category by ID
+func (r *CategoryRepository) DeleteCategory(id uint) error {
+	return r.db.Delete(&models.Category{}, id).Error
+}
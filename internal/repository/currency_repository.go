@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"errors"
+	"store/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CurrencyRepository handles database operations for exchange rates
+type CurrencyRepository struct {
+	db *gorm.DB
+}
+
+// NewCurrencyRepository creates a new CurrencyRepository
+func NewCurrencyRepository(database *Database) *CurrencyRepository {
+	return &CurrencyRepository{db: database.DB}
+}
+
+// GetRates retrieves all exchange rates
+func (r *CurrencyRepository) GetRates() ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := r.db.Order("currency").Find(&rates).Error
+	return rates, err
+}
+
+// GetRate retrieves the exchange rate of a currency
+func (r *CurrencyRepository) GetRate(currency string) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := r.db.Where("currency = ?", currency).First(&rate).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("exchange rate not found")
+		}
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// SaveRates inserts or updates exchange rates
+func (r *CurrencyRepository) SaveRates(rates []models.ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&rates).Error
+}
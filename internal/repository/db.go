@@ -1,11 +1,13 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"store/config"
 	"store/internal/models"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -21,7 +23,11 @@ func NewDatabase(cfg *config.Config) (*Database, error) {
 		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPassword, cfg.DBName,
 	)
+	return OpenDatabase(dsn)
+}
 
+// OpenDatabase connects to the database at dsn and migrates its schema
+func OpenDatabase(dsn string) (*Database, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
@@ -30,11 +36,27 @@ func NewDatabase(cfg *config.Config) (*Database, error) {
 	// Auto migrate the schema
 	err = db.AutoMigrate(
 		&models.User{},
+		&models.Category{},
 		&models.Product{},
+		&models.ProductPrice{},
+		&models.ProductVariant{},
+		&models.ProductImage{},
+		&models.ExchangeRate{},
 		&models.Cart{},
 		&models.CartItem{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderDiscount{},
+		&models.Promotion{},
+		&models.TaxRate{},
+		&models.OrderStatusEvent{},
+		&models.PaymentEvent{},
+		&models.Review{},
+		&models.StockReservation{},
+		&models.StockMovement{},
+		&models.StockAlert{},
+		&models.StockSubscription{},
+		&models.Notification{},
 	)
 
 	if err != nil {
@@ -44,3 +66,19 @@ func NewDatabase(cfg *config.Config) (*Database, error) {
 	log.Println("Connected to database successfully")
 	return &Database{DB: db}, nil
 }
+
+// Transaction runs fn inside a database transaction. Repositories created
+// from the Database passed to fn share the transaction; it is committed when
+// fn returns nil and rolled back otherwise.
+func (d *Database) Transaction(fn func(tx *Database) error) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		return fn(&Database{DB: tx})
+	})
+}
+
+// isUniqueViolation reports whether err is a Postgres unique constraint
+// violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
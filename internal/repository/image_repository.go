@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"errors"
+	"store/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrImageNotFound is returned when a product image does not exist
+var ErrImageNotFound = errors.New("product image not found")
+
+// ImageRepository handles database operations for product images
+type ImageRepository struct {
+	db *gorm.DB
+}
+
+// NewImageRepository creates a new ImageRepository
+func NewImageRepository(database *Database) *ImageRepository {
+	return &ImageRepository{db: database.DB}
+}
+
+// orderByPosition orders product images as they are shown in the gallery
+func orderByPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position").Order("id")
+}
+
+// GetImages retrieves the images of a product in gallery order
+func (r *ImageRepository) GetImages(productID uint) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	err := orderByPosition(r.db).Where("product_id = ?", productID).Find(&images).Error
+	return images, err
+}
+
+// GetImageByID retrieves an image of a product
+func (r *ImageRepository) GetImageByID(productID, imageID uint) (*models.ProductImage, error) {
+	var image models.ProductImage
+	err := r.db.Where("product_id = ?", productID).First(&image, imageID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImageNotFound
+		}
+		return nil, err
+	}
+	return &image, nil
+}
+
+// CreateImage adds an image to the end of its product's gallery and makes
+// the gallery's first image the product's main image
+func (r *ImageRepository) CreateImage(image *models.ProductImage) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var position int
+		err := tx.Model(&models.ProductImage{}).
+			Where("product_id = ?", image.ProductID).
+			Select("COALESCE(MAX(position) + 1, 0)").
+			Scan(&position).Error
+		if err != nil {
+			return err
+		}
+		image.Position = position
+
+		if err := tx.Create(image).Error; err != nil {
+			return err
+		}
+		return syncImageURL(tx, image.ProductID)
+	})
+}
+
+// ReorderImages sets the gallery order of a product's images to the order
+// of ids
+func (r *ImageRepository) ReorderImages(productID uint, ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for position, id := range ids {
+			err := tx.Model(&models.ProductImage{}).
+				Where("id = ? AND product_id = ?", id, productID).
+				Update("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		return syncImageURL(tx, productID)
+	})
+}
+
+// DeleteImage deletes an image of a product
+func (r *ImageRepository) DeleteImage(productID, imageID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var image models.ProductImage
+		if err := tx.Where("product_id = ?", productID).First(&image, imageID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrImageNotFound
+			}
+			return err
+		}
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+
+		// The product no longer shows the deleted image, even when it was
+		// the last one
+		err := tx.Unscoped().Model(&models.Product{}).
+			Where("id = ? AND image_url = ?", productID, image.URLs[models.ImageLarge]).
+			Update("image_url", "").Error
+		if err != nil {
+			return err
+		}
+		return syncImageURL(tx, productID)
+	})
+}
+
+// syncImageURL sets a product's main image to the large version of the
+// first image in its gallery, if it has any
+func syncImageURL(tx *gorm.DB, productID uint) error {
+	var first models.ProductImage
+	err := orderByPosition(tx).Where("product_id = ?", productID).Limit(1).Find(&first).Error
+	if err != nil || first.ID == 0 {
+		return err
+	}
+	return tx.Unscoped().Model(&models.Product{}).
+		Where("id = ?", productID).
+		Update("image_url", first.URLs[models.ImageLarge]).Error
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"store/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// NotificationRepository handles database operations for the notification
+// outbox
+type NotificationRepository struct {
+	db *gorm.DB
+}
+
+// NewNotificationRepository creates a new NotificationRepository
+func NewNotificationRepository(database *Database) *NotificationRepository {
+	return &NotificationRepository{db: database.DB}
+}
+
+// CreateNotification adds a notification to the outbox
+func (r *NotificationRepository) CreateNotification(notification *models.Notification) error {
+	return r.db.Create(notification).Error
+}
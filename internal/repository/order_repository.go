@@ -5,8 +5,12 @@ import (
 	"store/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrOrderNotFound is returned when an order does not exist
+var ErrOrderNotFound = errors.New("order not found")
+
 // OrderRepository handles database operations for orders
 type OrderRepository struct {
 	db *gorm.DB
@@ -17,18 +21,75 @@ func NewOrderRepository(database *Database) *OrderRepository {
 	return &OrderRepository{db: database.DB}
 }
 
-// CreateOrder creates a new order
+// CreateOrder saves a new order together with its items and discount lines
 func (r *OrderRepository) CreateOrder(order *models.Order) error {
-	return r.db.Create(order).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(order).Error; err != nil {
+			return err
+		}
+		if len(order.Items) == 0 {
+			return nil
+		}
+
+		for i := range order.Items {
+			order.Items[i].OrderID = order.ID
+		}
+		if err := tx.Omit(clause.Associations).Create(&order.Items).Error; err != nil {
+			return err
+		}
+		if len(order.Discounts) == 0 {
+			return nil
+		}
+
+		for i := range order.Discounts {
+			order.Discounts[i].OrderID = order.ID
+		}
+		return tx.Create(&order.Discounts).Error
+	})
+}
+
+// preloadItems loads order items with their products, including products
+// that have since been soft-deleted, and the order's discount lines
+func preloadItems(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items").Preload("Items.Product", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped()
+	}).Preload("Discounts")
 }
 
 // GetOrderByID retrieves an order by ID
 func (r *OrderRepository) GetOrderByID(id uint) (*models.Order, error) {
 	var order models.Order
-	err := r.db.Preload("Items.Product").First(&order, id).Error
+	err := preloadItems(r.db).First(&order, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("order not found")
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrderForUpdate retrieves an order with its items and locks the order
+// row until the surrounding transaction ends
+func (r *OrderRepository) GetOrderForUpdate(id uint) (*models.Order, error) {
+	var order models.Order
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Items").First(&order, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrderByPaymentID retrieves an order by the ID of its payment
+func (r *OrderRepository) GetOrderByPaymentID(paymentID string) (*models.Order, error) {
+	var order models.Order
+	err := r.db.Where("payment_id = ?", paymentID).First(&order).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrderNotFound
 		}
 		return nil, err
 	}
@@ -38,13 +99,65 @@ func (r *OrderRepository) GetOrderByID(id uint) (*models.Order, error) {
 // GetUserOrders retrieves all orders for a user
 func (r *OrderRepository) GetUserOrders(userID uint) ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Where("user_id = ?", userID).Preload("Items.Product").Find(&orders).Error
+	err := preloadItems(r.db).Where("user_id = ?", userID).Find(&orders).Error
 	return orders, err
 }
 
-// UpdateOrderStatus updates the status of an order
-func (r *OrderRepository) UpdateOrderStatus(orderID uint, status models.OrderStatus) error {
-	return r.db.Model(&models.Order{}).Where("id = ?", orderID).Update("status", status).Error
+// UpdateOrderStatus updates the status of an order and records the change
+// in the order's status history
+func (r *OrderRepository) UpdateOrderStatus(orderID uint, from, to models.OrderStatus, actorID *uint, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Order{}).Where("id = ?", orderID).Update("status", to).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OrderStatusEvent{
+			OrderID:    orderID,
+			FromStatus: from,
+			ToStatus:   to,
+			ActorID:    actorID,
+			Reason:     reason,
+		}).Error
+	})
+}
+
+// AddStatusEvent records a status history entry without changing the order,
+// e.g. the initial status of a new order
+func (r *OrderRepository) AddStatusEvent(event *models.OrderStatusEvent) error {
+	return r.db.Create(event).Error
+}
+
+// GetStatusHistory retrieves the status changes of an order, oldest first
+func (r *OrderRepository) GetStatusHistory(orderID uint) ([]models.OrderStatusEvent, error) {
+	var events []models.OrderStatusEvent
+	err := r.db.Where("order_id = ?", orderID).Order("created_at, id").Find(&events).Error
+	return events, err
+}
+
+// MarkRefundDue flags an order as waiting for its refund to be requested
+func (r *OrderRepository) MarkRefundDue(orderID uint) error {
+	return r.db.Model(&models.Order{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+		"refund_due":   true,
+		"refund_error": "",
+	}).Error
+}
+
+// UpdateRefundState records the outcome of a refund request: whether the
+// refund is still due and, if so, why the request failed
+func (r *OrderRepository) UpdateRefundState(orderID uint, due bool, refundErr string) error {
+	return r.db.Model(&models.Order{}).Where("id = ?", orderID).Updates(map[string]interface{}{
+		"refund_due":   due,
+		"refund_error": refundErr,
+	}).Error
+}
+
+// GetRefundDueOrderIDs retrieves the IDs of up to limit orders waiting for
+// their refund to be requested, oldest first
+func (r *OrderRepository) GetRefundDueOrderIDs(limit int) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.Order{}).Where("refund_due").Order("id").Limit(limit).Pluck("id", &ids).Error
+	return ids, err
 }
 
 // UpdatePaymentInfo updates the payment information of an order
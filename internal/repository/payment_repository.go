@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"store/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentRepository handles database operations for payment events
+type PaymentRepository struct {
+	db *gorm.DB
+}
+
+// NewPaymentRepository creates a new PaymentRepository
+func NewPaymentRepository(database *Database) *PaymentRepository {
+	return &PaymentRepository{db: database.DB}
+}
+
+// RecordEvent stores a webhook event. It reports false without error if an
+// event with the same event ID was already recorded.
+func (r *PaymentRepository) RecordEvent(event *models.PaymentEvent) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "event_id"}},
+		DoNothing: true,
+	}).Create(event)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"store/internal/models"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a pagination cursor that cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// productSearchConfig is the text search configuration products are
+// indexed with. PostgreSQL's russian configuration stems Cyrillic words as
+// Russian and Latin words as English, which covers our catalog.
+const productSearchConfig = "russian"
+
+// productSearchQuery parses a search string written by a shopper (words,
+// "quoted phrases", -excluded words) into a text search query
+const productSearchQuery = "websearch_to_tsquery('" + productSearchConfig + "', ?)"
+
+// ProductFilter holds the optional filters for listing products
+type ProductFilter struct {
+	Search   string // full-text search over name, description, brand and category
+	Category string // category slug; products in its subcategories match too
+	Brand    string
+	MinPrice int64 // in minor units, 0 for no minimum
+	MaxPrice int64 // in minor units, 0 for no maximum
+	InStock  *bool // nil for products with and without stock
+	// MinRating keeps products rated at least this much, 0 for all
+	MinRating float64
+}
+
+// ProductSort is an order in which products can be listed
+type ProductSort string
+
+// Product sort orders
+const (
+	ProductSortNewest     ProductSort = "newest"
+	ProductSortPriceAsc   ProductSort = "price_asc"
+	ProductSortPriceDesc  ProductSort = "price_desc"
+	ProductSortNameAsc    ProductSort = "name_asc"
+	ProductSortNameDesc   ProductSort = "name_desc"
+	ProductSortPopularity ProductSort = "popularity"
+	ProductSortRating     ProductSort = "rating"
+	// ProductSortRelevance ranks products by how well they match the search
+	ProductSortRelevance ProductSort = "relevance"
+)
+
+// ProductPage selects a page of products. With a Cursor, the page starts
+// right after the product the cursor was issued for (keyset pagination) and
+// Page is ignored; otherwise Page is used as an offset.
+type ProductPage struct {
+	Sort   ProductSort
+	Page   int
+	Limit  int
+	Cursor string
+}
+
+// ProductList is a page of products
+type ProductList struct {
+	Products []models.Product
+	// Total is the number of matching products on all pages
+	Total int64
+	// NextCursor continues the list after this page; empty on the last page
+	NextCursor string
+	// Highlights holds search snippets by product ID when searching
+	Highlights map[uint]ProductHighlight
+}
+
+// ProductHighlight shows where a product matched a search. Matching words
+// in Name and Description are wrapped in <b></b>.
+type ProductHighlight struct {
+	Rank        float64
+	Name        string
+	Description string
+}
+
+// ProductFacets summarises the products matching a filter, for narrowing
+// it down further. Each facet is counted with every filter applied except
+// its own, so that it shows the choices still available.
+type ProductFacets struct {
+	Categories []FacetCount
+	Brands     []FacetCount
+	Prices     []PriceBucket
+	InStock    int64
+	OutOfStock int64
+}
+
+// FacetCount is the number of products with a facet value. Value is what
+// to filter by and Label what to show, e.g. a category's slug and name.
+type FacetCount struct {
+	Value string
+	Label string
+	Count int64
+}
+
+// PriceBucket is the number of products priced from Min up to, but not
+// including, Max, in minor units of the base currency
+type PriceBucket struct {
+	Min   int64
+	Max   int64
+	Count int64
+}
+
+// productSortKey describes how products are ordered for a ProductSort.
+// Ties are broken by product ID in the same direction.
+type productSortKey struct {
+	expr string
+	desc bool
+	// search is set when expr takes the search string as its argument
+	search bool
+	// cursor captures a product's sort value, given its search rank
+	cursor func(*models.Product, float64) productCursor
+	// arg returns the sort value of a cursor as a query argument
+	arg func(productCursor) interface{}
+}
+
+var productSortKeys = map[ProductSort]productSortKey{
+	ProductSortNewest: {
+		expr:   "created_at",
+		desc:   true,
+		cursor: func(p *models.Product, _ float64) productCursor { return productCursor{Time: p.CreatedAt} },
+		arg:    func(c productCursor) interface{} { return c.Time },
+	},
+	ProductSortPriceAsc: {
+		expr:   "price_amount",
+		cursor: func(p *models.Product, _ float64) productCursor { return productCursor{Int: p.Price.Amount} },
+		arg:    func(c productCursor) interface{} { return c.Int },
+	},
+	ProductSortPriceDesc: {
+		expr:   "price_amount",
+		desc:   true,
+		cursor: func(p *models.Product, _ float64) productCursor { return productCursor{Int: p.Price.Amount} },
+		arg:    func(c productCursor) interface{} { return c.Int },
+	},
+	ProductSortNameAsc: {
+		expr:   "name",
+		cursor: func(p *models.Product, _ float64) productCursor { return productCursor{String: p.Name} },
+		arg:    func(c productCursor) interface{} { return c.String },
+	},
+	ProductSortNameDesc: {
+		expr:   "name",
+		desc:   true,
+		cursor: func(p *models.Product, _ float64) productCursor { return productCursor{String: p.Name} },
+		arg:    func(c productCursor) interface{} { return c.String },
+	},
+	ProductSortPopularity: {
+		expr:   "sold_count",
+		desc:   true,
+		cursor: func(p *models.Product, _ float64) productCursor { return productCursor{Int: int64(p.SoldCount)} },
+		arg:    func(c productCursor) interface{} { return c.Int },
+	},
+	ProductSortRating: {
+		expr:   "rating",
+		desc:   true,
+		cursor: func(p *models.Product, _ float64) productCursor { return productCursor{Float: p.Rating} },
+		arg:    func(c productCursor) interface{} { return c.Float },
+	},
+	ProductSortRelevance: {
+		expr:   "ts_rank(search_vector, " + productSearchQuery + ")",
+		desc:   true,
+		search: true,
+		cursor: func(_ *models.Product, rank float64) productCursor { return productCursor{Float: rank} },
+		arg:    func(c productCursor) interface{} { return c.Float },
+	},
+}
+
+// ValidProductSort reports whether sort is a known sort order
+func ValidProductSort(sort ProductSort) bool {
+	_, ok := productSortKeys[sort]
+	return ok
+}
+
+// productCursor is the position of a product in a sorted list. Only the
+// field matching the sort order is set.
+type productCursor struct {
+	Time   time.Time `json:"t,omitempty"`
+	Int    int64     `json:"n,omitempty"`
+	Float  float64   `json:"f,omitempty"`
+	String string    `json:"s,omitempty"`
+	ID     uint      `json:"id"`
+}
+
+// encode returns the cursor as an opaque URL-safe string
+func (c productCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeProductCursor parses a cursor produced by encode
+func decodeProductCursor(value string) (productCursor, error) {
+	var cursor productCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -2,9 +2,23 @@ package repository
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"store/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrProductNotFound is returned when a product does not exist
+	ErrProductNotFound = errors.New("product not found")
+	// ErrInsufficientStock is returned when a stock decrement would take a
+	// product below zero
+	ErrInsufficientStock = errors.New("not enough stock available")
+	// ErrStockBelowReserved is returned when stock would be set below the
+	// quantity reserved for unpaid orders
+	ErrStockBelowReserved = errors.New("stock is below the reserved quantity")
 )
 
 // ProductRepository handles database operations for products
@@ -17,57 +31,686 @@ func NewProductRepository(database *Database) *ProductRepository {
 	return &ProductRepository{db: database.DB}
 }
 
-// CreateProduct adds a new product to the database
-func (r *ProductRepository) CreateProduct(product *models.Product) error {
-	return r.db.Create(product).Error
+// CreateProduct adds a new product to the database and records its
+// initial stock in the stock ledger as an adjustment by actorID
+func (r *ProductRepository) CreateProduct(product *models.Product, actorID *uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createProduct(tx, product, actorID, "initial stock")
+	})
+}
+
+// createProduct adds a new product and records its initial stock within a
+// transaction
+func createProduct(tx *gorm.DB, product *models.Product, actorID *uint, note string) error {
+	if err := tx.Create(product).Error; err != nil {
+		return err
+	}
+	return recordStockEdit(tx, product.ID, nil, 0, product.Stock, actorID, note)
 }
 
 // GetProductByID retrieves a product by ID
 func (r *ProductRepository) GetProductByID(id uint) (*models.Product, error) {
 	var product models.Product
-	err := r.db.First(&product, id).Error
+	err := r.db.Preload("Prices").Preload("Images", orderByPosition).Preload("Variants", orderByID).First(&product, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("product not found")
+			return nil, ErrProductNotFound
 		}
 		return nil, err
 	}
 	return &product, nil
 }
 
-// GetProducts retrieves products with optional filters
-func (r *ProductRepository) GetProducts(category, brand string, minPrice, maxPrice float64) ([]models.Product, error) {
+// GetProductsForUpdate retrieves products by ID and locks their rows until
+// the surrounding transaction ends. Rows are locked in ID order so concurrent
+// checkouts touching the same products cannot deadlock.
+func (r *ProductRepository) GetProductsForUpdate(ids []uint) ([]models.Product, error) {
 	var products []models.Product
-	query := r.db
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Prices").
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&products).Error
+	return products, err
+}
+
+// ReserveStock holds quantity of a product's stock for an unpaid order.
+// The update only applies while that much stock is still available, i.e.
+// not already reserved, so stock is never promised twice even without a
+// prior row lock.
+func (r *ProductRepository) ReserveStock(id uint, quantity int) error {
+	result := r.db.Model(&models.Product{}).
+		Where("id = ? AND stock - reserved >= ?", id, quantity).
+		Update("reserved", gorm.Expr("reserved + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// ReleaseStock gives back stock reserved for an order that was not paid.
+// Soft-deleted products are released too.
+func (r *ProductRepository) ReleaseStock(id uint, quantity int) error {
+	return r.db.Unscoped().Model(&models.Product{}).
+		Where("id = ?", id).
+		Update("reserved", gorm.Expr("GREATEST(reserved - ?, 0)", quantity)).Error
+}
 
-	// Apply filters if provided
-	if category != "" {
-		query = query.Where("category = ?", category)
+// DecrementStock takes quantity sold out of a product's stock and out of
+// what is reserved for it, and adds it to the product's sold count. The
+// update only applies while enough stock remains, so stock never goes
+// negative. Soft-deleted products are sold too, as they were reserved
+// before they were deleted.
+func (r *ProductRepository) DecrementStock(id uint, quantity int) error {
+	result := r.db.Unscoped().Model(&models.Product{}).
+		Where("id = ? AND stock >= ?", id, quantity).
+		Updates(map[string]interface{}{
+			"stock":      gorm.Expr("stock - ?", quantity),
+			"reserved":   gorm.Expr("GREATEST(reserved - ?, 0)", quantity),
+			"sold_count": gorm.Expr("sold_count + ?", quantity),
+		})
+	if result.Error != nil {
+		return result.Error
 	}
-	if brand != "" {
-		query = query.Where("brand = ?", brand)
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
 	}
-	if minPrice > 0 {
-		query = query.Where("price >= ?", minPrice)
+	return nil
+}
+
+// IncrementStock puts quantity back in a product's stock and takes it off
+// the product's sold count, e.g. when a cancelled order is restocked.
+// Soft-deleted products are restocked too.
+func (r *ProductRepository) IncrementStock(id uint, quantity int) error {
+	return r.db.Unscoped().Model(&models.Product{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"stock":      gorm.Expr("stock + ?", quantity),
+			"sold_count": gorm.Expr("GREATEST(sold_count - ?, 0)", quantity),
+		}).Error
+}
+
+// GetProducts retrieves a page of products matching filter, along with
+// the number of matching products on all pages. When filter.Search is set,
+// the list also carries highlighted snippets of the products on the page.
+func (r *ProductRepository) GetProducts(filter ProductFilter, page ProductPage) (*ProductList, error) {
+	key, ok := productSortKeys[page.Sort]
+	if !ok {
+		key = productSortKeys[ProductSortNewest]
 	}
-	if maxPrice > 0 {
-		query = query.Where("price <= ?", maxPrice)
+	var sortVars []interface{}
+	if key.search {
+		sortVars = append(sortVars, filter.Search)
 	}
 
-	err := query.Find(&products).Error
-	return products, err
+	list := &ProductList{}
+	if err := applyProductFilter(r.db.Model(&models.Product{}), filter).Count(&list.Total).Error; err != nil {
+		return nil, err
+	}
+
+	query := applyProductFilter(r.db.Preload("Prices").Preload("Images", orderByPosition).Preload("Variants", orderByID), filter)
+	if page.Cursor != "" {
+		cursor, err := decodeProductCursor(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		op := ">"
+		if key.desc {
+			op = "<"
+		}
+		vars := append(sortVars, key.arg(cursor), cursor.ID)
+		query = query.Where("("+key.expr+", id) "+op+" (?, ?)", vars...)
+	} else if page.Page > 1 {
+		query = query.Offset((page.Page - 1) * page.Limit)
+	}
+
+	direction := " ASC"
+	if key.desc {
+		direction = " DESC"
+	}
+	order := clause.Expr{
+		SQL:                key.expr + direction + ", id" + direction,
+		Vars:               sortVars,
+		WithoutParentheses: true,
+	}
+
+	// Load one extra row to find out whether there is a next page
+	err := query.Clauses(clause.OrderBy{Expression: order}).
+		Limit(page.Limit + 1).
+		Find(&list.Products).Error
+	if err != nil {
+		return nil, err
+	}
+	hasMore := len(list.Products) > page.Limit
+	if hasMore {
+		list.Products = list.Products[:page.Limit]
+	}
+
+	if filter.Search != "" && len(list.Products) > 0 {
+		if list.Highlights, err = r.searchHighlights(list.Products, filter.Search); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasMore {
+		last := &list.Products[len(list.Products)-1]
+		cursor := key.cursor(last, list.Highlights[last.ID].Rank)
+		cursor.ID = last.ID
+		list.NextCursor = cursor.encode()
+	}
+
+	return list, nil
+}
+
+// searchHighlights ranks products against a search query and highlights
+// the matching words in their name and description, keyed by product ID
+func (r *ProductRepository) searchHighlights(products []models.Product, search string) (map[uint]ProductHighlight, error) {
+	ids := make([]uint, 0, len(products))
+	for _, product := range products {
+		ids = append(ids, product.ID)
+	}
+
+	var rows []struct {
+		ID uint
+		ProductHighlight
+	}
+	err := r.db.Table("products, "+productSearchQuery+" AS query", search).
+		Select("products.id, "+
+			"ts_rank(products.search_vector, query) AS rank, "+
+			"ts_headline('"+productSearchConfig+"', products.name, query, 'HighlightAll=true') AS name, "+
+			"ts_headline('"+productSearchConfig+"', coalesce(products.description, ''), query, 'MaxFragments=2, MinWords=5, MaxWords=20') AS description").
+		Where("products.id IN ?", ids).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	highlights := make(map[uint]ProductHighlight, len(rows))
+	for _, row := range rows {
+		highlights[row.ID] = row.ProductHighlight
+	}
+	return highlights, nil
 }
 
-// SearchProducts searches for products by name
-func (r *ProductRepository) SearchProducts(search string) ([]models.Product, error) {
+// applyProductFilter adds the conditions of filter to query
+func applyProductFilter(query *gorm.DB, filter ProductFilter) *gorm.DB {
+	if filter.Search != "" {
+		query = query.Where("search_vector @@ "+productSearchQuery, filter.Search)
+	}
+	if filter.Category != "" {
+		query = query.Where("category_id IN ("+categoryTreeQuery+")", filter.Category)
+	}
+	if filter.Brand != "" {
+		query = query.Where("brand = ?", filter.Brand)
+	}
+	if filter.MinPrice > 0 {
+		query = query.Where("price_amount >= ?", filter.MinPrice)
+	}
+	if filter.MaxPrice > 0 {
+		query = query.Where("price_amount <= ?", filter.MaxPrice)
+	}
+	if filter.MinRating > 0 {
+		query = query.Where("rating >= ?", filter.MinRating)
+	}
+	if filter.InStock != nil {
+		if *filter.InStock {
+			query = query.Where("stock > reserved")
+		} else {
+			query = query.Where("stock <= reserved")
+		}
+	}
+	return query
+}
+
+// priceHistogramBuckets is roughly how many buckets the price facet is
+// split into
+const priceHistogramBuckets = 10
+
+// GetProductFacets counts the products matching filter by category, brand,
+// price range and availability
+func (r *ProductRepository) GetProductFacets(filter ProductFilter) (*ProductFacets, error) {
+	facets := &ProductFacets{}
+
+	withoutCategory := filter
+	withoutCategory.Category = ""
+	err := applyProductFilter(r.db.Model(&models.Product{}), withoutCategory).
+		Joins("JOIN categories ON categories.id = products.category_id").
+		Select("categories.slug AS value, categories.name AS label, COUNT(*) AS count").
+		Group("categories.id").
+		Order("count DESC, label").
+		Scan(&facets.Categories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	withoutBrand := filter
+	withoutBrand.Brand = ""
+	err = applyProductFilter(r.db.Model(&models.Product{}), withoutBrand).
+		Select("brand AS value, brand AS label, COUNT(*) AS count").
+		Where("brand <> ''").
+		Group("brand").
+		Order("count DESC, value").
+		Scan(&facets.Brands).Error
+	if err != nil {
+		return nil, err
+	}
+
+	withoutStock := filter
+	withoutStock.InStock = nil
+	var availability struct {
+		InStock    int64
+		OutOfStock int64
+	}
+	err = applyProductFilter(r.db.Model(&models.Product{}), withoutStock).
+		Select("COUNT(*) FILTER (WHERE stock > reserved) AS in_stock, COUNT(*) FILTER (WHERE stock <= reserved) AS out_of_stock").
+		Scan(&availability).Error
+	if err != nil {
+		return nil, err
+	}
+	facets.InStock, facets.OutOfStock = availability.InStock, availability.OutOfStock
+
+	withoutPrice := filter
+	withoutPrice.MinPrice, withoutPrice.MaxPrice = 0, 0
+	if facets.Prices, err = r.priceHistogram(withoutPrice); err != nil {
+		return nil, err
+	}
+
+	return facets, nil
+}
+
+// priceHistogram splits the prices of the products matching filter into
+// buckets of a round width. Empty buckets are left out.
+func (r *ProductRepository) priceHistogram(filter ProductFilter) ([]PriceBucket, error) {
+	var bounds struct {
+		Min   int64
+		Max   int64
+		Count int64
+	}
+	err := applyProductFilter(r.db.Model(&models.Product{}), filter).
+		Select("MIN(price_amount) AS min, MAX(price_amount) AS max, COUNT(*) AS count").
+		Scan(&bounds).Error
+	if err != nil || bounds.Count == 0 {
+		return nil, err
+	}
+
+	width := roundBucketWidth((bounds.Max - bounds.Min) / priceHistogramBuckets)
+
+	var rows []struct {
+		Bucket int64
+		Count  int64
+	}
+	err = applyProductFilter(r.db.Model(&models.Product{}), filter).
+		Select("price_amount / ? AS bucket, COUNT(*) AS count", width).
+		Group("bucket").
+		Order("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]PriceBucket, 0, len(rows))
+	for _, row := range rows {
+		buckets = append(buckets, PriceBucket{
+			Min:   row.Bucket * width,
+			Max:   (row.Bucket + 1) * width,
+			Count: row.Count,
+		})
+	}
+	return buckets, nil
+}
+
+// roundBucketWidth rounds a bucket width up to 1, 2 or 5 times a power of
+// ten, so that bucket bounds are prices people read easily
+func roundBucketWidth(width int64) int64 {
+	scale := int64(1)
+	for {
+		for _, step := range []int64{1, 2, 5} {
+			if width <= step*scale {
+				return step * scale
+			}
+		}
+		scale *= 10
+	}
+}
+
+// UpdateProduct updates an existing product and replaces its currency
+// price overrides with product.Prices. A change of the stock of a product
+// without variants is recorded in the stock ledger as an adjustment by
+// actorID.
+func (r *ProductRepository) UpdateProduct(product *models.Product, actorID *uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return updateProduct(tx, product, actorID, "")
+	})
+}
+
+// productColumns are the columns of a product an update writes, the ones
+// admins edit. Reserved, sold_count, rating and review_count are kept up to
+// date concurrently by reservations, sales and reviews, so an update must
+// not write back the values it read.
+var productColumns = []string{"name", "sku", "description", "price_amount", "price_currency", "category_id", "category", "brand", "tax_class", "image_url", "reorder_threshold", "updated_at"}
+
+// variantColumns are the columns of a variant an update writes
+var variantColumns = []string{"sku", "options", "price_amount", "stock", "updated_at"}
+
+// updateProduct saves a product, records a change of its stock and replaces
+// its currency price overrides within a transaction. Stock is only written
+// for a product without variants, and never below what is reserved.
+func updateProduct(tx *gorm.DB, product *models.Product, actorID *uint, note string) error {
+	// The stock of a product with variants follows theirs, which record
+	// their own changes
+	columns := productColumns
+	recordStock := len(product.Variants) == 0
+	var before int
+	if recordStock {
+		var reserved int
+		var err error
+		if before, reserved, err = lockStock(tx, &models.Product{}, product.ID); err != nil {
+			return err
+		}
+		if product.Stock < reserved {
+			return fmt.Errorf("%w: %d reserved", ErrStockBelowReserved, reserved)
+		}
+		columns = append(slices.Clone(columns), "stock")
+	}
+
+	if err := tx.Select(columns).Save(product).Error; err != nil {
+		return err
+	}
+	if recordStock {
+		if err := recordStockEdit(tx, product.ID, nil, before, product.Stock, actorID, note); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductPrice{}).Error; err != nil {
+		return err
+	}
+	if len(product.Prices) == 0 {
+		return nil
+	}
+
+	for i := range product.Prices {
+		product.Prices[i].ID = 0
+		product.Prices[i].ProductID = product.ID
+	}
+	return tx.Create(&product.Prices).Error
+}
+
+// GetProductsBySKU retrieves the products with the given SKUs, keyed by SKU
+func (r *ProductRepository) GetProductsBySKU(skus []string) (map[string]*models.Product, error) {
+	products := make(map[string]*models.Product, len(skus))
+	if len(skus) == 0 {
+		return products, nil
+	}
+
+	var found []models.Product
+	err := r.db.Preload("Prices").Preload("Images", orderByPosition).Preload("Variants", orderByID).
+		Where("sku IN ?", skus).
+		Find(&found).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range found {
+		products[found[i].SKU] = &found[i]
+	}
+	return products, nil
+}
+
+// ImportProducts creates the products without an ID and updates the others,
+// all in one transaction
+func (r *ProductRepository) ImportProducts(products []*models.Product, actorID *uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, product := range products {
+			if product.ID == 0 {
+				if err := createProduct(tx, product, actorID, "import"); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := updateProduct(tx, product, actorID, "import"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// EachProduct calls fn with every product, in ID order, a batch at a time.
+// Products carry their currency price overrides.
+func (r *ProductRepository) EachProduct(batchSize int, fn func([]models.Product) error) error {
 	var products []models.Product
-	err := r.db.Where("name ILIKE ?", "%"+search+"%").Find(&products).Error
-	return products, err
+	return r.db.Preload("Prices").FindInBatches(&products, batchSize, func(_ *gorm.DB, _ int) error {
+		return fn(products)
+	}).Error
+}
+
+// GetPriceCurrencies retrieves the currencies any product has a fixed price
+// in
+func (r *ProductRepository) GetPriceCurrencies() ([]string, error) {
+	var currencies []string
+	err := r.db.Model(&models.ProductPrice{}).Distinct("currency").Order("currency").Pluck("currency", &currencies).Error
+	return currencies, err
+}
+
+// ErrVariantNotFound is returned when a product variant does not exist
+var ErrVariantNotFound = errors.New("product variant not found")
+
+// orderByID sorts preloaded rows by ID
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// GetVariantByID retrieves a variant of a product
+func (r *ProductRepository) GetVariantByID(productID, variantID uint) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := r.db.Where("product_id = ?", productID).First(&variant, variantID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVariantNotFound
+		}
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// GetVariantsForUpdate retrieves variants by ID and locks their rows until
+// the surrounding transaction ends. Soft-deleted variants are left out.
+func (r *ProductRepository) GetVariantsForUpdate(ids []uint) ([]models.ProductVariant, error) {
+	var variants []models.ProductVariant
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&variants).Error
+	return variants, err
+}
+
+// CountVariants counts the variants of each of the given products
+func (r *ProductRepository) CountVariants(productIDs []uint) (map[uint]int64, error) {
+	var rows []struct {
+		ProductID uint
+		Count     int64
+	}
+	err := r.db.Model(&models.ProductVariant{}).
+		Select("product_id, COUNT(*) AS count").
+		Where("product_id IN ?", productIDs).
+		Group("product_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ProductID] = row.Count
+	}
+	return counts, nil
+}
+
+// CreateVariant adds a variant to a product and records its initial stock
+// in the stock ledger as an adjustment by actorID
+func (r *ProductRepository) CreateVariant(variant *models.ProductVariant, actorID *uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(variant).Error; err != nil {
+			return err
+		}
+		if err := syncVariantStock(tx, variant.ProductID); err != nil {
+			return err
+		}
+		return recordStockEdit(tx, variant.ProductID, &variant.ID, 0, variant.Stock, actorID, "initial stock")
+	})
+}
+
+// UpdateVariant updates an existing variant. A change of its stock is
+// recorded in the stock ledger as an adjustment by actorID.
+func (r *ProductRepository) UpdateVariant(variant *models.ProductVariant, actorID *uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		before, reserved, err := lockStock(tx, &models.ProductVariant{}, variant.ID)
+		if err != nil {
+			return err
+		}
+		if variant.Stock < reserved {
+			return fmt.Errorf("%w: %d reserved", ErrStockBelowReserved, reserved)
+		}
+		if err := tx.Select(variantColumns).Save(variant).Error; err != nil {
+			return err
+		}
+		if err := syncVariantStock(tx, variant.ProductID); err != nil {
+			return err
+		}
+		return recordStockEdit(tx, variant.ProductID, &variant.ID, before, variant.Stock, actorID, "")
+	})
+}
+
+// AdjustStock adds quantity, which may be negative, to a product's stock.
+// The update only applies while the stock stays at least what is reserved.
+func (r *ProductRepository) AdjustStock(id uint, quantity int) error {
+	result := r.db.Model(&models.Product{}).
+		Where("id = ? AND stock + ? >= reserved", id, quantity).
+		Update("stock", gorm.Expr("stock + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+// AdjustVariantStock adds quantity, which may be negative, to a variant's
+// stock, and so to its product's. Like AdjustStock, it never takes stock
+// below what is reserved.
+func (r *ProductRepository) AdjustVariantStock(productID, variantID uint, quantity int) error {
+	result := r.db.Model(&models.ProductVariant{}).
+		Where("id = ? AND product_id = ? AND stock + ? >= reserved", variantID, productID, quantity).
+		Update("stock", gorm.Expr("stock + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return syncVariantStock(r.db, productID)
+}
+
+// DeleteVariant deletes a variant of a product
+func (r *ProductRepository) DeleteVariant(productID, variantID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("product_id = ?", productID).Delete(&models.ProductVariant{}, variantID).Error
+		if err != nil {
+			return err
+		}
+		return syncVariantStock(tx, productID)
+	})
+}
+
+// ReserveVariantStock holds quantity of a variant's stock, and so of its
+// product's, for an unpaid order. Like ReserveStock, it never reserves more
+// than is available.
+func (r *ProductRepository) ReserveVariantStock(productID, variantID uint, quantity int) error {
+	result := r.db.Model(&models.ProductVariant{}).
+		Where("id = ? AND stock - reserved >= ?", variantID, quantity).
+		Update("reserved", gorm.Expr("reserved + ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	return syncVariantStock(r.db, productID)
+}
+
+// ReleaseVariantStock gives back variant stock reserved for an order that
+// was not paid
+func (r *ProductRepository) ReleaseVariantStock(productID, variantID uint, quantity int) error {
+	err := r.db.Unscoped().Model(&models.ProductVariant{}).
+		Where("id = ?", variantID).
+		Update("reserved", gorm.Expr("GREATEST(reserved - ?, 0)", quantity)).Error
+	if err != nil {
+		return err
+	}
+	return syncVariantStock(r.db, productID)
+}
+
+// DecrementVariantStock takes quantity sold out of a variant's stock and
+// reservations, and its product's. Like DecrementStock, it never takes
+// stock below zero.
+func (r *ProductRepository) DecrementVariantStock(productID, variantID uint, quantity int) error {
+	result := r.db.Unscoped().Model(&models.ProductVariant{}).
+		Where("id = ? AND stock >= ?", variantID, quantity).
+		Updates(map[string]interface{}{
+			"stock":    gorm.Expr("stock - ?", quantity),
+			"reserved": gorm.Expr("GREATEST(reserved - ?, 0)", quantity),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+
+	err := r.db.Unscoped().Model(&models.Product{}).
+		Where("id = ?", productID).
+		Update("sold_count", gorm.Expr("sold_count + ?", quantity)).Error
+	if err != nil {
+		return err
+	}
+	return syncVariantStock(r.db, productID)
+}
+
+// IncrementVariantStock puts quantity back in a variant's stock and takes
+// it off the product's sold count. Soft-deleted variants are restocked too,
+// but do not count towards the product's stock.
+func (r *ProductRepository) IncrementVariantStock(productID, variantID uint, quantity int) error {
+	err := r.db.Unscoped().Model(&models.ProductVariant{}).
+		Where("id = ?", variantID).
+		Update("stock", gorm.Expr("stock + ?", quantity)).Error
+	if err != nil {
+		return err
+	}
+
+	err = r.db.Unscoped().Model(&models.Product{}).
+		Where("id = ?", productID).
+		Update("sold_count", gorm.Expr("GREATEST(sold_count - ?, 0)", quantity)).Error
+	if err != nil {
+		return err
+	}
+	return syncVariantStock(r.db, productID)
 }
 
-// UpdateProduct updates an existing product
-func (r *ProductRepository) UpdateProduct(product *models.Product) error {
-	return r.db.Save(product).Error
+// syncVariantStock sets a product's stock and reserved stock to the sums
+// of its variants'
+func syncVariantStock(tx *gorm.DB, productID uint) error {
+	const sum = "(SELECT COALESCE(SUM(%s), 0) FROM product_variants WHERE product_id = ? AND deleted_at IS NULL)"
+	return tx.Unscoped().Model(&models.Product{}).
+		Where("id = ?", productID).
+		Updates(map[string]interface{}{
+			"stock":    gorm.Expr(fmt.Sprintf(sum, "stock"), productID),
+			"reserved": gorm.Expr(fmt.Sprintf(sum, "reserved"), productID),
+		}).Error
 }
 
 // DeleteProduct deletes a product by ID
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"store/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrPromotionNotFound is returned when a promotion, or coupon code, does
+	// not exist
+	ErrPromotionNotFound = errors.New("promotion not found")
+	// ErrPromotionUsedUp is returned when a promotion has been used as many
+	// times as its usage limit allows
+	ErrPromotionUsedUp = errors.New("promotion has been used up")
+)
+
+// PromotionRepository handles database operations for promotions
+type PromotionRepository struct {
+	db *gorm.DB
+}
+
+// NewPromotionRepository creates a new PromotionRepository
+func NewPromotionRepository(database *Database) *PromotionRepository {
+	return &PromotionRepository{db: database.DB}
+}
+
+// CreatePromotion adds a new promotion to the database
+func (r *PromotionRepository) CreatePromotion(promotion *models.Promotion) error {
+	return r.db.Create(promotion).Error
+}
+
+// GetPromotions retrieves a page of promotions, newest first, and the
+// number of them on all pages
+func (r *PromotionRepository) GetPromotions(page, limit int) ([]models.Promotion, int64, error) {
+	query := r.db.Model(&models.Promotion{})
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var promotions []models.Promotion
+	err := query.Order("id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&promotions).Error
+	return promotions, total, err
+}
+
+// GetPromotionByID retrieves a promotion by ID
+func (r *PromotionRepository) GetPromotionByID(id uint) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := r.db.First(&promotion, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromotionNotFound
+		}
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// GetPromotionByCode retrieves the promotion with a coupon code
+func (r *PromotionRepository) GetPromotionByCode(code string) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := r.db.Where("code = ? AND code <> ''", code).First(&promotion).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPromotionNotFound
+		}
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+// GetApplicablePromotions retrieves the active automatic promotions that
+// are running at now and, if code is not empty, the active promotion with
+// that code whether or not it is running, in ID order. With lock the
+// promotion rows stay locked until the surrounding transaction ends.
+func (r *PromotionRepository) GetApplicablePromotions(code string, now time.Time, lock bool) ([]models.Promotion, error) {
+	query := r.db.Where("active").
+		Where(r.db.Where("code = '' AND (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", now, now).
+			Or("code = ? AND code <> ''", code))
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+
+	var promotions []models.Promotion
+	err := query.Order("id").Find(&promotions).Error
+	return promotions, err
+}
+
+// UpdatePromotion updates an existing promotion. The usage count is left
+// alone: it is only changed by orders.
+func (r *PromotionRepository) UpdatePromotion(promotion *models.Promotion) error {
+	return r.db.Omit("usage_count").Save(promotion).Error
+}
+
+// DeletePromotion deletes a promotion by ID. Orders keep their discount
+// lines.
+func (r *PromotionRepository) DeletePromotion(id uint) error {
+	return r.db.Delete(&models.Promotion{}, id).Error
+}
+
+// CountUserRedemptions counts a user's orders that used a promotion and
+// were not cancelled
+func (r *PromotionRepository) CountUserRedemptions(promotionID, userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.OrderDiscount{}).
+		Joins("JOIN orders o ON o.id = order_discounts.order_id AND o.deleted_at IS NULL").
+		Where("order_discounts.promotion_id = ? AND o.user_id = ? AND o.status <> ?", promotionID, userID, models.OrderStatusCancelled).
+		Count(&count).Error
+	return count, err
+}
+
+// Redeem counts one more use of a promotion. The update only applies while
+// the promotion is below its usage limit, so concurrent orders never use
+// it more often than allowed.
+func (r *PromotionRepository) Redeem(id uint) error {
+	result := r.db.Model(&models.Promotion{}).
+		Where("id = ? AND (usage_limit = 0 OR usage_count < usage_limit)", id).
+		Update("usage_count", gorm.Expr("usage_count + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromotionUsedUp
+	}
+	return nil
+}
+
+// ReleaseRedemptions gives back the uses of the promotions an order used,
+// for when it is cancelled
+func (r *PromotionRepository) ReleaseRedemptions(orderID uint) error {
+	return r.db.Unscoped().Model(&models.Promotion{}).
+		Where("id IN (SELECT promotion_id FROM order_discounts WHERE order_id = ?) AND usage_count > 0", orderID).
+		Update("usage_count", gorm.Expr("usage_count - 1")).Error
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"store/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReservationRepository handles database operations for stock reservations
+type ReservationRepository struct {
+	db *gorm.DB
+}
+
+// NewReservationRepository creates a new ReservationRepository
+func NewReservationRepository(database *Database) *ReservationRepository {
+	return &ReservationRepository{db: database.DB}
+}
+
+// CreateReservations saves new stock reservations
+func (r *ReservationRepository) CreateReservations(reservations []models.StockReservation) error {
+	if len(reservations) == 0 {
+		return nil
+	}
+	return r.db.Create(&reservations).Error
+}
+
+// GetActiveReservationsForUpdate retrieves the active reservations of an
+// order and locks them until the surrounding transaction ends
+func (r *ReservationRepository) GetActiveReservationsForUpdate(orderID uint) ([]models.StockReservation, error) {
+	var reservations []models.StockReservation
+	err := r.db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status = ?", orderID, models.ReservationStatusActive).
+		Order("id").
+		Find(&reservations).Error
+	return reservations, err
+}
+
+// UpdateReservationStatus sets the status of reservations
+func (r *ReservationRepository) UpdateReservationStatus(ids []uint, status models.ReservationStatus) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Model(&models.StockReservation{}).Where("id IN ?", ids).Update("status", status).Error
+}
+
+// GetExpiredOrderIDs retrieves the IDs of up to limit orders with active
+// reservations that expired before now
+func (r *ReservationRepository) GetExpiredOrderIDs(now time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.StockReservation{}).
+		Where("status = ? AND expires_at < ?", models.ReservationStatusActive, now).
+		Distinct("order_id").
+		Order("order_id").
+		Limit(limit).
+		Pluck("order_id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"errors"
+	"store/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrReviewNotFound is returned when a review does not exist
+	ErrReviewNotFound = errors.New("review not found")
+	// ErrAlreadyReviewed is returned when a user reviews a product twice
+	ErrAlreadyReviewed = errors.New("product already reviewed")
+)
+
+// ReviewRepository handles database operations for product reviews
+type ReviewRepository struct {
+	db *gorm.DB
+}
+
+// NewReviewRepository creates a new ReviewRepository
+func NewReviewRepository(database *Database) *ReviewRepository {
+	return &ReviewRepository{db: database.DB}
+}
+
+// HasDeliveredOrder reports whether a user has received a product in one
+// of their orders
+func (r *ReviewRepository) HasDeliveredOrder(userID, productID uint) (bool, error) {
+	var delivered bool
+	err := r.db.Raw(`SELECT EXISTS (
+	SELECT 1 FROM order_items oi
+	JOIN orders o ON o.id = oi.order_id
+	WHERE o.user_id = ? AND oi.product_id = ? AND o.status = ? AND o.deleted_at IS NULL
+)`, userID, productID, models.OrderStatusDelivered).Scan(&delivered).Error
+	return delivered, err
+}
+
+// HasReviewed reports whether a user has already reviewed a product
+func (r *ReviewRepository) HasReviewed(userID, productID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Review{}).Where("user_id = ? AND product_id = ?", userID, productID).Count(&count).Error
+	return count > 0, err
+}
+
+// CreateReview adds a new review. It returns ErrAlreadyReviewed if the user
+// has already reviewed the product.
+func (r *ReviewRepository) CreateReview(review *models.Review) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(review).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrAlreadyReviewed
+			}
+			return err
+		}
+		return updateProductRating(tx, review.ProductID)
+	})
+}
+
+// GetReviewByID retrieves a review with its author
+func (r *ReviewRepository) GetReviewByID(id uint) (*models.Review, error) {
+	var review models.Review
+	err := r.db.Preload("User").First(&review, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, err
+	}
+	return &review, nil
+}
+
+// GetProductReviews retrieves a page of a product's reviews with the given
+// status, newest first, and the number of them on all pages
+func (r *ReviewRepository) GetProductReviews(productID uint, status models.ReviewStatus, page, limit int) ([]models.Review, int64, error) {
+	query := r.db.Model(&models.Review{}).Where("product_id = ? AND status = ?", productID, status)
+	return r.findReviews(query, "created_at DESC, id DESC", page, limit)
+}
+
+// GetReviewsByStatus retrieves a page of reviews of all products with the
+// given status, oldest first, and the number of them on all pages
+func (r *ReviewRepository) GetReviewsByStatus(status models.ReviewStatus, page, limit int) ([]models.Review, int64, error) {
+	query := r.db.Model(&models.Review{}).Where("status = ?", status)
+	return r.findReviews(query, "created_at, id", page, limit)
+}
+
+// findReviews counts the reviews matching query and loads a page of them
+// in the given order, with their authors
+func (r *ReviewRepository) findReviews(query *gorm.DB, order string, page, limit int) ([]models.Review, int64, error) {
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var reviews []models.Review
+	err := query.Preload("User").
+		Order(order).
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&reviews).Error
+	return reviews, total, err
+}
+
+// UpdateReviewStatus moderates a review and updates its product's rating
+func (r *ReviewRepository) UpdateReviewStatus(review *models.Review, status models.ReviewStatus) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(review).Update("status", status).Error; err != nil {
+			return err
+		}
+		return updateProductRating(tx, review.ProductID)
+	})
+}
+
+// DeleteReview deletes a review and updates its product's rating
+func (r *ReviewRepository) DeleteReview(review *models.Review) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(review).Error; err != nil {
+			return err
+		}
+		return updateProductRating(tx, review.ProductID)
+	})
+}
+
+// updateProductRating recomputes a product's average rating and review
+// count from its approved reviews
+func updateProductRating(tx *gorm.DB, productID uint) error {
+	return tx.Exec(`UPDATE products SET
+	rating = COALESCE((SELECT ROUND(AVG(rating), 2) FROM reviews WHERE product_id = @id AND status = @status), 0),
+	review_count = (SELECT COUNT(*) FROM reviews WHERE product_id = @id AND status = @status)
+WHERE id = @id`, map[string]interface{}{"id": productID, "status": models.ReviewStatusApproved}).Error
+}
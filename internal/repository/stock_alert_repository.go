@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"store/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StockAlertRepository handles database operations for stock alerts and
+// back-in-stock subscriptions
+type StockAlertRepository struct {
+	db *gorm.DB
+}
+
+// NewStockAlertRepository creates a new StockAlertRepository
+func NewStockAlertRepository(database *Database) *StockAlertRepository {
+	return &StockAlertRepository{db: database.DB}
+}
+
+// GetLowStockProducts retrieves up to limit products after afterID whose
+// available stock is at or below their reorder threshold and that have no
+// open alert yet
+func (r *StockAlertRepository) GetLowStockProducts(afterID uint, limit int) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.
+		Where("id > ?", afterID).
+		Where("reorder_threshold > 0 AND stock - reserved <= reorder_threshold").
+		Where("NOT EXISTS (SELECT 1 FROM stock_alerts a WHERE a.product_id = products.id AND a.resolved_at IS NULL)").
+		Order("id").
+		Limit(limit).
+		Find(&products).Error
+	return products, err
+}
+
+// CreateAlert opens a stock alert
+func (r *StockAlertRepository) CreateAlert(alert *models.StockAlert) error {
+	return r.db.Create(alert).Error
+}
+
+// ResolveAlerts resolves the open alerts of products that are back above
+// their reorder threshold, no longer have one or were deleted, and returns
+// how many it resolved
+func (r *StockAlertRepository) ResolveAlerts(now time.Time) (int64, error) {
+	result := r.db.Model(&models.StockAlert{}).
+		Where("resolved_at IS NULL").
+		Where(`product_id NOT IN (SELECT id FROM products
+	WHERE reorder_threshold > 0 AND stock - reserved <= reorder_threshold AND deleted_at IS NULL)`).
+		Update("resolved_at", now)
+	return result.RowsAffected, result.Error
+}
+
+// GetAlerts retrieves a page of open, or resolved, stock alerts with their
+// products, newest first, and the number of them on all pages
+func (r *StockAlertRepository) GetAlerts(open bool, page, limit int) ([]models.StockAlert, int64, error) {
+	query := r.db.Model(&models.StockAlert{})
+	if open {
+		query = query.Where("resolved_at IS NULL")
+	} else {
+		query = query.Where("resolved_at IS NOT NULL")
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var alerts []models.StockAlert
+	err := query.Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&alerts).Error
+	return alerts, total, err
+}
+
+// CreateSubscription subscribes a user to a product, or variant, coming
+// back in stock. Nothing is created if the user is already waiting for it.
+func (r *StockAlertRepository) CreateSubscription(subscription *models.StockSubscription) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(subscription).Error
+}
+
+// DeleteSubscription unsubscribes a user from a product, or variant, coming
+// back in stock
+func (r *StockAlertRepository) DeleteSubscription(userID, productID uint, variantID *uint) error {
+	return subscriptionQuery(r.db, userID, productID, variantID).Delete(&models.StockSubscription{}).Error
+}
+
+// subscriptionQuery selects a user's pending subscriptions to a product, or
+// to one of its variants
+func subscriptionQuery(db *gorm.DB, userID, productID uint, variantID *uint) *gorm.DB {
+	query := db.Model(&models.StockSubscription{}).
+		Where("user_id = ? AND product_id = ? AND notified_at IS NULL", userID, productID)
+	if variantID != nil {
+		return query.Where("variant_id = ?", *variantID)
+	}
+	return query.Where("variant_id IS NULL")
+}
+
+// GetRestockedSubscriptions retrieves up to limit pending subscriptions
+// after afterID to products, or variants, that are available again, with
+// their users and products
+func (r *StockAlertRepository) GetRestockedSubscriptions(afterID uint, limit int) ([]models.StockSubscription, error) {
+	var subscriptions []models.StockSubscription
+	err := r.db.
+		Where("stock_subscriptions.id > ?", afterID).
+		Joins("JOIN products p ON p.id = stock_subscriptions.product_id AND p.deleted_at IS NULL").
+		Joins("LEFT JOIN product_variants v ON v.id = stock_subscriptions.variant_id AND v.deleted_at IS NULL").
+		Where("stock_subscriptions.notified_at IS NULL").
+		Where(`CASE WHEN stock_subscriptions.variant_id IS NULL THEN p.stock > p.reserved
+	ELSE v.stock > v.reserved END`).
+		Preload("User").
+		Preload("Product").
+		Order("stock_subscriptions.id").
+		Limit(limit).
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// MarkSubscriptionNotified records that the subscriber was told the product
+// is back in stock
+func (r *StockAlertRepository) MarkSubscriptionNotified(id uint, now time.Time) error {
+	return r.db.Model(&models.StockSubscription{}).Where("id = ?", id).Update("notified_at", now).Error
+}
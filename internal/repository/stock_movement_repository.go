@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"fmt"
+	"store/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StockMovementRepository handles database operations for the stock ledger
+type StockMovementRepository struct {
+	db *gorm.DB
+}
+
+// NewStockMovementRepository creates a new StockMovementRepository
+func NewStockMovementRepository(database *Database) *StockMovementRepository {
+	return &StockMovementRepository{db: database.DB}
+}
+
+// CreateMovement records a stock change that has already been applied
+func (r *StockMovementRepository) CreateMovement(movement *models.StockMovement) error {
+	return recordStockMovement(r.db, movement)
+}
+
+// GetMovements retrieves a page of the stock movements of a product, or of
+// one of its variants if variantID is set, newest first, and the number of
+// them on all pages
+func (r *StockMovementRepository) GetMovements(productID uint, variantID *uint, page, limit int) ([]models.StockMovement, int64, error) {
+	query := r.db.Model(&models.StockMovement{}).Where("product_id = ?", productID)
+	if variantID != nil {
+		query = query.Where("variant_id = ?", *variantID)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var movements []models.StockMovement
+	err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&movements).Error
+	return movements, total, err
+}
+
+// recordStockMovement saves a stock movement together with the stock of its
+// product, or variant, as it stands after the change. It must run in the
+// transaction that changed the stock.
+func recordStockMovement(tx *gorm.DB, movement *models.StockMovement) error {
+	table, id := "products", movement.ProductID
+	if movement.VariantID != nil {
+		table, id = "product_variants", *movement.VariantID
+	}
+
+	err := tx.Raw(fmt.Sprintf("SELECT stock FROM %s WHERE id = ?", table), id).
+		Scan(&movement.StockAfter).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(movement).Error
+}
+
+// recordStockEdit records an edit that set the stock of a product, or
+// variant, from before to after as an adjustment, if it changed anything
+func recordStockEdit(tx *gorm.DB, productID uint, variantID *uint, before, after int, actorID *uint, note string) error {
+	if after == before {
+		return nil
+	}
+	return recordStockMovement(tx, &models.StockMovement{
+		ProductID: productID,
+		VariantID: variantID,
+		Quantity:  after - before,
+		Reason:    models.StockMovementAdjustment,
+		Note:      note,
+		ActorID:   actorID,
+	})
+}
+
+// lockStock locks the row of a product or variant, given by an empty model,
+// until the surrounding transaction ends and returns its stock and reserved
+// quantity
+func lockStock(tx *gorm.DB, model interface{}, id uint) (stock, reserved int, err error) {
+	var row struct {
+		Stock    int
+		Reserved int
+	}
+	err = tx.Model(model).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ?", id).
+		Select("stock, reserved").
+		Scan(&row).Error
+	return row.Stock, row.Reserved, err
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"errors"
+	"store/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTaxRateNotFound is returned when a tax rate does not exist
+var ErrTaxRateNotFound = errors.New("tax rate not found")
+
+// TaxRepository handles database operations for tax rates
+type TaxRepository struct {
+	db *gorm.DB
+}
+
+// NewTaxRepository creates a new TaxRepository
+func NewTaxRepository(database *Database) *TaxRepository {
+	return &TaxRepository{db: database.DB}
+}
+
+// GetTaxRates retrieves all tax rates, by region and tax class
+func (r *TaxRepository) GetTaxRates() ([]models.TaxRate, error) {
+	var rates []models.TaxRate
+	err := r.db.Order("region").Order("tax_class").Find(&rates).Error
+	return rates, err
+}
+
+// GetTaxRatesForRegions retrieves the tax rates of the given regions
+func (r *TaxRepository) GetTaxRatesForRegions(regions []string) ([]models.TaxRate, error) {
+	var rates []models.TaxRate
+	err := r.db.Where("region IN ?", regions).Find(&rates).Error
+	return rates, err
+}
+
+// SaveTaxRates inserts or updates tax rates, matching them by region and
+// tax class
+func (r *TaxRepository) SaveTaxRates(rates []models.TaxRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "region"}, {Name: "tax_class"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "name", "updated_at"}),
+	}).Create(&rates).Error
+}
+
+// DeleteTaxRate deletes a tax rate by ID
+func (r *TaxRepository) DeleteTaxRate(id uint) error {
+	result := r.db.Delete(&models.TaxRate{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaxRateNotFound
+	}
+	return nil
+}
@@ -1,69 +1,495 @@
 package services
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
 	"store/internal/models"
 	"store/internal/repository"
+	"time"
 )
 
+var (
+	// ErrVariantRequired is returned when a product with variants is added
+	// to the cart or ordered without choosing a variant
+	ErrVariantRequired = errors.New("choose a variant of the product")
+	// ErrVariantNotFound is returned when a product variant does not exist
+	ErrVariantNotFound = repository.ErrVariantNotFound
+	// ErrCartItemNotFound is returned when an item is not in the user's cart
+	ErrCartItemNotFound = repository.ErrCartItemNotFound
+	// ErrInsufficientStock is returned when more of a product is asked for
+	// than is available
+	ErrInsufficientStock = repository.ErrInsufficientStock
+	// ErrCartChanged is returned at checkout when prices or availability of
+	// items in the cart changed since they were added, until the shopper
+	// accepts the changes
+	ErrCartChanged = errors.New("cart has changed; review and accept the changes")
+)
+
+// Cart warning codes
+const (
+	CartWarningPriceIncreased    = "price_increased"
+	CartWarningPriceDecreased    = "price_decreased"
+	CartWarningInsufficientStock = "insufficient_stock"
+	CartWarningUnavailable       = "unavailable"
+)
+
+// CartWarning tells the shopper that an item of their cart changed since
+// they added it. Prices are in the store currency.
+type CartWarning struct {
+	Code      string
+	OldPrice  models.Money // for price changes
+	NewPrice  models.Money // for price changes
+	Available int          // for insufficient stock
+}
+
+// guestCartCleanupBatch is the number of idle guest carts deleted at a time
+// by CleanupGuestCarts
+const guestCartCleanupBatch = 500
+
+// CartOwner identifies whose cart a request is about: a signed-in user's,
+// or, when UserID is 0, a guest's by the token handed out with their cart.
+// A guest without a token has no cart yet.
+type CartOwner struct {
+	UserID     uint
+	GuestToken string
+}
+
 // CartService provides cart-related operations
 type CartService struct {
+	db          *repository.Database
 	cartRepo    *repository.CartRepository
 	productRepo *repository.ProductRepository
+	promotions  *PromotionService
+	// guestCartTTL is how long a guest cart is kept after it last changed
+	guestCartTTL time.Duration
 }
 
 // NewCartService creates a new CartService
-func NewCartService(cartRepo *repository.CartRepository, productRepo *repository.ProductRepository) *CartService {
+func NewCartService(db *repository.Database, cartRepo *repository.CartRepository, productRepo *repository.ProductRepository, promotions *PromotionService, guestCartTTL time.Duration) *CartService {
 	return &CartService{
-		cartRepo:    cartRepo,
-		productRepo: productRepo,
+		db:           db,
+		cartRepo:     cartRepo,
+		productRepo:  productRepo,
+		promotions:   promotions,
+		guestCartTTL: guestCartTTL,
 	}
 }
 
-// GetCart gets the user's cart
-func (s *CartService) GetCart(userID uint) (*models.Cart, error) {
-	return s.cartRepo.GetOrCreateCart(userID)
+// GuestCartTTL returns how long a guest cart is kept after it last changed
+func (s *CartService) GuestCartTTL() time.Duration {
+	return s.guestCartTTL
+}
+
+// GetCart gets the owner's cart. A guest without a cart gets an empty one,
+// which is not saved until something is added to it.
+func (s *CartService) GetCart(owner CartOwner) (*models.Cart, error) {
+	if owner.UserID != 0 {
+		return s.cartRepo.GetOrCreateCart(owner.UserID)
+	}
+	if owner.GuestToken == "" {
+		return &models.Cart{}, nil
+	}
+
+	cart, err := s.cartRepo.GetGuestCart(owner.GuestToken)
+	if errors.Is(err, repository.ErrCartNotFound) {
+		return &models.Cart{}, nil
+	}
+	return cart, err
 }
 
-// AddToCart adds a product to the user's cart
-func (s *CartService) AddToCart(userID, productID uint, quantity int) error {
-	// Validate product exists
-	product, err := s.productRepo.GetProductByID(productID)
+// AddToCart adds a product to the owner's cart at its current price and
+// returns the cart. Products with variants are added by variant. Adding to
+// an item already in the cart raises its quantity, if that much is in stock,
+// and keeps the price it was added at.
+// A guest without a cart gets a new one, with a new GuestToken.
+func (s *CartService) AddToCart(owner CartOwner, productID uint, variantID *uint, quantity int) (*models.Cart, error) {
+	product, variant, err := cartProduct(s.productRepo, productID, variantID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get or create cart
+	cart, err := s.GetCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	if cartLineStock(product, variant) < cartItemQuantity(cart, productID, variantID)+quantity {
+		return nil, ErrInsufficientStock
+	}
+	if cart.ID == 0 {
+		token, err := newGuestCartToken()
+		if err != nil {
+			return nil, err
+		}
+		if cart, err = s.cartRepo.CreateGuestCart(token); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add to cart
+	if err := s.cartRepo.AddToCart(cart.ID, productID, variantID, quantity, cartLinePrice(product, variant)); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// UpdateCartItem updates the quantity of an item in the owner's cart, if
+// that much is in stock
+func (s *CartService) UpdateCartItem(owner CartOwner, itemID uint, quantity int) error {
+	item, err := s.getCartItem(owner, itemID)
 	if err != nil {
 		return err
 	}
+	if err := s.checkStock(item.ProductID, item.VariantID, quantity); err != nil {
+		return err
+	}
+	return s.cartRepo.UpdateCartItem(item.CartID, item.ID, quantity)
+}
 
-	// Check stock
-	if product.Stock < quantity {
-		return errors.New("not enough stock available")
+// RemoveFromCart removes an item from the owner's cart
+func (s *CartService) RemoveFromCart(owner CartOwner, itemID uint) error {
+	item, err := s.getCartItem(owner, itemID)
+	if err != nil {
+		return err
 	}
+	return s.cartRepo.RemoveFromCart(item.CartID, item.ID)
+}
 
-	// Get or create cart
-	cart, err := s.cartRepo.GetOrCreateCart(userID)
+// getCartItem retrieves an item of the owner's cart
+func (s *CartService) getCartItem(owner CartOwner, itemID uint) (*models.CartItem, error) {
+	cart, err := s.GetCart(owner)
+	if err != nil {
+		return nil, err
+	}
+	if cart.ID == 0 {
+		return nil, ErrCartItemNotFound
+	}
+	return s.cartRepo.GetCartItem(cart.ID, itemID)
+}
+
+// checkStock checks that a product exists and that quantity of it, or of
+// the chosen variant for products with variants, is available
+func (s *CartService) checkStock(productID uint, variantID *uint, quantity int) error {
+	product, variant, err := cartProduct(s.productRepo, productID, variantID)
 	if err != nil {
 		return err
 	}
+	if cartLineStock(product, variant) < quantity {
+		return ErrInsufficientStock
+	}
+	return nil
+}
 
-	// Add to cart
-	return s.cartRepo.AddToCart(cart.ID, productID, quantity)
+// cartProduct retrieves a product and, for products with variants, the
+// chosen variant
+func cartProduct(productRepo *repository.ProductRepository, productID uint, variantID *uint) (*models.Product, *models.ProductVariant, error) {
+	product, err := productRepo.GetProductByID(productID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case len(product.Variants) > 0 && variantID == nil:
+		return nil, nil, ErrVariantRequired
+	case len(product.Variants) == 0 && variantID != nil:
+		return nil, nil, ErrVariantNotFound
+	case variantID != nil:
+		variant, err := productRepo.GetVariantByID(productID, *variantID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return product, variant, nil
+	}
+	return product, nil, nil
+}
+
+// cartLineStock returns how much of a product, or of the variant if there
+// is one, is available
+func cartLineStock(product *models.Product, variant *models.ProductVariant) int {
+	if variant != nil {
+		return variant.Available()
+	}
+	return product.Available()
 }
 
-// UpdateCartItem updates the quantity of an item in the cart
-func (s *CartService) UpdateCartItem(itemID uint, quantity int) error {
-	return s.cartRepo.UpdateCartItem(itemID, quantity)
+// cartItemQuantity returns the quantity of a product, or of one of its
+// variants, already in a cart
+func cartItemQuantity(cart *models.Cart, productID uint, variantID *uint) int {
+	for _, item := range cart.Items {
+		if item.ProductID != productID {
+			continue
+		}
+		if (item.VariantID == nil) == (variantID == nil) && (variantID == nil || *item.VariantID == *variantID) {
+			return item.Quantity
+		}
+	}
+	return 0
 }
 
-// RemoveFromCart removes an item from the cart
-func (s *CartService) RemoveFromCart(itemID uint) error {
-	return s.cartRepo.RemoveFromCart(itemID)
+// cartLinePrice returns the price of a product, or of the variant if there
+// is one, in the store currency
+func cartLinePrice(product *models.Product, variant *models.ProductVariant) models.Money {
+	if variant != nil {
+		return variant.Price(product)
+	}
+	return product.Price
 }
 
-// ClearCart removes all items from a user's cart
-func (s *CartService) ClearCart(userID uint) error {
-	cart, err := s.cartRepo.GetOrCreateCart(userID)
+// CheckCart compares the items of a cart, as loaded by GetCart, with their
+// products as they are now and returns the warnings for each item, keyed by
+// item ID. Items that have not changed have no warnings.
+func (s *CartService) CheckCart(cart *models.Cart) map[uint][]CartWarning {
+	warnings := make(map[uint][]CartWarning)
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		if w := cartItemWarnings(item, &item.Product, item.Variant); len(w) > 0 {
+			warnings[item.ID] = w
+		}
+	}
+	return warnings
+}
+
+// cartItemWarnings compares a cart item with its product and variant as they
+// are now. product is nil, or deleted, when the product is gone; so is
+// variant when the item's variant is. A product that is gone only has the
+// unavailable warning. Items added before prices were kept get no price
+// warnings.
+func cartItemWarnings(item *models.CartItem, product *models.Product, variant *models.ProductVariant) []CartWarning {
+	if product == nil || product.DeletedAt.Valid ||
+		(item.VariantID != nil && (variant == nil || variant.DeletedAt.Valid)) {
+		return []CartWarning{{Code: CartWarningUnavailable}}
+	}
+	if item.VariantID == nil {
+		variant = nil
+	}
+
+	var warnings []CartWarning
+	stock := cartLineStock(product, variant)
+	switch {
+	case stock == 0:
+		return []CartWarning{{Code: CartWarningUnavailable}}
+	case stock < item.Quantity:
+		warnings = append(warnings, CartWarning{Code: CartWarningInsufficientStock, Available: stock})
+	}
+
+	price := cartLinePrice(product, variant)
+	if item.Price.Currency == price.Currency && item.Price.Amount != price.Amount {
+		code := CartWarningPriceIncreased
+		if price.Amount < item.Price.Amount {
+			code = CartWarningPriceDecreased
+		}
+		warnings = append(warnings, CartWarning{Code: code, OldPrice: item.Price, NewPrice: price})
+	}
+	return warnings
+}
+
+// AcceptCartChanges accepts the changes to the items of the owner's cart
+// that CheckCart warns about: items take on their current price, quantities
+// are lowered to what is available, and items that are no longer available
+// are removed
+func (s *CartService) AcceptCartChanges(owner CartOwner) error {
+	cart, err := s.GetCart(owner)
+	if err != nil || cart.ID == 0 {
+		return err
+	}
+
+	for itemID, warnings := range s.CheckCart(cart) {
+		for _, warning := range warnings {
+			switch warning.Code {
+			case CartWarningUnavailable:
+				err = s.cartRepo.RemoveFromCart(cart.ID, itemID)
+			case CartWarningInsufficientStock:
+				err = s.cartRepo.UpdateCartItem(cart.ID, itemID, warning.Available)
+			case CartWarningPriceIncreased, CartWarningPriceDecreased:
+				err = s.cartRepo.UpdateCartItemPrice(cart.ID, itemID, warning.NewPrice)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PriceCart works out what a cart costs in currency (the base currency if
+// empty), with its discounts, shipping and the tax of region
+func (s *CartService) PriceCart(cart *models.Cart, currency, region string) (*Pricing, error) {
+	return s.promotions.PriceCart(cart, currency, region)
+}
+
+// ApplyCoupon enters a coupon code for the owner's cart, if it applies to
+// the cart as it is. It replaces any code entered before.
+func (s *CartService) ApplyCoupon(owner CartOwner, code string) error {
+	promotion, err := s.promotions.GetCoupon(code)
 	if err != nil {
 		return err
 	}
 
+	cart, err := s.GetCart(owner)
+	if err != nil {
+		return err
+	}
+	if len(cart.Items) == 0 {
+		return fmt.Errorf("%w: the cart is empty", ErrCouponNotApplicable)
+	}
+
+	cart.CouponCode = promotion.Code
+	pricing, err := s.promotions.PriceCart(cart, "", "")
+	if err != nil {
+		return err
+	}
+	if pricing.CouponErr != nil {
+		return pricing.CouponErr
+	}
+	return s.cartRepo.SetCouponCode(cart.ID, promotion.Code)
+}
+
+// RemoveCoupon removes the coupon code from the owner's cart
+func (s *CartService) RemoveCoupon(owner CartOwner) error {
+	cart, err := s.GetCart(owner)
+	if err != nil || cart.ID == 0 {
+		return err
+	}
+	return s.cartRepo.SetCouponCode(cart.ID, "")
+}
+
+// ClearCart removes all items and the coupon code from the owner's cart
+func (s *CartService) ClearCart(owner CartOwner) error {
+	cart, err := s.GetCart(owner)
+	if err != nil || cart.ID == 0 {
+		return err
+	}
+
 	return s.cartRepo.ClearCart(cart.ID)
 }
+
+// MergeGuestCart moves the items of a guest cart into a user's cart when
+// the guest signs in, then deletes the guest cart. A product in both carts
+// gets the sum of both quantities, limited to what is available but never
+// less than the user already had, and keeps the price the user added it at;
+// products that are gone, or of which nothing is available, are left out.
+// The guest's coupon code is kept if the user had none.
+func (s *CartService) MergeGuestCart(userID uint, token string) error {
+	return s.db.Transaction(func(tx *repository.Database) error {
+		cartRepo := repository.NewCartRepository(tx)
+		productRepo := repository.NewProductRepository(tx)
+
+		guest, err := cartRepo.GetGuestCartForUpdate(token)
+		if errors.Is(err, repository.ErrCartNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := cartRepo.GetOrCreateCart(userID); err != nil {
+			return err
+		}
+		cart, err := cartRepo.GetCartForUpdate(userID)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range guest.Items {
+			var existing *models.CartItem
+			for i := range cart.Items {
+				if sameCartLine(&cart.Items[i], &item) {
+					existing = &cart.Items[i]
+					break
+				}
+			}
+
+			product, variant, err := cartProduct(productRepo, item.ProductID, item.VariantID)
+			switch {
+			case errors.Is(err, ErrProductNotFound), errors.Is(err, ErrVariantNotFound), errors.Is(err, ErrVariantRequired):
+				continue
+			case err != nil:
+				return err
+			}
+			available := cartLineStock(product, variant)
+
+			quantity := item.Quantity
+			if existing != nil {
+				quantity += existing.Quantity
+			}
+			quantity = min(quantity, available)
+
+			switch {
+			case existing != nil && quantity > existing.Quantity:
+				err = cartRepo.UpdateCartItem(cart.ID, existing.ID, quantity)
+			case existing == nil && quantity > 0:
+				err = cartRepo.AddToCart(cart.ID, item.ProductID, item.VariantID, quantity, item.Price)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if cart.CouponCode == "" && guest.CouponCode != "" {
+			if err := cartRepo.SetCouponCode(cart.ID, guest.CouponCode); err != nil {
+				return err
+			}
+		}
+
+		return cartRepo.DeleteCart(guest.ID)
+	})
+}
+
+// sameCartLine reports whether two cart items are for the same product or
+// variant
+func sameCartLine(a, b *models.CartItem) bool {
+	if a.ProductID != b.ProductID || (a.VariantID == nil) != (b.VariantID == nil) {
+		return false
+	}
+	return a.VariantID == nil || *a.VariantID == *b.VariantID
+}
+
+// CleanupGuestCarts deletes the guest carts that have not changed for the
+// guest cart TTL and returns how many it deleted
+func (s *CartService) CleanupGuestCarts() (int64, error) {
+	before := time.Now().Add(-s.guestCartTTL)
+
+	var deleted int64
+	for {
+		n, err := s.cartRepo.DeleteIdleGuestCarts(before, guestCartCleanupBatch)
+		deleted += n
+		if err != nil || n < guestCartCleanupBatch {
+			return deleted, err
+		}
+	}
+}
+
+// RunGuestCartCleanup deletes idle guest carts every interval until ctx is
+// done
+func (s *CartService) RunGuestCartCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.CleanupGuestCarts()
+			if err != nil {
+				log.Printf("Failed to clean up guest carts: %v", err)
+			}
+			if deleted > 0 {
+				log.Printf("Deleted %d idle guest carts", deleted)
+			}
+		}
+	}
+}
+
+// newGuestCartToken returns a random token for a new guest cart
+func newGuestCartToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate cart token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"store/internal/models"
+	"store/internal/repository"
+	"strings"
+)
+
+var (
+	// ErrCategoryNotFound is returned when a category does not exist
+	ErrCategoryNotFound = repository.ErrCategoryNotFound
+	// ErrInvalidCategory is returned for a category that cannot be saved as
+	// given, e.g. one nested under itself
+	ErrInvalidCategory = errors.New("invalid category")
+	// ErrCategoryInUse is returned when deleting a category that still has
+	// subcategories or products
+	ErrCategoryInUse = errors.New("category is in use")
+)
+
+// slugPattern matches valid category slugs
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// CategoryService provides category-related operations
+type CategoryService struct {
+	categoryRepo *repository.CategoryRepository
+}
+
+// NewCategoryService creates a new CategoryService
+func NewCategoryService(categoryRepo *repository.CategoryRepository) *CategoryService {
+	return &CategoryService{
+		categoryRepo: categoryRepo,
+	}
+}
+
+// GetCategoryTree retrieves all categories as a tree: the top-level
+// categories, each with its subcategories in Children
+func (s *CategoryService) GetCategoryTree() ([]models.Category, error) {
+	categories, err := s.categoryRepo.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var attach func(categories []models.Category)
+	attach = func(categories []models.Category) {
+		for i := range categories {
+			categories[i].Children = children[categories[i].ID]
+			attach(categories[i].Children)
+		}
+	}
+	attach(roots)
+
+	return roots, nil
+}
+
+// GetCategoryByID retrieves a category by ID
+func (s *CategoryService) GetCategoryByID(id uint) (*models.Category, error) {
+	return s.categoryRepo.GetCategoryByID(id)
+}
+
+// CreateCategory creates a new category. A slug is made from the name if
+// none is given.
+func (s *CategoryService) CreateCategory(category *models.Category) error {
+	if err := s.prepare(category); err != nil {
+		return err
+	}
+	return s.categoryRepo.CreateCategory(category)
+}
+
+// UpdateCategory updates an existing category. A category cannot be moved
+// under itself or one of its own subcategories.
+func (s *CategoryService) UpdateCategory(category *models.Category) error {
+	if err := s.prepare(category); err != nil {
+		return err
+	}
+
+	if category.ParentID != nil {
+		if *category.ParentID == category.ID {
+			return fmt.Errorf("%w: a category cannot be its own parent", ErrInvalidCategory)
+		}
+		descendants, err := s.categoryRepo.GetDescendantIDs(category.ID)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(descendants, *category.ParentID) {
+			return fmt.Errorf("%w: a category cannot be moved under its own subcategory", ErrInvalidCategory)
+		}
+	}
+
+	return s.categoryRepo.UpdateCategory(category)
+}
+
+// DeleteCategory deletes a category that has no subcategories and no
+// products
+func (s *CategoryService) DeleteCategory(id uint) error {
+	if _, err := s.categoryRepo.GetCategoryByID(id); err != nil {
+		return err
+	}
+
+	children, err := s.categoryRepo.CountChildren(id)
+	if err != nil {
+		return err
+	}
+	if children > 0 {
+		return fmt.Errorf("%w: it has %d subcategories", ErrCategoryInUse, children)
+	}
+
+	products, err := s.categoryRepo.CountProducts(id)
+	if err != nil {
+		return err
+	}
+	if products > 0 {
+		return fmt.Errorf("%w: it has %d products", ErrCategoryInUse, products)
+	}
+
+	return s.categoryRepo.DeleteCategory(id)
+}
+
+// prepare normalises a category's name and slug and checks its parent
+func (s *CategoryService) prepare(category *models.Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidCategory)
+	}
+
+	category.Slug = strings.TrimSpace(category.Slug)
+	if category.Slug == "" {
+		category.Slug = Slugify(category.Name)
+	}
+	if !slugPattern.MatchString(category.Slug) {
+		return fmt.Errorf("%w: slug %q must be lowercase letters, digits and dashes", ErrInvalidCategory, category.Slug)
+	}
+	existing, err := s.categoryRepo.GetCategoryBySlug(category.Slug)
+	if err == nil && existing.ID != category.ID {
+		return fmt.Errorf("%w: slug %q is already in use", ErrInvalidCategory, category.Slug)
+	}
+	if err != nil && !errors.Is(err, repository.ErrCategoryNotFound) {
+		return err
+	}
+
+	if category.ParentID != nil {
+		if _, err := s.categoryRepo.GetCategoryByID(*category.ParentID); err != nil {
+			if errors.Is(err, repository.ErrCategoryNotFound) {
+				return fmt.Errorf("%w: parent category not found", ErrInvalidCategory)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cyrillicToLatin transliterates Russian letters for slugs
+var cyrillicToLatin = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ы': "y", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// Slugify makes a URL slug from a name, e.g. "Мужская обувь" becomes
+// "muzhskaya-obuv"
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case cyrillicToLatin[r] != "":
+			b.WriteString(cyrillicToLatin[r])
+			dash = false
+		case r == 'ъ' || r == 'ь':
+			// Hard and soft signs are dropped
+		default:
+			if !dash && b.Len() > 0 {
+				b.WriteByte('-')
+				dash = true
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"store/internal/models"
+	"store/internal/repository"
+	"strings"
+)
+
+// ErrUnsupportedCurrency is returned for a currency without an exchange rate
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// CurrencyService prices products in the currencies the store sells in.
+// Product prices are stored in the base currency; a price in another
+// currency is the product's fixed price override for it if there is one,
+// and the base price converted at the current exchange rate otherwise.
+type CurrencyService struct {
+	currencyRepo *repository.CurrencyRepository
+	baseCurrency string
+}
+
+// NewCurrencyService creates a new CurrencyService
+func NewCurrencyService(currencyRepo *repository.CurrencyRepository, baseCurrency string) *CurrencyService {
+	return &CurrencyService{
+		currencyRepo: currencyRepo,
+		baseCurrency: strings.ToUpper(baseCurrency),
+	}
+}
+
+// BaseCurrency returns the currency product prices are stored in
+func (s *CurrencyService) BaseCurrency() string {
+	return s.baseCurrency
+}
+
+// Resolve normalises a requested currency code. An empty code means the
+// base currency.
+func (s *CurrencyService) Resolve(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" || currency == s.baseCurrency {
+		return s.baseCurrency, nil
+	}
+	if _, err := s.currencyRepo.GetRate(currency); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+	return currency, nil
+}
+
+// Rate returns the exchange rate from the base currency to currency, both
+// parsed and as the decimal string stored in the database
+func (s *CurrencyService) Rate(currency string) (*big.Rat, string, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == s.baseCurrency {
+		return big.NewRat(1, 1), "1", nil
+	}
+
+	rate, err := s.currencyRepo.GetRate(currency)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedCurrency, currency)
+	}
+	r, ok := new(big.Rat).SetString(rate.Rate)
+	if !ok {
+		return nil, "", fmt.Errorf("invalid exchange rate for %s: %s", currency, rate.Rate)
+	}
+	return r, rate.Rate, nil
+}
+
+// Price returns the price of a product, or of one of its variants, in
+// currency. A variant with its own price is converted from that price,
+// since the product's fixed prices in other currencies do not apply to it.
+func (s *CurrencyService) Price(product *models.Product, variant *models.ProductVariant, currency string) (models.Money, error) {
+	if variant != nil && variant.PriceAmount != nil {
+		return s.Convert(variant.Price(product), currency)
+	}
+
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == product.Price.Currency {
+		return product.Price, nil
+	}
+	for _, price := range product.Prices {
+		if price.Currency == currency {
+			return price.Money(), nil
+		}
+	}
+
+	return s.Convert(product.Price, currency)
+}
+
+// Convert converts an amount in the base currency to currency at the
+// current exchange rate
+func (s *CurrencyService) Convert(amount models.Money, currency string) (models.Money, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == amount.Currency {
+		return amount, nil
+	}
+
+	rate, _, err := s.Rate(currency)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return amount.Convert(currency, rate), nil
+}
+
+// BasePriceRange converts price filter bounds in currency's minor units to
+// bounds on the base price, so that they keep exactly the products whose
+// converted price lies within them. Zero still means no bound. Fixed prices
+// in currency are not taken into account.
+func (s *CurrencyService) BasePriceRange(minPrice, maxPrice int64, currency string) (int64, int64, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == s.baseCurrency {
+		return minPrice, maxPrice, nil
+	}
+
+	rate, _, err := s.Rate(currency)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// perUnit is the number of minor units of currency per minor unit of
+	// the base currency
+	perUnit := new(big.Rat).Mul(rate, new(big.Rat).SetFrac(
+		pow10(models.MinorUnits(currency)), pow10(models.MinorUnits(s.baseCurrency))))
+
+	// A base price p converts to round(p * perUnit), which is at least min
+	// when p >= (min - 1/2) / perUnit and at most max when
+	// p < (max + 1/2) / perUnit
+	half := big.NewRat(1, 2)
+	if minPrice > 0 {
+		bound := new(big.Rat).Sub(new(big.Rat).SetInt64(minPrice), half)
+		minPrice = ceilRat(bound.Quo(bound, perUnit))
+	}
+	if maxPrice > 0 {
+		bound := new(big.Rat).Add(new(big.Rat).SetInt64(maxPrice), half)
+		// A maximum below the smallest base price still has to be a maximum
+		maxPrice = max(ceilRat(bound.Quo(bound, perUnit))-1, 1)
+	}
+	return minPrice, maxPrice, nil
+}
+
+// ceilRat rounds a positive r up to the nearest integer
+func ceilRat(r *big.Rat) int64 {
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if rem.Sign() > 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	return quo.Int64()
+}
+
+// pow10 returns 10 to the power of n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// GetRates returns all exchange rates
+func (s *CurrencyService) GetRates() ([]models.ExchangeRate, error) {
+	return s.currencyRepo.GetRates()
+}
+
+// SetRates loads exchange rates, given as decimal strings keyed by
+// currency code. Rates for currencies not listed are left unchanged.
+func (s *CurrencyService) SetRates(rates map[string]string) error {
+	var exchangeRates []models.ExchangeRate
+	for currency, rate := range rates {
+		currency = strings.ToUpper(currency)
+		if !models.ValidCurrency(currency) {
+			return fmt.Errorf("invalid currency code: %s", currency)
+		}
+		if currency == s.baseCurrency {
+			return fmt.Errorf("cannot set a rate for the base currency %s", currency)
+		}
+
+		r, ok := new(big.Rat).SetString(rate)
+		if !ok || r.Sign() <= 0 {
+			return fmt.Errorf("invalid rate for %s: %s", currency, rate)
+		}
+
+		exchangeRates = append(exchangeRates, models.ExchangeRate{
+			Currency: currency,
+			Rate:     r.FloatString(10),
+		})
+	}
+
+	return s.currencyRepo.SaveRates(exchangeRates)
+}
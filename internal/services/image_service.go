@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"store/internal/models"
+	"store/internal/repository"
+	"store/pkg/imaging"
+)
+
+const (
+	// MaxImageSize is the largest image file that can be uploaded, in bytes
+	MaxImageSize = 10 << 20
+	// maxImagePixels is the largest image that will be decoded, so that a
+	// small file cannot claim a size that exhausts memory
+	maxImagePixels = 40_000_000
+)
+
+// thumbnailSizes are the sizes thumbnails are made in, as the longest side
+// in pixels
+var thumbnailSizes = map[string]int{
+	models.ImageSmall:  150,
+	models.ImageMedium: 400,
+	models.ImageLarge:  800,
+}
+
+var (
+	// ErrImageNotFound is returned when a product image does not exist
+	ErrImageNotFound = repository.ErrImageNotFound
+	// ErrImageTooLarge is returned for an upload over MaxImageSize or with
+	// too many pixels
+	ErrImageTooLarge = errors.New("image is too large")
+	// ErrUnsupportedImage is returned for an upload that is not a JPEG, PNG
+	// or WebP image
+	ErrUnsupportedImage = errors.New("image must be JPEG, PNG or WebP")
+	// ErrInvalidImageOrder is returned when a new gallery order does not list
+	// each of the product's images exactly once
+	ErrInvalidImageOrder = errors.New("image order must list every image of the product once")
+)
+
+// FileStorage stores uploaded files
+type FileStorage interface {
+	// Put stores the contents of r under key
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Delete removes the file under key
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL of the file under key
+	URL(key string) string
+}
+
+// ImageService provides operations on product image galleries
+type ImageService struct {
+	imageRepo   *repository.ImageRepository
+	productRepo *repository.ProductRepository
+	storage     FileStorage
+}
+
+// NewImageService creates a new ImageService
+func NewImageService(imageRepo *repository.ImageRepository, productRepo *repository.ProductRepository, storage FileStorage) *ImageService {
+	return &ImageService{
+		imageRepo:   imageRepo,
+		productRepo: productRepo,
+		storage:     storage,
+	}
+}
+
+// UploadImage adds an image to the end of a product's gallery. The upload
+// is checked to be a JPEG, PNG or WebP image no larger than MaxImageSize,
+// turned upright, re-encoded without its metadata and stored along with
+// its thumbnails.
+func (s *ImageService) UploadImage(ctx context.Context, productID uint, r io.Reader, altText string) (*models.ProductImage, error) {
+	if _, err := s.productRepo.GetProductByID(productID); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageSize {
+		return nil, fmt.Errorf("%w: the limit is %d MB", ErrImageTooLarge, MaxImageSize>>20)
+	}
+
+	img, format, err := imaging.Decode(data, maxImagePixels)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrTooManyPixels):
+			return nil, fmt.Errorf("%w: %v", ErrImageTooLarge, err)
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			return nil, ErrUnsupportedImage
+		}
+		return nil, err
+	}
+	format = imaging.OutputFormat(img, format)
+
+	prefix, err := newImagePrefix(productID)
+	if err != nil {
+		return nil, err
+	}
+
+	image := &models.ProductImage{
+		ProductID: productID,
+		AltText:   altText,
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+		Files:     make(map[string]string, len(thumbnailSizes)+1),
+		URLs:      make(map[string]string, len(thumbnailSizes)+1),
+	}
+
+	versions := map[string]int{models.ImageOriginal: 0}
+	for name, size := range thumbnailSizes {
+		versions[name] = size
+	}
+	for name, size := range versions {
+		version := img
+		if size > 0 {
+			version = imaging.Fit(img, size)
+		}
+
+		var buf bytes.Buffer
+		if err := imaging.Encode(&buf, version, format); err != nil {
+			s.deleteFiles(ctx, image)
+			return nil, err
+		}
+
+		key := prefix + "/" + name + imaging.Extension(format)
+		if err := s.storage.Put(ctx, key, &buf, imaging.ContentType(format)); err != nil {
+			s.deleteFiles(ctx, image)
+			return nil, fmt.Errorf("failed to store image: %w", err)
+		}
+		image.Files[name] = key
+		image.URLs[name] = s.storage.URL(key)
+	}
+
+	if err := s.imageRepo.CreateImage(image); err != nil {
+		s.deleteFiles(ctx, image)
+		return nil, err
+	}
+	return image, nil
+}
+
+// GetImages retrieves the gallery of a product
+func (s *ImageService) GetImages(productID uint) ([]models.ProductImage, error) {
+	return s.imageRepo.GetImages(productID)
+}
+
+// ReorderImages puts a product's gallery in the order of ids, which must
+// list each of its images once. The first image becomes the product's
+// main image.
+func (s *ImageService) ReorderImages(productID uint, ids []uint) ([]models.ProductImage, error) {
+	if _, err := s.productRepo.GetProductByID(productID); err != nil {
+		return nil, err
+	}
+
+	images, err := s.imageRepo.GetImages(productID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != len(images) {
+		return nil, ErrInvalidImageOrder
+	}
+	for _, image := range images {
+		if !slices.Contains(ids, image.ID) {
+			return nil, ErrInvalidImageOrder
+		}
+	}
+
+	if err := s.imageRepo.ReorderImages(productID, ids); err != nil {
+		return nil, err
+	}
+	return s.imageRepo.GetImages(productID)
+}
+
+// DeleteImage removes an image from a product's gallery and deletes its
+// files
+func (s *ImageService) DeleteImage(ctx context.Context, productID, imageID uint) error {
+	image, err := s.imageRepo.GetImageByID(productID, imageID)
+	if err != nil {
+		return err
+	}
+	if err := s.imageRepo.DeleteImage(productID, imageID); err != nil {
+		return err
+	}
+	s.deleteFiles(ctx, image)
+	return nil
+}
+
+// deleteFiles deletes the stored files of an image. Failures are only
+// logged: a leftover file is harmless, and the image is gone either way.
+func (s *ImageService) deleteFiles(ctx context.Context, image *models.ProductImage) {
+	for _, key := range image.Files {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete image file %s: %v", key, err)
+		}
+	}
+}
+
+// newImagePrefix returns a new, unguessable storage prefix for the files
+// of a product image
+func newImagePrefix(productID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("products/%d/%s", productID, hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"store/internal/models"
+	"store/internal/repository"
+	"store/pkg/notify"
+)
+
+// Notifier delivers notifications to customers and to the store's staff
+type Notifier interface {
+	// Notify sends or queues a notification
+	Notify(ctx context.Context, notification notify.Notification) error
+}
+
+// OutboxNotifier queues notifications in the outbox table, for a mailer or
+// other worker to deliver
+type OutboxNotifier struct {
+	notificationRepo *repository.NotificationRepository
+}
+
+// NewOutboxNotifier creates a new OutboxNotifier
+func NewOutboxNotifier(notificationRepo *repository.NotificationRepository) *OutboxNotifier {
+	return &OutboxNotifier{
+		notificationRepo: notificationRepo,
+	}
+}
+
+// Notify adds the notification to the outbox
+func (n *OutboxNotifier) Notify(_ context.Context, notification notify.Notification) error {
+	row := &models.Notification{
+		Kind:    notification.Kind,
+		Email:   notification.Email,
+		Subject: notification.Subject,
+		Body:    notification.Body,
+	}
+	if notification.UserID != 0 {
+		row.UserID = &notification.UserID
+	}
+	return n.notificationRepo.CreateNotification(row)
+}
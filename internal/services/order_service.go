@@ -1,100 +1,331 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"log"
+	"slices"
 	"store/internal/models"
 	"store/internal/repository"
+	"store/pkg/payment"
+	"time"
 )
 
+var (
+	// ErrOrderNotFound is returned when an order does not exist
+	ErrOrderNotFound = repository.ErrOrderNotFound
+	// ErrUnknownOrderStatus is returned for a status that does not exist
+	ErrUnknownOrderStatus = errors.New("unknown order status")
+	// ErrInvalidStatusTransition is returned when an order cannot move from
+	// its current status to the requested one
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	// ErrOrderNotCancellable is returned when a customer tries to cancel an
+	// order that has already shipped or been closed
+	ErrOrderNotCancellable = errors.New("order can no longer be cancelled")
+	// ErrRefundFailed is returned when the payment provider did not accept a
+	// refund; the refund stays due and is requested again later
+	ErrRefundFailed = errors.New("refund failed")
+)
+
+// customerCancellableStatuses are the statuses in which customers may cancel
+// their own orders, i.e. before the order has shipped
+var customerCancellableStatuses = []models.OrderStatus{
+	models.OrderStatusPending,
+	models.OrderStatusPaymentFailed,
+	models.OrderStatusProcessing,
+}
+
+// orderStatusTransitions lists the statuses each order status may move to
+var orderStatusTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending: {
+		models.OrderStatusProcessing,
+		models.OrderStatusPaymentFailed,
+		models.OrderStatusCancelled,
+	},
+	models.OrderStatusPaymentFailed: {
+		models.OrderStatusProcessing,
+		models.OrderStatusCancelled,
+	},
+	models.OrderStatusProcessing: {
+		models.OrderStatusShipped,
+		models.OrderStatusCancelled,
+		models.OrderStatusRefunded,
+	},
+	models.OrderStatusShipped: {
+		models.OrderStatusDelivered,
+		models.OrderStatusReturned,
+	},
+	models.OrderStatusDelivered: {
+		models.OrderStatusReturned,
+	},
+	models.OrderStatusReturned: {
+		models.OrderStatusRefunded,
+	},
+	// A paid order that was cancelled is refunded afterwards
+	models.OrderStatusCancelled: {
+		models.OrderStatusRefunded,
+	},
+	models.OrderStatusRefunded: {},
+}
+
+// canTransition reports whether an order may move from one status to another
+func canTransition(from, to models.OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
 // OrderService provides order-related operations
 type OrderService struct {
-	orderRepo   *repository.OrderRepository
-	cartRepo    *repository.CartRepository
-	productRepo *repository.ProductRepository
+	db               *repository.Database
+	orderRepo        *repository.OrderRepository
+	cartRepo         *repository.CartRepository
+	productRepo      *repository.ProductRepository
+	paymentService   *PaymentService
+	currencyService  *CurrencyService
+	promotionService *PromotionService
+	// reservationTimeout is how long stock stays reserved for an unpaid order
+	reservationTimeout time.Duration
 }
 
 // NewOrderService creates a new OrderService
 func NewOrderService(
+	db *repository.Database,
 	orderRepo *repository.OrderRepository,
 	cartRepo *repository.CartRepository,
 	productRepo *repository.ProductRepository,
+	paymentService *PaymentService,
+	currencyService *CurrencyService,
+	promotionService *PromotionService,
+	reservationTimeout time.Duration,
 ) *OrderService {
 	return &OrderService{
-		orderRepo:   orderRepo,
-		cartRepo:    cartRepo,
-		productRepo: productRepo,
+		db:                 db,
+		orderRepo:          orderRepo,
+		cartRepo:           cartRepo,
+		productRepo:        productRepo,
+		paymentService:     paymentService,
+		currencyService:    currencyService,
+		promotionService:   promotionService,
+		reservationTimeout: reservationTimeout,
 	}
 }
 
-// CreateOrder creates a new order from the user's cart
-func (s *OrderService) CreateOrder(userID uint, address, shippingType string) (*models.Order, error) {
-	// Get user's cart
-	cart, err := s.cartRepo.GetOrCreateCart(userID)
+// CreateOrder creates a new order from the user's cart.
+// The whole checkout runs in one transaction: the cart and every product in
+// it are locked, stock is checked and reserved for the order, the order is
+// saved and the cart is cleared. Any failure rolls everything back.
+// Reserved stock is taken out of stock when the order is paid, and given
+// back if the order is cancelled or not paid before the reservation expires.
+// The order is priced in currency (the base currency if empty) and records
+// the exchange rate it was placed at. It gets the discounts of the
+// promotions that apply to it and of the cart's coupon, is charged the
+// shipping cost and records the tax of the region it ships to, which must
+// have tax rates.
+func (s *OrderService) CreateOrder(userID uint, address, region, shippingType, currency string) (*models.Order, error) {
+	currency, err := s.currencyService.Resolve(currency)
 	if err != nil {
 		return nil, err
 	}
-
-	// Check if cart is empty
-	if len(cart.Items) == 0 {
-		return nil, errors.New("cart is empty")
+	region, err = ResolveTaxRegion(region)
+	if err != nil {
+		return nil, err
 	}
+	if region == "" {
+		return nil, fmt.Errorf("%w: region is required", ErrInvalidTaxRegion)
+	}
+	_, rate, err := s.currencyService.Rate(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var order *models.Order
 
-	// Calculate total amount and create order items
-	var totalAmount float64
-	var orderItems []models.OrderItem
+	err = s.db.Transaction(func(tx *repository.Database) error {
+		cartRepo := repository.NewCartRepository(tx)
+		productRepo := repository.NewProductRepository(tx)
+		orderRepo := repository.NewOrderRepository(tx)
 
-	for _, item := range cart.Items {
-		// Get current product data
-		product, err := s.productRepo.GetProductByID(item.ProductID)
+		// Lock the user's cart so the same cart cannot be checked out twice
+		cart, err := cartRepo.GetCartForUpdate(userID)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		// Check stock
-		if product.Stock < item.Quantity {
-			return nil, errors.New("not enough stock for product: " + product.Name)
+		// Check if cart is empty
+		if len(cart.Items) == 0 {
+			return errors.New("cart is empty")
 		}
 
-		// Create order item
-		orderItem := models.OrderItem{
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     product.Price,
+		// Lock all products in the cart
+		productIDs := make([]uint, 0, len(cart.Items))
+		for _, item := range cart.Items {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		products, err := productRepo.GetProductsForUpdate(productIDs)
+		if err != nil {
+			return err
+		}
+		productsByID := make(map[uint]*models.Product, len(products))
+		for i := range products {
+			productsByID[products[i].ID] = &products[i]
 		}
 
-		orderItems = append(orderItems, orderItem)
-		totalAmount += product.Price * float64(item.Quantity)
+		// Lock the chosen variants too, after the products
+		var variantIDs []uint
+		for _, item := range cart.Items {
+			if item.VariantID != nil {
+				variantIDs = append(variantIDs, *item.VariantID)
+			}
+		}
+		variantsByID := make(map[uint]*models.ProductVariant, len(variantIDs))
+		if len(variantIDs) > 0 {
+			variants, err := productRepo.GetVariantsForUpdate(variantIDs)
+			if err != nil {
+				return err
+			}
+			for i := range variants {
+				variantsByID[variants[i].ID] = &variants[i]
+			}
+		}
+		variantCounts, err := productRepo.CountVariants(productIDs)
+		if err != nil {
+			return err
+		}
+
+		// Calculate total amount and create order items
+		total := models.NewMoney(0, currency)
+		var orderItems []models.OrderItem
+
+		for _, item := range cart.Items {
+			product, ok := productsByID[item.ProductID]
+			if !ok {
+				return fmt.Errorf("%w: an item is no longer available", ErrCartChanged)
+			}
+
+			// Products with variants are sold by variant
+			var variant *models.ProductVariant
+			if item.VariantID != nil {
+				variant, ok = variantsByID[*item.VariantID]
+				switch {
+				case !ok:
+					return fmt.Errorf("%w: %s", ErrCartChanged, product.Name)
+				case variant.ProductID != product.ID:
+					return fmt.Errorf("%w: %s", ErrVariantNotFound, product.Name)
+				}
+			} else if variantCounts[product.ID] > 0 {
+				return fmt.Errorf("%w: %s", ErrVariantRequired, product.Name)
+			}
+
+			// Check that the price and the stock not already reserved for
+			// other orders are still what the shopper saw
+			if len(cartItemWarnings(&item, product, variant)) > 0 {
+				return fmt.Errorf("%w: %s", ErrCartChanged, product.Name)
+			}
 
-		// Update stock
-		product.Stock -= item.Quantity
-		if err := s.productRepo.UpdateProduct(product); err != nil {
-			return nil, err
+			price, err := s.currencyService.Price(product, variant, currency)
+			if err != nil {
+				return err
+			}
+
+			// Create order item
+			orderItem := models.OrderItem{
+				ProductID:       item.ProductID,
+				ProductName:     product.Name,
+				ProductSKU:      product.SKU,
+				ProductImageURL: product.ImageURL,
+				Quantity:        item.Quantity,
+				Price:           price,
+			}
+			if variant != nil {
+				orderItem.VariantID = &variant.ID
+				orderItem.VariantOptions = variant.Options
+				if variant.SKU != "" {
+					orderItem.ProductSKU = variant.SKU
+				}
+			}
+
+			orderItems = append(orderItems, orderItem)
+			total = total.Add(price.Mul(item.Quantity))
+
+			// Hold the stock until the order is paid
+			if variant != nil {
+				err = productRepo.ReserveVariantStock(product.ID, variant.ID, item.Quantity)
+				variant.Reserved += item.Quantity
+			} else {
+				err = productRepo.ReserveStock(product.ID, item.Quantity)
+			}
+			if err != nil {
+				if errors.Is(err, repository.ErrInsufficientStock) {
+					return errors.New("not enough stock for product: " + product.Name)
+				}
+				return err
+			}
+			product.Reserved += item.Quantity
 		}
-	}
 
-	// Create order
-	order := &models.Order{
-		UserID:       userID,
-		TotalAmount:  totalAmount,
-		Status:       models.OrderStatusPending,
-		Address:      address,
-		ShippingType: shippingType,
-	}
+		// Create order
+		order = &models.Order{
+			UserID:       userID,
+			Items:        orderItems,
+			Total:        total,
+			ExchangeRate: rate,
+			Status:       models.OrderStatusPending,
+			Address:      address,
+			TaxRegion:    region,
+			ShippingType: shippingType,
+		}
 
-	// Save order
-	if err := s.orderRepo.CreateOrder(order); err != nil {
-		return nil, err
-	}
+		// Apply promotions and the coupon, and add shipping and tax
+		if err := s.promotionService.applyToOrder(tx, order, productsByID, cart.CouponCode); err != nil {
+			return err
+		}
 
-	// Add items to order
-	for i := range orderItems {
-		orderItems[i].OrderID = order.ID
-	}
+		// Save order and its items
+		if err := orderRepo.CreateOrder(order); err != nil {
+			return err
+		}
+
+		// Record what is reserved for the order, and until when
+		expiresAt := time.Now().Add(s.reservationTimeout)
+		reservations := make([]models.StockReservation, 0, len(order.Items))
+		for _, item := range order.Items {
+			reservations = append(reservations, models.StockReservation{
+				OrderID:   order.ID,
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Quantity:  item.Quantity,
+				ExpiresAt: expiresAt,
+			})
+		}
+		if err := repository.NewReservationRepository(tx).CreateReservations(reservations); err != nil {
+			return err
+		}
+
+		// Start the order's status history
+		err = orderRepo.AddStatusEvent(&models.OrderStatusEvent{
+			OrderID:  order.ID,
+			ToStatus: order.Status,
+			ActorID:  &userID,
+			Reason:   "order placed",
+		})
+		if err != nil {
+			return err
+		}
 
-	order.Items = orderItems
+		// Attach the locked products so the response carries product details
+		for i := range order.Items {
+			order.Items[i].Product = *productsByID[order.Items[i].ProductID]
+		}
 
-	// Clear cart
-	if err := s.cartRepo.ClearCart(cart.ID); err != nil {
+		// Clear cart
+		return cartRepo.ClearCart(cart.ID)
+	})
+	if err != nil {
 		return nil, err
 	}
 
@@ -111,24 +342,480 @@ func (s *OrderService) GetUserOrders(userID uint) ([]models.Order, error) {
 	return s.orderRepo.GetUserOrders(userID)
 }
 
-// UpdateOrderStatus updates the status of an order
-func (s *OrderService) UpdateOrderStatus(orderID uint, status models.OrderStatus) error {
-	return s.orderRepo.UpdateOrderStatus(orderID, status)
+// GetStatusHistory gets the status changes of an order, oldest first
+func (s *OrderService) GetStatusHistory(orderID uint) ([]models.OrderStatusEvent, error) {
+	return s.orderRepo.GetStatusHistory(orderID)
 }
 
-// ProcessPayment processes a payment for an order
-func (s *OrderService) ProcessPayment(orderID uint, paymentID, paymentType string) error {
-	// Get order - use _ to ignore the actual order value
-	_, err := s.orderRepo.GetOrderByID(orderID)
+// UpdateOrderStatus moves an order to a new status on behalf of actorID.
+// The move must be allowed by the order status transition table; cancelling
+// an order puts its items back in stock and, if the order was already paid,
+// refunds it as CancelOrder does.
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID uint, status models.OrderStatus, actorID uint, reason string) error {
+	if !status.Valid() {
+		return fmt.Errorf("%w: %s", ErrUnknownOrderStatus, status)
+	}
+
+	err := s.db.Transaction(func(tx *repository.Database) error {
+		order, err := repository.NewOrderRepository(tx).GetOrderForUpdate(orderID)
+		if err != nil {
+			return err
+		}
+		return s.transition(tx, order, status, &actorID, reason)
+	})
 	if err != nil {
 		return err
 	}
 
-	// Update payment info
-	if err := s.orderRepo.UpdatePaymentInfo(orderID, paymentID, paymentType); err != nil {
+	s.refundIfDue(ctx, orderID)
+	return nil
+}
+
+// CancelOrder cancels an order on behalf of its owner. Orders can be
+// cancelled until they ship; the items go back in stock and, if the order was
+// already paid, a refund is requested from the payment provider once the
+// cancellation is saved. A refund the provider does not accept leaves the
+// order cancelled with RefundDue and RefundError set, and is requested again
+// by RunRefundRetrier.
+func (s *OrderService) CancelOrder(ctx context.Context, userID, orderID uint) (*models.Order, error) {
+	err := s.db.Transaction(func(tx *repository.Database) error {
+		order, err := repository.NewOrderRepository(tx).GetOrderForUpdate(orderID)
+		if err != nil {
+			return err
+		}
+
+		// Customers only see their own orders
+		if order.UserID != userID {
+			return ErrOrderNotFound
+		}
+
+		if !slices.Contains(customerCancellableStatuses, order.Status) {
+			return fmt.Errorf("%w: order is %s", ErrOrderNotCancellable, order.Status)
+		}
+
+		return s.transition(tx, order, models.OrderStatusCancelled, &userID, "cancelled by customer")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.refundIfDue(ctx, orderID)
+	return s.orderRepo.GetOrderByID(orderID)
+}
+
+// refundIfDue requests the refund of an order if one is due. A failure is
+// recorded on the order and logged; RunRefundRetrier tries again.
+func (s *OrderService) refundIfDue(ctx context.Context, orderID uint) {
+	if err := s.requestRefund(ctx, orderID); err != nil {
+		log.Printf("Failed to refund order %d, will retry: %v", orderID, err)
+	}
+}
+
+// requestRefund asks the payment provider to refund an order whose refund
+// is due, and records the outcome. The order moves to refunded once the
+// provider confirms the refund through the webhook. Refund requests are
+// idempotent, so asking twice for the same order is safe.
+func (s *OrderService) requestRefund(ctx context.Context, orderID uint) error {
+	order, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
 		return err
 	}
+	if !order.RefundDue {
+		return nil
+	}
+
+	if err := s.paymentService.RefundPayment(ctx, order); err != nil {
+		if err := s.orderRepo.UpdateRefundState(order.ID, true, err.Error()); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrRefundFailed, err)
+	}
+	return s.orderRepo.UpdateRefundState(order.ID, false, "")
+}
+
+// refundRetryBatch is the number of orders handled per batch by
+// RetryRefunds
+const refundRetryBatch = 100
+
+// RetryRefunds requests the refunds that are still due. It returns the
+// number of refunds the provider accepted.
+func (s *OrderService) RetryRefunds(ctx context.Context) (int, error) {
+	orderIDs, err := s.orderRepo.GetRefundDueOrderIDs(refundRetryBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	refunded := 0
+	for _, orderID := range orderIDs {
+		err := s.requestRefund(ctx, orderID)
+		switch {
+		case errors.Is(err, ErrRefundFailed):
+			log.Printf("Failed to refund order %d, will retry: %v", orderID, err)
+		case err != nil:
+			return refunded, fmt.Errorf("failed to refund order %d: %w", orderID, err)
+		default:
+			refunded++
+		}
+	}
+	return refunded, nil
+}
+
+// RunRefundRetrier requests the refunds that are still due every interval
+// until ctx is done
+func (s *OrderService) RunRefundRetrier(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refunded, err := s.RetryRefunds(ctx)
+			if err != nil {
+				log.Printf("Failed to retry refunds: %v", err)
+			}
+			if refunded > 0 {
+				log.Printf("Requested %d refunds of cancelled orders", refunded)
+			}
+		}
+	}
+}
 
-	// Update status to processing
-	return s.orderRepo.UpdateOrderStatus(orderID, models.OrderStatusProcessing)
+// transition validates and applies a status change of a locked order and
+// records it in the order's status history. actorID is nil for changes made
+// by the system.
+func (s *OrderService) transition(tx *repository.Database, order *models.Order, status models.OrderStatus, actorID *uint, reason string) error {
+	if !canTransition(order.Status, status) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidStatusTransition, order.Status, status)
+	}
+
+	switch status {
+	case models.OrderStatusProcessing:
+		// The order is paid, so its reserved stock is sold
+		if _, err := s.settleReservations(tx, order.ID, models.ReservationStatusCommitted, actorID); err != nil {
+			return err
+		}
+	case models.OrderStatusCancelled:
+		// Processing means the payment went through, so the money is due
+		// back. The refund is requested after the cancellation is saved.
+		if order.Status == models.OrderStatusProcessing {
+			if err := repository.NewOrderRepository(tx).MarkRefundDue(order.ID); err != nil {
+				return err
+			}
+			order.RefundDue = true
+		}
+		if err := s.releaseOrder(tx, order, actorID); err != nil {
+			return err
+		}
+	case models.OrderStatusRefunded:
+		// A paid order refunded before it shipped is undone like a
+		// cancelled one
+		if order.Status == models.OrderStatusProcessing {
+			if err := s.releaseOrder(tx, order, actorID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := repository.NewOrderRepository(tx).UpdateOrderStatus(order.ID, order.Status, status, actorID, reason); err != nil {
+		return err
+	}
+	order.Status = status
+	return nil
+}
+
+// releaseOrder gives back what an order that will not ship took: the uses
+// of its promotions, and the stock held for it while unpaid or, once paid,
+// the items it sold, which go back in stock
+func (s *OrderService) releaseOrder(tx *repository.Database, order *models.Order, actorID *uint) error {
+	if err := repository.NewPromotionRepository(tx).ReleaseRedemptions(order.ID); err != nil {
+		return err
+	}
+
+	released, err := s.settleReservations(tx, order.ID, models.ReservationStatusReleased, actorID)
+	if err != nil || released {
+		return err
+	}
+
+	productRepo := repository.NewProductRepository(tx)
+	movementRepo := repository.NewStockMovementRepository(tx)
+	for _, item := range order.Items {
+		var err error
+		if item.VariantID != nil {
+			err = productRepo.IncrementVariantStock(item.ProductID, *item.VariantID, item.Quantity)
+		} else {
+			err = productRepo.IncrementStock(item.ProductID, item.Quantity)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = movementRepo.CreateMovement(&models.StockMovement{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			Reason:    models.StockMovementCancellation,
+			Reference: orderReference(order.ID),
+			ActorID:   actorID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settleReservations commits or releases the active stock reservations of
+// an order: committing takes the reserved stock out of stock as sold, and
+// records the sale in the stock ledger, releasing makes it available again.
+// It reports whether the order had any active reservations; orders placed
+// before reservations existed have none.
+func (s *OrderService) settleReservations(tx *repository.Database, orderID uint, status models.ReservationStatus, actorID *uint) (bool, error) {
+	reservationRepo := repository.NewReservationRepository(tx)
+	productRepo := repository.NewProductRepository(tx)
+	movementRepo := repository.NewStockMovementRepository(tx)
+
+	reservations, err := reservationRepo.GetActiveReservationsForUpdate(orderID)
+	if err != nil || len(reservations) == 0 {
+		return false, err
+	}
+
+	// Lock the products, then the variants, in the same order as checkout
+	// does, so that settling cannot deadlock with a concurrent checkout
+	var productIDs, variantIDs []uint
+	for _, reservation := range reservations {
+		productIDs = append(productIDs, reservation.ProductID)
+		if reservation.VariantID != nil {
+			variantIDs = append(variantIDs, *reservation.VariantID)
+		}
+	}
+	if _, err := productRepo.GetProductsForUpdate(productIDs); err != nil {
+		return false, err
+	}
+	if len(variantIDs) > 0 {
+		if _, err := productRepo.GetVariantsForUpdate(variantIDs); err != nil {
+			return false, err
+		}
+	}
+
+	ids := make([]uint, 0, len(reservations))
+	for _, reservation := range reservations {
+		var err error
+		switch {
+		case status == models.ReservationStatusCommitted && reservation.VariantID != nil:
+			err = productRepo.DecrementVariantStock(reservation.ProductID, *reservation.VariantID, reservation.Quantity)
+		case status == models.ReservationStatusCommitted:
+			err = productRepo.DecrementStock(reservation.ProductID, reservation.Quantity)
+		case reservation.VariantID != nil:
+			err = productRepo.ReleaseVariantStock(reservation.ProductID, *reservation.VariantID, reservation.Quantity)
+		default:
+			err = productRepo.ReleaseStock(reservation.ProductID, reservation.Quantity)
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to settle stock reservation %d: %w", reservation.ID, err)
+		}
+		ids = append(ids, reservation.ID)
+
+		if status != models.ReservationStatusCommitted {
+			continue
+		}
+		err = movementRepo.CreateMovement(&models.StockMovement{
+			ProductID: reservation.ProductID,
+			VariantID: reservation.VariantID,
+			Quantity:  -reservation.Quantity,
+			Reason:    models.StockMovementSale,
+			Reference: orderReference(orderID),
+			ActorID:   actorID,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, reservationRepo.UpdateReservationStatus(ids, status)
+}
+
+// orderReference is the stock ledger reference of the movements caused by
+// an order
+func orderReference(orderID uint) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+// reservationSweepBatch is the number of expired orders handled per
+// transaction batch by ExpireReservations
+const reservationSweepBatch = 100
+
+// ExpireReservations cancels the unpaid orders whose stock reservations
+// have expired, which gives their stock back. It returns the number of
+// orders cancelled.
+func (s *OrderService) ExpireReservations() (int, error) {
+	cancelled := 0
+	for {
+		orderIDs, err := repository.NewReservationRepository(s.db).GetExpiredOrderIDs(time.Now(), reservationSweepBatch)
+		if err != nil || len(orderIDs) == 0 {
+			return cancelled, err
+		}
+
+		for _, orderID := range orderIDs {
+			err := s.db.Transaction(func(tx *repository.Database) error {
+				order, err := repository.NewOrderRepository(tx).GetOrderForUpdate(orderID)
+				if err != nil {
+					return err
+				}
+
+				// The order was paid or cancelled while we looked; only its
+				// leftover reservations need releasing
+				if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaymentFailed {
+					_, err := s.settleReservations(tx, order.ID, models.ReservationStatusReleased, nil)
+					return err
+				}
+
+				cancelled++
+				return s.transition(tx, order, models.OrderStatusCancelled, nil, "stock reservation expired")
+			})
+			if err != nil {
+				return cancelled, fmt.Errorf("failed to expire reservations of order %d: %w", orderID, err)
+			}
+		}
+
+		if len(orderIDs) < reservationSweepBatch {
+			return cancelled, nil
+		}
+	}
+}
+
+// RunReservationSweeper expires stock reservations every interval until
+// ctx is done
+func (s *OrderService) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cancelled, err := s.ExpireReservations()
+			if err != nil {
+				log.Printf("Failed to expire stock reservations: %v", err)
+			}
+			if cancelled > 0 {
+				log.Printf("Cancelled %d unpaid orders with expired stock reservations", cancelled)
+			}
+		}
+	}
+}
+
+// HandlePaymentEvent applies a payment provider event to the order it
+// refers to. Each event is applied at most once: redelivered events are
+// recognised by their event ID and ignored. An event no order can be found
+// for is not recorded and returns an error, so the provider delivers it
+// again. A payment that succeeds for an order that was already cancelled is
+// refunded. Payments of another amount or currency than the order's total
+// do not mark it paid, and partial refunds leave its status unchanged; both
+// are logged for the staff to resolve.
+func (s *OrderService) HandlePaymentEvent(ctx context.Context, event *payment.Event) error {
+	var status models.OrderStatus
+	switch event.Type {
+	case payment.EventPaymentSucceeded:
+		status = models.OrderStatusProcessing
+	case payment.EventPaymentFailed:
+		status = models.OrderStatusPaymentFailed
+	case payment.EventChargeRefunded:
+		status = models.OrderStatusRefunded
+	default:
+		// Not an event we act on
+		return nil
+	}
+
+	var refundOrderID uint
+	err := s.db.Transaction(func(tx *repository.Database) error {
+		orderRepo := repository.NewOrderRepository(tx)
+		paymentRepo := repository.NewPaymentRepository(tx)
+
+		order, err := s.paymentOrder(orderRepo, event)
+		if err != nil {
+			return err
+		}
+
+		recorded, err := paymentRepo.RecordEvent(&models.PaymentEvent{
+			EventID:   event.ID,
+			Type:      event.Type,
+			PaymentID: event.PaymentID,
+		})
+		if err != nil {
+			return err
+		}
+		if !recorded {
+			// Already processed
+			return nil
+		}
+
+		// The order was paid after it was cancelled, e.g. when its stock
+		// reservation expired, so the money is due back
+		if status == models.OrderStatusProcessing && order.Status == models.OrderStatusCancelled {
+			log.Printf("Refunding %s event %s: order %d was already cancelled", event.Type, event.ID, order.ID)
+			refundOrderID = order.ID
+			return orderRepo.MarkRefundDue(order.ID)
+		}
+
+		switch {
+		case status == models.OrderStatusProcessing && (event.Amount != order.Total.Amount || event.Currency != order.Total.Currency):
+			log.Printf("Ignoring %s event %s for order %d: paid %d %s, but the order total is %d %s",
+				event.Type, event.ID, order.ID, event.Amount, event.Currency, order.Total.Amount, order.Total.Currency)
+			return nil
+		case status == models.OrderStatusRefunded && (event.Amount < order.Total.Amount || event.Currency != order.Total.Currency):
+			log.Printf("Ignoring %s event %s for order %d: refunded %d %s of %d %s",
+				event.Type, event.ID, order.ID, event.Amount, event.Currency, order.Total.Amount, order.Total.Currency)
+			return nil
+		}
+
+		err = s.transition(tx, order, status, nil, "payment event "+event.Type)
+		if errors.Is(err, ErrInvalidStatusTransition) {
+			log.Printf("Ignoring %s event %s for order %d: %v", event.Type, event.ID, order.ID, err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if refundOrderID != 0 {
+		s.refundIfDue(ctx, refundOrderID)
+	}
+	return nil
+}
+
+// paymentOrder finds and locks the order a payment event refers to: the
+// order with the event's payment ID or, when the payment ID was not saved
+// on the order, e.g. because the webhook came first, the order named in the
+// payment's metadata, which then gets the payment ID
+func (s *OrderService) paymentOrder(orderRepo *repository.OrderRepository, event *payment.Event) (*models.Order, error) {
+	order, err := orderRepo.GetOrderByPaymentID(event.PaymentID)
+	if err == nil {
+		return orderRepo.GetOrderForUpdate(order.ID)
+	}
+	if !errors.Is(err, repository.ErrOrderNotFound) {
+		return nil, err
+	}
+	if event.OrderID == 0 {
+		return nil, fmt.Errorf("%w: no order for payment %s", ErrOrderNotFound, event.PaymentID)
+	}
+
+	order, err = orderRepo.GetOrderForUpdate(event.OrderID)
+	if err != nil {
+		return nil, fmt.Errorf("no order %d for payment %s: %w", event.OrderID, event.PaymentID, err)
+	}
+	if order.PaymentID != "" {
+		return nil, fmt.Errorf("%w: order %d has payment %s, not %s", ErrOrderNotFound, order.ID, order.PaymentID, event.PaymentID)
+	}
+
+	if err := orderRepo.UpdatePaymentInfo(order.ID, event.PaymentID, event.Provider); err != nil {
+		return nil, err
+	}
+	order.PaymentID = event.PaymentID
+	order.PaymentType = event.Provider
+	return order, nil
 }
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"store/internal/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCreateOrderLastUnit(t *testing.T) {
+	store := newTestStore(t)
+	product := store.createProduct(t, 1)
+
+	const customers = 10
+	userIDs := make([]uint, customers)
+	for i := range userIDs {
+		userIDs[i] = store.createCustomer(t, product, 1)
+	}
+
+	// Watch the product's stock while the customers race for its last unit
+	stop := make(chan struct{})
+	violations := make(chan []string, 1)
+	go func() {
+		var found []string
+		for {
+			select {
+			case <-stop:
+				violations <- found
+				return
+			default:
+			}
+			var p models.Product
+			if err := store.db.DB.First(&p, product.ID).Error; err != nil {
+				found = append(found, err.Error())
+			} else if p.Stock < 0 || p.Reserved < 0 || p.Reserved > p.Stock {
+				found = append(found, fmt.Sprintf("stock %d, reserved %d", p.Stock, p.Reserved))
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	start := make(chan struct{})
+	errs := make([]error, customers)
+	var wg sync.WaitGroup
+	for i, userID := range userIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, errs[i] = store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", "")
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(stop)
+
+	for _, violation := range <-violations {
+		t.Errorf("product state during checkout: %s", violation)
+	}
+
+	var winner uint
+	for i, err := range errs {
+		if err != nil {
+			continue
+		}
+		if winner != 0 {
+			t.Errorf("customers %d and %d both ordered the last unit", winner, userIDs[i])
+		}
+		winner = userIDs[i]
+	}
+	if winner == 0 {
+		t.Fatalf("no order succeeded: %v", errs)
+	}
+
+	if got := store.product(t, product.ID); got.Stock != 1 || got.Reserved != 1 {
+		t.Errorf("stock = %d, reserved %d; want 1 and 1", got.Stock, got.Reserved)
+	}
+	store.expectCount(t, &models.Order{}, 1)
+	store.expectCount(t, &models.StockReservation{}, 1)
+
+	// The customers who missed out keep their carts
+	for _, userID := range userIDs {
+		want := 1
+		if userID == winner {
+			want = 0
+		}
+		if got := store.cartQuantity(t, userID); got != want {
+			t.Errorf("customer %d has %d in their cart, want %d", userID, got, want)
+		}
+	}
+}
+
+func TestCreateOrderRollsBack(t *testing.T) {
+	store := newTestStore(t)
+	product := store.createProduct(t, 5)
+	userID := store.createCustomer(t, product, 2)
+
+	// Fail the checkout after the stock is reserved and the order saved
+	dropTrigger := func() {
+		store.exec(t, `DROP TRIGGER IF EXISTS test_refuse_reservation ON stock_reservations`)
+		store.exec(t, `DROP FUNCTION IF EXISTS test_refuse_reservation()`)
+	}
+	dropTrigger()
+	t.Cleanup(dropTrigger)
+	store.exec(t, `CREATE OR REPLACE FUNCTION test_refuse_reservation() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'reservation refused by test';
+END $$ LANGUAGE plpgsql`)
+	store.exec(t, `CREATE TRIGGER test_refuse_reservation BEFORE INSERT ON stock_reservations
+    FOR EACH ROW EXECUTE FUNCTION test_refuse_reservation()`)
+
+	if _, err := store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", ""); err == nil {
+		t.Fatal("CreateOrder succeeded, want an error")
+	}
+
+	if got := store.product(t, product.ID); got.Stock != 5 || got.Reserved != 0 {
+		t.Errorf("stock = %d, reserved %d; want 5 and 0", got.Stock, got.Reserved)
+	}
+	store.expectCount(t, &models.Order{}, 0)
+	store.expectCount(t, &models.OrderItem{}, 0)
+	store.expectCount(t, &models.OrderStatusEvent{}, 0)
+	store.expectCount(t, &models.StockReservation{}, 0)
+	if got := store.cartQuantity(t, userID); got != 2 {
+		t.Errorf("cart quantity = %d, want 2", got)
+	}
+
+	// Nothing is left behind that stops the order being placed
+	dropTrigger()
+	order, err := store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if len(order.Items) != 1 || order.Items[0].Quantity != 2 {
+		t.Errorf("order items = %+v, want 2 of product %d", order.Items, product.ID)
+	}
+	if got := store.product(t, product.ID).Reserved; got != 2 {
+		t.Errorf("reserved = %d, want 2", got)
+	}
+}
+
+// exec runs a statement against the test database
+func (s *testStore) exec(t *testing.T, sql string) {
+	t.Helper()
+
+	if err := s.db.DB.Exec(sql).Error; err != nil {
+		t.Fatalf("failed to run %q: %v", sql, err)
+	}
+}
+
+// expectCount checks how many rows the table of model holds
+func (s *testStore) expectCount(t *testing.T, model interface{}, want int64) {
+	t.Helper()
+
+	var count int64
+	if err := s.db.DB.Model(model).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count %T rows: %v", model, err)
+	}
+	if count != want {
+		t.Errorf("%T rows = %d, want %d", model, count, want)
+	}
+}
+
+// cartQuantity returns the number of units in a user's cart
+func (s *testStore) cartQuantity(t *testing.T, userID uint) int {
+	t.Helper()
+
+	var quantity int
+	err := s.db.DB.Model(&models.CartItem{}).
+		Joins("JOIN carts ON carts.id = cart_items.cart_id").
+		Where("carts.user_id = ?", userID).
+		Select("COALESCE(SUM(cart_items.quantity), 0)").
+		Scan(&quantity).Error
+	if err != nil {
+		t.Fatalf("failed to load cart of user %d: %v", userID, err)
+	}
+	return quantity
+}
@@ -1,69 +1,91 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"store/config"
+	"store/internal/models"
 	"store/internal/repository"
+	"store/pkg/payment"
 )
 
+// ErrOrderNotPayable is returned when a payment is requested for an order
+// that is not waiting for one
+var ErrOrderNotPayable = errors.New("order cannot be paid")
+
+// PaymentGateway creates payments with a payment provider
+type PaymentGateway interface {
+	// CreatePaymentIntent creates a payment intent the client can complete
+	CreatePaymentIntent(ctx context.Context, req payment.IntentRequest) (*payment.Intent, error)
+	// Refund returns money taken for a payment intent
+	Refund(ctx context.Context, req payment.RefundRequest) (*payment.Refund, error)
+}
+
 // PaymentService provides payment-related operations
 type PaymentService struct {
 	cfg       *config.Config
 	orderRepo *repository.OrderRepository
+	gateway   PaymentGateway
 }
 
 // NewPaymentService creates a new PaymentService
-func NewPaymentService(cfg *config.Config, orderRepo *repository.OrderRepository) *PaymentService {
+func NewPaymentService(cfg *config.Config, orderRepo *repository.OrderRepository, gateway PaymentGateway) *PaymentService {
 	return &PaymentService{
 		cfg:       cfg,
 		orderRepo: orderRepo,
+		gateway:   gateway,
 	}
 }
 
-// CreatePaymentIntent creates a payment intent with Stripe
-// In a real implementation, this would use the Stripe API
-func (s *PaymentService) CreatePaymentIntent(orderID uint) (string, error) {
-	// Check if Stripe API key is configured
-	if s.cfg.StripeAPIKey == "" {
-		return "", errors.New("stripe API key not configured")
-	}
-
+// CreatePaymentIntent creates a payment intent for an order with the
+// configured gateway and stores the payment ID on the order. Only pending
+// orders and orders whose payment failed can be paid.
+func (s *PaymentService) CreatePaymentIntent(ctx context.Context, orderID uint) (*payment.Intent, error) {
 	// Get order
 	order, err := s.orderRepo.GetOrderByID(orderID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if order.Status != models.OrderStatusPending && order.Status != models.OrderStatusPaymentFailed {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotPayable, order.Status)
 	}
 
-	// In a real implementation, we would use order.TotalAmount to create the payment intent
-	amount := int(order.TotalAmount * 100) // Convert to cents for Stripe
-
-	// In a real implementation, we would:
-	// 1. Create a payment intent with the Stripe API
-	// 2. Return the client secret for the frontend to complete the payment
-	// For this mock implementation, we'll just generate a fake payment intent ID
-
-	// Mock implementation
-	paymentIntentID := fmt.Sprintf("pi_%d_%d", orderID, amount)
+	intent, err := s.gateway.CreatePaymentIntent(ctx, payment.IntentRequest{
+		OrderID:        order.ID,
+		Amount:         order.Total.Amount,
+		Currency:       order.Total.Currency,
+		IdempotencyKey: fmt.Sprintf("order_%d_%d", order.ID, order.Total.Amount),
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Update order with payment ID
-	err = s.orderRepo.UpdatePaymentInfo(orderID, paymentIntentID, "stripe")
+	err = s.orderRepo.UpdatePaymentInfo(orderID, intent.ID, intent.Provider)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return paymentIntentID, nil
+	return intent, nil
 }
 
-// ConfirmPayment confirms a payment
-// In a real implementation, this would handle Stripe webhooks
-func (s *PaymentService) ConfirmPayment(paymentID string) error {
-	// In a real implementation, this would validate the payment with Stripe
-	// and update the order status accordingly
+// RefundPayment refunds the full payment of an order. The order is moved
+// to refunded once the provider confirms the refund through the webhook.
+func (s *PaymentService) RefundPayment(ctx context.Context, order *models.Order) error {
+	if order.PaymentID == "" {
+		return errors.New("order has no payment to refund")
+	}
 
-	// Mock implementation: just mark the order as paid and set to processing
-	// Here we would query the order by payment ID, but for simplicity:
-	// We'll assume success and leave actual implementation for a real project
+	_, err := s.gateway.Refund(ctx, payment.RefundRequest{
+		PaymentID:      order.PaymentID,
+		IdempotencyKey: "refund_" + order.PaymentID,
+	})
+	return err
+}
 
-	return nil
+// ParseWebhook verifies the signature of a webhook request from the payment
+// provider and decodes its event
+func (s *PaymentService) ParseWebhook(payload []byte, signature string) (*payment.Event, error) {
+	return payment.ParseWebhook(payload, signature, s.cfg.StripeWebhookSecret, payment.DefaultWebhookTolerance)
 }
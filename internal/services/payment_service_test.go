@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"store/internal/models"
+	"store/pkg/payment"
+	"testing"
+)
+
+func TestPaymentRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	product := store.createProduct(t, 5)
+	userID := store.createCustomer(t, product, 2)
+
+	order, err := store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	intent, err := store.payments.CreatePaymentIntent(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent: %v", err)
+	}
+	req, ok := store.gateway.Intent(intent.ID)
+	if !ok {
+		t.Fatalf("intent %s not created with the gateway", intent.ID)
+	}
+	if req.OrderID != order.ID || req.Amount != order.Total.Amount || req.Currency != order.Total.Currency {
+		t.Errorf("intent request = %+v, want order %d for %d %s", req, order.ID, order.Total.Amount, order.Total.Currency)
+	}
+	if got := store.order(t, order.ID).PaymentID; got != intent.ID {
+		t.Errorf("order payment ID = %q, want %q", got, intent.ID)
+	}
+
+	// The provider may deliver an event more than once
+	succeeded := paidEvent("evt_succeeded", intent.ID, order)
+	for i := 0; i < 2; i++ {
+		if err := store.orders.HandlePaymentEvent(ctx, succeeded); err != nil {
+			t.Fatalf("HandlePaymentEvent #%d: %v", i+1, err)
+		}
+	}
+	if got := store.order(t, order.ID).Status; got != models.OrderStatusProcessing {
+		t.Errorf("status after payment = %s, want %s", got, models.OrderStatusProcessing)
+	}
+	if got := store.product(t, product.ID); got.Stock != 3 || got.Reserved != 0 {
+		t.Errorf("stock after payment = %d, reserved %d; want 3 and 0", got.Stock, got.Reserved)
+	}
+
+	if _, err := store.payments.CreatePaymentIntent(ctx, order.ID); !errors.Is(err, ErrOrderNotPayable) {
+		t.Errorf("CreatePaymentIntent of a paid order: error = %v, want %v", err, ErrOrderNotPayable)
+	}
+
+	// Cancelling the paid order refunds it
+	if _, err := store.orders.CancelOrder(ctx, userID, order.ID); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+	refunds := store.gateway.Refunds()
+	if len(refunds) != 1 || refunds[0].PaymentID != intent.ID {
+		t.Errorf("refunds = %+v, want one of %s", refunds, intent.ID)
+	}
+	cancelled := store.order(t, order.ID)
+	if cancelled.Status != models.OrderStatusCancelled || cancelled.RefundDue {
+		t.Errorf("order after cancellation: status %s, refund due %v; want %s and false",
+			cancelled.Status, cancelled.RefundDue, models.OrderStatusCancelled)
+	}
+	if got := store.product(t, product.ID).Stock; got != 5 {
+		t.Errorf("stock after cancellation = %d, want 5", got)
+	}
+
+	refunded := &payment.Event{ID: "evt_refunded", Type: payment.EventChargeRefunded, PaymentID: intent.ID, Provider: "fake",
+		Amount: order.Total.Amount, Currency: order.Total.Currency}
+	if err := store.orders.HandlePaymentEvent(ctx, refunded); err != nil {
+		t.Fatalf("HandlePaymentEvent: %v", err)
+	}
+	if got := store.order(t, order.ID).Status; got != models.OrderStatusRefunded {
+		t.Errorf("status after refund = %s, want %s", got, models.OrderStatusRefunded)
+	}
+}
+
+func TestPaymentEventBeforePaymentIDSaved(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	product := store.createProduct(t, 5)
+	userID := store.createCustomer(t, product, 1)
+
+	order, err := store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	// The webhook arrives before the payment ID is saved on the order
+	intent, err := store.gateway.CreatePaymentIntent(ctx, payment.IntentRequest{OrderID: order.ID, Amount: order.Total.Amount, Currency: order.Total.Currency})
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent: %v", err)
+	}
+	event := paidEvent("evt_succeeded", intent.ID, order)
+	event.OrderID = order.ID
+	if err := store.orders.HandlePaymentEvent(ctx, event); err != nil {
+		t.Fatalf("HandlePaymentEvent: %v", err)
+	}
+
+	paid := store.order(t, order.ID)
+	if paid.Status != models.OrderStatusProcessing || paid.PaymentID != intent.ID {
+		t.Errorf("order: status %s, payment ID %q; want %s and %q", paid.Status, paid.PaymentID, models.OrderStatusProcessing, intent.ID)
+	}
+}
+
+func TestPaymentEventWithoutOrder(t *testing.T) {
+	store := newTestStore(t)
+
+	event := &payment.Event{ID: "evt_unknown", Type: payment.EventPaymentSucceeded, PaymentID: "pi_unknown", Provider: "fake"}
+	if err := store.orders.HandlePaymentEvent(context.Background(), event); !errors.Is(err, ErrOrderNotFound) {
+		t.Fatalf("HandlePaymentEvent: error = %v, want %v", err, ErrOrderNotFound)
+	}
+
+	// The event is not recorded, so it is handled when delivered again
+	var count int64
+	if err := store.db.DB.Model(&models.PaymentEvent{}).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count payment events: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("recorded %d payment events, want 0", count)
+	}
+}
+
+func TestPaymentSucceededAfterCancellation(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	product := store.createProduct(t, 5)
+	userID := store.createCustomer(t, product, 1)
+
+	order, err := store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	intent, err := store.payments.CreatePaymentIntent(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent: %v", err)
+	}
+	if _, err := store.orders.CancelOrder(ctx, userID, order.ID); err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+
+	if err := store.orders.HandlePaymentEvent(ctx, paidEvent("evt_succeeded", intent.ID, order)); err != nil {
+		t.Fatalf("HandlePaymentEvent: %v", err)
+	}
+
+	refunds := store.gateway.Refunds()
+	if len(refunds) != 1 || refunds[0].PaymentID != intent.ID {
+		t.Errorf("refunds = %+v, want one of %s", refunds, intent.ID)
+	}
+	if got := store.order(t, order.ID).Status; got != models.OrderStatusCancelled {
+		t.Errorf("status = %s, want %s", got, models.OrderStatusCancelled)
+	}
+	if got := store.product(t, product.ID); got.Stock != 5 || got.Reserved != 0 {
+		t.Errorf("stock = %d, reserved %d; want 5 and 0", got.Stock, got.Reserved)
+	}
+}
+
+func TestPaymentOfAnotherAmount(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	product := store.createProduct(t, 5)
+	userID := store.createCustomer(t, product, 1)
+
+	order, err := store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	intent, err := store.payments.CreatePaymentIntent(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent: %v", err)
+	}
+
+	short := paidEvent("evt_short", intent.ID, order)
+	short.Amount--
+	euros := paidEvent("evt_euros", intent.ID, order)
+	euros.Currency = "EUR"
+	for _, event := range []*payment.Event{short, euros} {
+		if err := store.orders.HandlePaymentEvent(ctx, event); err != nil {
+			t.Fatalf("HandlePaymentEvent %s: %v", event.ID, err)
+		}
+		if got := store.order(t, order.ID).Status; got != models.OrderStatusPending {
+			t.Errorf("status after %s = %s, want %s", event.ID, got, models.OrderStatusPending)
+		}
+	}
+	if got := store.product(t, product.ID); got.Stock != 5 || got.Reserved != 1 {
+		t.Errorf("stock = %d, reserved %d; want 5 and 1", got.Stock, got.Reserved)
+	}
+}
+
+func TestProviderRefundOfPaidOrder(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	product := store.createProduct(t, 5)
+	userID := store.createCustomer(t, product, 2)
+
+	order, err := store.orders.CreateOrder(userID, "1 Test Street", testRegion, "standard", "")
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	intent, err := store.payments.CreatePaymentIntent(ctx, order.ID)
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent: %v", err)
+	}
+	if err := store.orders.HandlePaymentEvent(ctx, paidEvent("evt_succeeded", intent.ID, order)); err != nil {
+		t.Fatalf("HandlePaymentEvent: %v", err)
+	}
+
+	// A partial refund leaves the order as it is
+	partial := &payment.Event{ID: "evt_partial", Type: payment.EventChargeRefunded, PaymentID: intent.ID, Provider: "fake",
+		Amount: order.Total.Amount / 2, Currency: order.Total.Currency}
+	if err := store.orders.HandlePaymentEvent(ctx, partial); err != nil {
+		t.Fatalf("HandlePaymentEvent: %v", err)
+	}
+	if got := store.order(t, order.ID).Status; got != models.OrderStatusProcessing {
+		t.Errorf("status after a partial refund = %s, want %s", got, models.OrderStatusProcessing)
+	}
+
+	// Refunding the rest puts the items back in stock
+	full := &payment.Event{ID: "evt_full", Type: payment.EventChargeRefunded, PaymentID: intent.ID, Provider: "fake",
+		Amount: order.Total.Amount, Currency: order.Total.Currency}
+	if err := store.orders.HandlePaymentEvent(ctx, full); err != nil {
+		t.Fatalf("HandlePaymentEvent: %v", err)
+	}
+	if got := store.order(t, order.ID).Status; got != models.OrderStatusRefunded {
+		t.Errorf("status after a full refund = %s, want %s", got, models.OrderStatusRefunded)
+	}
+	if got := store.product(t, product.ID); got.Stock != 5 || got.Reserved != 0 {
+		t.Errorf("stock = %d, reserved %d; want 5 and 0", got.Stock, got.Reserved)
+	}
+	if len(store.gateway.Refunds()) != 0 {
+		t.Errorf("refunds = %+v, want none requested by the store", store.gateway.Refunds())
+	}
+}
+
+// paidEvent returns the event of a payment of an order's total
+func paidEvent(id, paymentID string, order *models.Order) *payment.Event {
+	return &payment.Event{
+		ID:        id,
+		Type:      payment.EventPaymentSucceeded,
+		PaymentID: paymentID,
+		Provider:  "fake",
+		Amount:    order.Total.Amount,
+		Currency:  order.Total.Currency,
+	}
+}
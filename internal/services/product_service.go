@@ -1,25 +1,89 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"store/internal/models"
 	"store/internal/repository"
+	"strings"
 )
 
+// Product listing types, shared with the repository
+type (
+	ProductFilter = repository.ProductFilter
+	ProductSort   = repository.ProductSort
+	ProductPage   = repository.ProductPage
+	ProductList   = repository.ProductList
+	ProductFacets = repository.ProductFacets
+	FacetCount    = repository.FacetCount
+)
+
+var (
+	// ErrProductNotFound is returned when a product does not exist
+	ErrProductNotFound = repository.ErrProductNotFound
+	// ErrInvalidProductSort is returned for an unknown product sort order
+	ErrInvalidProductSort = errors.New("invalid sort")
+	// ErrInvalidCursor is returned for a pagination cursor that cannot be decoded
+	ErrInvalidCursor = repository.ErrInvalidCursor
+	// ErrInvalidImport is returned when some rows of a product import are
+	// invalid. Nothing is imported.
+	ErrInvalidImport = errors.New("import has invalid rows")
+	// ErrStockBelowReserved is returned when stock would be set below the
+	// quantity reserved for unpaid orders
+	ErrStockBelowReserved = repository.ErrStockBelowReserved
+)
+
+// Product import actions
+const (
+	ProductImportCreate = "create"
+	ProductImportUpdate = "update"
+)
+
+// productExportBatchSize is the number of products read at a time when
+// exporting the catalog
+const productExportBatchSize = 500
+
+// ProductImportRow is one row of a product import: the product to save,
+// either an existing one with its fields updated or a new one, or the
+// reason the row could not be read
+type ProductImportRow struct {
+	Row     int
+	Product *models.Product
+	Err     error
+}
+
+// ProductImportResult is the outcome of one row of a product import
+type ProductImportResult struct {
+	Row    int
+	SKU    string
+	Action string // ProductImportCreate or ProductImportUpdate; empty if Err is set
+	Err    error
+}
+
 // ProductService provides product-related operations
 type ProductService struct {
-	productRepo *repository.ProductRepository
+	productRepo  *repository.ProductRepository
+	categoryRepo *repository.CategoryRepository
+	currency     string
 }
 
-// NewProductService creates a new ProductService
-func NewProductService(productRepo *repository.ProductRepository) *ProductService {
+// NewProductService creates a new ProductService. Product prices are kept
+// in the given store currency.
+func NewProductService(productRepo *repository.ProductRepository, categoryRepo *repository.CategoryRepository, currency string) *ProductService {
 	return &ProductService{
-		productRepo: productRepo,
+		productRepo:  productRepo,
+		categoryRepo: categoryRepo,
+		currency:     currency,
 	}
 }
 
-// CreateProduct creates a new product
-func (s *ProductService) CreateProduct(product *models.Product) error {
-	return s.productRepo.CreateProduct(product)
+// CreateProduct creates a new product on behalf of actorID, who is
+// recorded in the stock ledger as having put its initial stock in
+func (s *ProductService) CreateProduct(product *models.Product, actorID uint) error {
+	if err := s.prepare(product); err != nil {
+		return err
+	}
+	return s.productRepo.CreateProduct(product, &actorID)
 }
 
 // GetProductByID retrieves a product by ID
@@ -27,22 +91,203 @@ func (s *ProductService) GetProductByID(id uint) (*models.Product, error) {
 	return s.productRepo.GetProductByID(id)
 }
 
-// GetProducts retrieves products with optional filters
-func (s *ProductService) GetProducts(category, brand string, minPrice, maxPrice float64) ([]models.Product, error) {
-	return s.productRepo.GetProducts(category, brand, minPrice, maxPrice)
+// GetProducts retrieves a page of products with optional filters. A
+// search is combined with the other filters. Products are listed by
+// relevance when searching and newest first otherwise, unless page.Sort
+// says otherwise.
+func (s *ProductService) GetProducts(filter ProductFilter, page ProductPage) (*ProductList, error) {
+	filter.Search = strings.TrimSpace(filter.Search)
+
+	switch {
+	case page.Sort == "" && filter.Search != "":
+		page.Sort = repository.ProductSortRelevance
+	case page.Sort == "":
+		page.Sort = repository.ProductSortNewest
+	case page.Sort == repository.ProductSortRelevance && filter.Search == "":
+		return nil, fmt.Errorf("%w: %s requires a search", ErrInvalidProductSort, page.Sort)
+	case !repository.ValidProductSort(page.Sort):
+		return nil, fmt.Errorf("%w: %s", ErrInvalidProductSort, page.Sort)
+	}
+
+	return s.productRepo.GetProducts(filter, page)
 }
 
-// SearchProducts searches products by name
-func (s *ProductService) SearchProducts(search string) ([]models.Product, error) {
-	return s.productRepo.SearchProducts(search)
+// GetProductFacets counts the products matching filter by category,
+// brand, price range and availability
+func (s *ProductService) GetProductFacets(filter ProductFilter) (*ProductFacets, error) {
+	filter.Search = strings.TrimSpace(filter.Search)
+	return s.productRepo.GetProductFacets(filter)
 }
 
-// UpdateProduct updates an existing product
-func (s *ProductService) UpdateProduct(product *models.Product) error {
-	return s.productRepo.UpdateProduct(product)
+// UpdateProduct updates an existing product. The stock of a product with
+// variants stays the sum of its variants' stock, and the main image of a
+// product with a gallery stays its first image. A change of stock is
+// recorded in the stock ledger as an adjustment by actorID.
+func (s *ProductService) UpdateProduct(product *models.Product, actorID uint) error {
+	if err := s.prepare(product); err != nil {
+		return err
+	}
+	deriveProductFields(product)
+	if product.Stock < product.Reserved {
+		return fmt.Errorf("%w: %d reserved", ErrStockBelowReserved, product.Reserved)
+	}
+
+	return s.productRepo.UpdateProduct(product, &actorID)
+}
+
+// GetVariantByID retrieves a variant of a product
+func (s *ProductService) GetVariantByID(productID, variantID uint) (*models.ProductVariant, error) {
+	return s.productRepo.GetVariantByID(productID, variantID)
+}
+
+// CreateVariant adds a variant to a product. From then on the product is
+// sold by variant and its stock is the sum of its variants' stock.
+func (s *ProductService) CreateVariant(variant *models.ProductVariant, actorID uint) error {
+	if _, err := s.productRepo.GetProductByID(variant.ProductID); err != nil {
+		return err
+	}
+	return s.productRepo.CreateVariant(variant, &actorID)
+}
+
+// UpdateVariant updates an existing variant on behalf of actorID
+func (s *ProductService) UpdateVariant(variant *models.ProductVariant, actorID uint) error {
+	if variant.Stock < variant.Reserved {
+		return fmt.Errorf("%w: %d reserved", ErrStockBelowReserved, variant.Reserved)
+	}
+	return s.productRepo.UpdateVariant(variant, &actorID)
+}
+
+// DeleteVariant deletes a variant of a product
+func (s *ProductService) DeleteVariant(productID, variantID uint) error {
+	if _, err := s.productRepo.GetVariantByID(productID, variantID); err != nil {
+		return err
+	}
+	return s.productRepo.DeleteVariant(productID, variantID)
+}
+
+// prepare sets the currency of a product's price and its tax class, and
+// checks its category
+func (s *ProductService) prepare(product *models.Product) error {
+	product.Price = models.NewMoney(product.Price.Amount, s.currency)
+	product.TaxClass = normalizeTaxClass(product.TaxClass)
+
+	category, err := s.categoryRepo.GetCategoryByID(product.CategoryID)
+	if err != nil {
+		return err
+	}
+	product.CategoryName = category.Name
+	return nil
+}
+
+// deriveProductFields sets the fields of a product that follow from its
+// variants and gallery: the stock of a product with variants is the sum of
+// their stock, and the main image of a product with a gallery is its first
+// image
+func deriveProductFields(product *models.Product) {
+	if len(product.Variants) > 0 {
+		product.Stock = 0
+		for _, variant := range product.Variants {
+			product.Stock += variant.Stock
+		}
+	}
+	if len(product.Images) > 0 {
+		product.ImageURL = product.Images[0].URLs[models.ImageLarge]
+	}
 }
 
 // DeleteProduct deletes a product
 func (s *ProductService) DeleteProduct(id uint) error {
 	return s.productRepo.DeleteProduct(id)
 }
+
+// GetProductsBySKU retrieves the products with the given SKUs, keyed by SKU
+func (s *ProductService) GetProductsBySKU(skus []string) (map[string]*models.Product, error) {
+	return s.productRepo.GetProductsBySKU(skus)
+}
+
+// ImportProducts creates or updates products in bulk, matching them by SKU.
+// Every row is checked before anything is saved: if any row is invalid, the
+// results say why and ErrInvalidImport is returned. With dryRun nothing is
+// saved either way. Stock changes are recorded in the stock ledger as
+// adjustments by actorID.
+func (s *ProductService) ImportProducts(rows []ProductImportRow, dryRun bool, actorID uint) ([]ProductImportResult, error) {
+	categories, err := s.categoryRepo.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+	categoryNames := make(map[uint]string, len(categories))
+	for _, category := range categories {
+		categoryNames[category.ID] = category.Name
+	}
+
+	results := make([]ProductImportResult, len(rows))
+	products := make([]*models.Product, 0, len(rows))
+	skuRows := make(map[string]int, len(rows))
+	invalid := false
+
+	for i, row := range rows {
+		result := &results[i]
+		result.Row = row.Row
+		if row.Product != nil {
+			result.SKU = row.Product.SKU
+		}
+
+		switch {
+		case row.Err != nil:
+			result.Err = row.Err
+		case row.Product.SKU == "":
+			result.Err = errors.New("sku is required")
+		case skuRows[row.Product.SKU] != 0:
+			result.Err = fmt.Errorf("sku %s is already imported by row %d", row.Product.SKU, skuRows[row.Product.SKU])
+		case categoryNames[row.Product.CategoryID] == "":
+			result.Err = fmt.Errorf("%w: %d", ErrCategoryNotFound, row.Product.CategoryID)
+		}
+		if result.Err != nil {
+			invalid = true
+			continue
+		}
+
+		product := row.Product
+		skuRows[product.SKU] = row.Row
+		product.Price = models.NewMoney(product.Price.Amount, s.currency)
+		product.TaxClass = normalizeTaxClass(product.TaxClass)
+		product.CategoryName = categoryNames[product.CategoryID]
+
+		if product.ID == 0 {
+			result.Action = ProductImportCreate
+		} else {
+			result.Action = ProductImportUpdate
+			deriveProductFields(product)
+			if product.Stock < product.Reserved {
+				result.Action = ""
+				result.Err = fmt.Errorf("%w: %d reserved", ErrStockBelowReserved, product.Reserved)
+				invalid = true
+				continue
+			}
+		}
+		products = append(products, product)
+	}
+
+	if invalid {
+		return results, ErrInvalidImport
+	}
+	if dryRun {
+		return results, nil
+	}
+	if err := s.productRepo.ImportProducts(products, &actorID); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// ExportProducts calls fn with every product in the catalog, a batch at a
+// time, so that the catalog never has to be held in memory at once
+func (s *ProductService) ExportProducts(fn func([]models.Product) error) error {
+	return s.productRepo.EachProduct(productExportBatchSize, fn)
+}
+
+// GetPriceCurrencies retrieves the currencies any product has a fixed price
+// in
+func (s *ProductService) GetPriceCurrencies() ([]string, error) {
+	return s.productRepo.GetPriceCurrencies()
+}
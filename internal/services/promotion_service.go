@@ -0,0 +1,510 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"store/internal/models"
+	"store/internal/repository"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPromotionNotFound is returned when a promotion, or coupon code, does
+	// not exist
+	ErrPromotionNotFound = repository.ErrPromotionNotFound
+	// ErrInvalidPromotion is returned for a promotion that cannot be saved
+	// as given
+	ErrInvalidPromotion = errors.New("invalid promotion")
+	// ErrCouponNotApplicable is returned when a coupon does not apply to a
+	// cart, e.g. because it expired or the cart does not qualify
+	ErrCouponNotApplicable = errors.New("coupon does not apply")
+)
+
+// Pricing is what a cart or order costs: Subtotal, the sum of its items,
+// less Discount, the sum of the Discounts, plus Shipping, plus Tax unless
+// PricesIncludeTax, in which case the tax is already part of the prices
+type Pricing struct {
+	Subtotal         models.Money
+	Discounts        []models.OrderDiscount
+	Discount         models.Money
+	Shipping         models.Money
+	Tax              models.Money
+	PricesIncludeTax bool
+	Total            models.Money
+	// CouponErr says why the coupon entered does not apply, if it does not;
+	// the coupon is then left out
+	CouponErr error
+	// lineDiscounts holds what the item discounts took off each line, and
+	// lineTaxes the tax of each line, in the order of the lines
+	lineDiscounts []models.Money
+	lineTaxes     []lineTax
+}
+
+// basketLine is a product, or one of its variants, being priced: quantity
+// of it at its unit price in the order currency
+type basketLine struct {
+	product  *models.Product
+	quantity int
+	price    models.Money
+}
+
+// PromotionService provides promotion-related operations and works out
+// what carts and orders cost: their discounts, shipping and, with the tax
+// service, tax
+type PromotionService struct {
+	promotionRepo   *repository.PromotionRepository
+	categoryRepo    *repository.CategoryRepository
+	currencyService *CurrencyService
+	taxService      *TaxService
+	// shipping is the flat shipping cost of an order, in the base currency
+	shipping models.Money
+}
+
+// NewPromotionService creates a new PromotionService. Orders are charged
+// the given shipping cost, in the base currency.
+func NewPromotionService(promotionRepo *repository.PromotionRepository, categoryRepo *repository.CategoryRepository, currencyService *CurrencyService, taxService *TaxService, shipping models.Money) *PromotionService {
+	return &PromotionService{
+		promotionRepo:   promotionRepo,
+		categoryRepo:    categoryRepo,
+		currencyService: currencyService,
+		taxService:      taxService,
+		shipping:        shipping,
+	}
+}
+
+// CreatePromotion creates a new promotion
+func (s *PromotionService) CreatePromotion(promotion *models.Promotion) error {
+	if err := s.prepare(promotion); err != nil {
+		return err
+	}
+	return s.promotionRepo.CreatePromotion(promotion)
+}
+
+// GetPromotions retrieves a page of promotions, newest first, and the
+// number of them on all pages
+func (s *PromotionService) GetPromotions(page, limit int) ([]models.Promotion, int64, error) {
+	return s.promotionRepo.GetPromotions(page, limit)
+}
+
+// GetPromotionByID retrieves a promotion by ID
+func (s *PromotionService) GetPromotionByID(id uint) (*models.Promotion, error) {
+	return s.promotionRepo.GetPromotionByID(id)
+}
+
+// GetCoupon retrieves the active promotion with a coupon code
+func (s *PromotionService) GetCoupon(code string) (*models.Promotion, error) {
+	code = normalizeCouponCode(code)
+	if code == "" {
+		return nil, ErrPromotionNotFound
+	}
+
+	promotion, err := s.promotionRepo.GetPromotionByCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if !promotion.Active {
+		return nil, ErrPromotionNotFound
+	}
+	return promotion, nil
+}
+
+// UpdatePromotion updates an existing promotion
+func (s *PromotionService) UpdatePromotion(promotion *models.Promotion) error {
+	if err := s.prepare(promotion); err != nil {
+		return err
+	}
+	return s.promotionRepo.UpdatePromotion(promotion)
+}
+
+// DeletePromotion deletes a promotion. Orders that used it keep their
+// discount lines.
+func (s *PromotionService) DeletePromotion(id uint) error {
+	if _, err := s.promotionRepo.GetPromotionByID(id); err != nil {
+		return err
+	}
+	return s.promotionRepo.DeletePromotion(id)
+}
+
+// prepare normalises a promotion's name, code and amounts and checks that
+// its rules make sense for its type
+func (s *PromotionService) prepare(promotion *models.Promotion) error {
+	promotion.Name = strings.TrimSpace(promotion.Name)
+	if promotion.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPromotion)
+	}
+	promotion.Brand = strings.TrimSpace(promotion.Brand)
+
+	currency := s.currencyService.BaseCurrency()
+	promotion.Amount = models.NewMoney(promotion.Amount.Amount, currency)
+	promotion.MinSubtotal = models.NewMoney(promotion.MinSubtotal.Amount, currency)
+
+	switch promotion.Type {
+	case models.PromotionPercentage:
+		if promotion.Percent < 1 || promotion.Percent > 100 {
+			return fmt.Errorf("%w: percent must be between 1 and 100", ErrInvalidPromotion)
+		}
+	case models.PromotionFixed:
+		if promotion.Amount.Amount <= 0 {
+			return fmt.Errorf("%w: amount must be positive", ErrInvalidPromotion)
+		}
+	case models.PromotionBuyXGetY:
+		if promotion.BuyQuantity < 1 || promotion.GetQuantity < 1 {
+			return fmt.Errorf("%w: buy and get quantities must be positive", ErrInvalidPromotion)
+		}
+	case models.PromotionFreeShipping:
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidPromotion, promotion.Type)
+	}
+
+	if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidPromotion)
+	}
+
+	if promotion.CategoryID != nil {
+		if _, err := s.categoryRepo.GetCategoryByID(*promotion.CategoryID); err != nil {
+			if errors.Is(err, repository.ErrCategoryNotFound) {
+				return fmt.Errorf("%w: category not found", ErrInvalidPromotion)
+			}
+			return err
+		}
+	}
+
+	promotion.Code = normalizeCouponCode(promotion.Code)
+	if promotion.Code != "" {
+		existing, err := s.promotionRepo.GetPromotionByCode(promotion.Code)
+		if err == nil && existing.ID != promotion.ID {
+			return fmt.Errorf("%w: code %q is already in use", ErrInvalidPromotion, promotion.Code)
+		}
+		if err != nil && !errors.Is(err, repository.ErrPromotionNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// normalizeCouponCode makes coupon codes case-insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// PriceCart works out what a cart costs in currency (the base currency if
+// empty) with the promotions that apply to it now and its coupon, if it
+// has one, and with the tax of region. A coupon that does not apply is left
+// out; CouponErr says why.
+func (s *PromotionService) PriceCart(cart *models.Cart, currency, region string) (*Pricing, error) {
+	currency, err := s.currencyService.Resolve(currency)
+	if err != nil {
+		return nil, err
+	}
+	region, err = ResolveTaxRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]basketLine, 0, len(cart.Items))
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		price, err := s.currencyService.Price(&item.Product, item.Variant, currency)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, basketLine{product: &item.Product, quantity: item.Quantity, price: price})
+	}
+
+	var userID uint
+	if cart.UserID != nil {
+		userID = *cart.UserID
+	}
+	return s.price(s.promotionRepo, userID, cart.CouponCode, lines, currency, region, false)
+}
+
+// applyToOrder prices an order being placed by its user from its items,
+// the promotions that apply to it, the coupon code of the cart and the tax
+// of its region, and counts a use of every promotion it gets a discount
+// from. It runs in the order's transaction and keeps the promotions locked
+// until it ends, so their usage limits hold. A coupon that does not apply
+// fails the order.
+func (s *PromotionService) applyToOrder(tx *repository.Database, order *models.Order, products map[uint]*models.Product, code string) error {
+	promotionRepo := repository.NewPromotionRepository(tx)
+
+	if err := s.taxService.checkRegion(order.TaxRegion); err != nil {
+		return err
+	}
+
+	lines := make([]basketLine, 0, len(order.Items))
+	for _, item := range order.Items {
+		lines = append(lines, basketLine{product: products[item.ProductID], quantity: item.Quantity, price: item.Price})
+	}
+
+	pricing, err := s.price(promotionRepo, order.UserID, code, lines, order.Total.Currency, order.TaxRegion, true)
+	if err != nil {
+		return err
+	}
+	if pricing.CouponErr != nil {
+		return pricing.CouponErr
+	}
+
+	for _, discount := range pricing.Discounts {
+		if err := promotionRepo.Redeem(discount.PromotionID); err != nil {
+			if errors.Is(err, repository.ErrPromotionUsedUp) {
+				return fmt.Errorf("%w: %s has been used up", ErrCouponNotApplicable, discount.Name)
+			}
+			return err
+		}
+	}
+
+	order.Subtotal = pricing.Subtotal
+	order.Discounts = pricing.Discounts
+	order.Discount = pricing.Discount
+	order.Shipping = pricing.Shipping
+	order.Tax = pricing.Tax
+	order.PricesIncludeTax = pricing.PricesIncludeTax
+	order.Total = pricing.Total
+	for i, tax := range pricing.lineTaxes {
+		order.Items[i].TaxClass = tax.class
+		order.Items[i].TaxRate = tax.rate
+		order.Items[i].Tax = tax.tax
+	}
+	return nil
+}
+
+// price works out what lines cost in currency for a user (0 for a guest,
+// whose per-user limits are not checked) in a tax region. Promotions apply
+// in the order they were created, each to what the ones before left: item
+// discounts never take more than is left of the lines they apply to, nor
+// free shipping more than the shipping cost. Each item discount is shared
+// out over the lines it applies to, and tax is worked out on what is left of
+// each line.
+func (s *PromotionService) price(promotionRepo *repository.PromotionRepository, userID uint, code string, lines []basketLine, currency, region string, lock bool) (*Pricing, error) {
+	pricing := &Pricing{
+		Subtotal: models.NewMoney(0, currency),
+		Discount: models.NewMoney(0, currency),
+		Shipping: models.NewMoney(0, currency),
+	}
+	lineLeft := make([]models.Money, len(lines))
+	pricing.lineDiscounts = make([]models.Money, len(lines))
+	for i, line := range lines {
+		lineLeft[i] = line.price.Mul(line.quantity)
+		pricing.lineDiscounts[i] = models.NewMoney(0, currency)
+		pricing.Subtotal = pricing.Subtotal.Add(lineLeft[i])
+	}
+	if len(lines) > 0 {
+		shipping, err := s.currencyService.Convert(s.shipping, currency)
+		if err != nil {
+			return nil, err
+		}
+		pricing.Shipping = shipping
+	}
+
+	code = normalizeCouponCode(code)
+	now := time.Now()
+	promotions, err := promotionRepo.GetApplicablePromotions(code, now, lock)
+	if err != nil {
+		return nil, err
+	}
+
+	shippingLeft := pricing.Shipping
+	couponFound := false
+	for i := range promotions {
+		promotion := &promotions[i]
+		isCoupon := promotion.Code != ""
+		couponFound = couponFound || isCoupon
+
+		amount, weights, err := s.discount(promotionRepo, promotion, userID, lines, lineLeft, pricing.Subtotal, shippingLeft, now)
+		if errors.Is(err, ErrCouponNotApplicable) {
+			if isCoupon {
+				pricing.CouponErr = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if promotion.Type == models.PromotionFreeShipping {
+			shippingLeft = shippingLeft.Sub(amount)
+		} else {
+			for i, share := range allocate(amount, weights) {
+				lineLeft[i] = lineLeft[i].Sub(share)
+				pricing.lineDiscounts[i] = pricing.lineDiscounts[i].Add(share)
+			}
+		}
+		pricing.Discount = pricing.Discount.Add(amount)
+		pricing.Discounts = append(pricing.Discounts, models.OrderDiscount{
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			Name:        promotion.Name,
+			Type:        promotion.Type,
+			Amount:      amount,
+		})
+	}
+	if code != "" && !couponFound {
+		pricing.CouponErr = fmt.Errorf("%w: code %s is not valid", ErrCouponNotApplicable, code)
+	}
+
+	if err := s.taxService.apply(pricing, lines, region); err != nil {
+		return nil, err
+	}
+	pricing.PricesIncludeTax = s.taxService.PricesIncludeTax()
+
+	pricing.Total = pricing.Subtotal.Sub(pricing.Discount).Add(pricing.Shipping)
+	if !pricing.PricesIncludeTax {
+		pricing.Total = pricing.Total.Add(pricing.Tax)
+	}
+	return pricing, nil
+}
+
+// discount works out what a promotion takes off lines, given what earlier
+// promotions left of each line and of the shipping cost. For an item
+// discount it also returns the weight of each line in it, which is zero for
+// the lines it does not apply to and never more than what is left of the
+// line. It returns an error wrapping ErrCouponNotApplicable, saying why,
+// when the promotion does not apply.
+func (s *PromotionService) discount(promotionRepo *repository.PromotionRepository, promotion *models.Promotion, userID uint, lines []basketLine, lineLeft []models.Money, subtotal, shippingLeft models.Money, now time.Time) (models.Money, []models.Money, error) {
+	currency := subtotal.Currency
+	zero := models.NewMoney(0, currency)
+
+	switch {
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return zero, nil, fmt.Errorf("%w: it is not valid until %s", ErrCouponNotApplicable, promotion.StartsAt.Format(time.RFC3339))
+	case promotion.EndsAt != nil && !now.Before(*promotion.EndsAt):
+		return zero, nil, fmt.Errorf("%w: it has expired", ErrCouponNotApplicable)
+	case promotion.UsageLimit > 0 && promotion.UsageCount >= promotion.UsageLimit:
+		return zero, nil, fmt.Errorf("%w: it has been used up", ErrCouponNotApplicable)
+	}
+
+	if promotion.PerUserLimit > 0 && userID != 0 {
+		used, err := promotionRepo.CountUserRedemptions(promotion.ID, userID)
+		if err != nil {
+			return zero, nil, err
+		}
+		if used >= int64(promotion.PerUserLimit) {
+			return zero, nil, fmt.Errorf("%w: you have already used it", ErrCouponNotApplicable)
+		}
+	}
+
+	if !promotion.MinSubtotal.IsZero() {
+		minSubtotal, err := s.currencyService.Convert(promotion.MinSubtotal, currency)
+		if err != nil {
+			return zero, nil, err
+		}
+		if subtotal.Less(minSubtotal) {
+			return zero, nil, fmt.Errorf("%w: it needs a subtotal of at least %s", ErrCouponNotApplicable, minSubtotal)
+		}
+	}
+
+	qualifies, err := s.qualifier(promotion)
+	if err != nil {
+		return zero, nil, err
+	}
+	weights := make([]models.Money, len(lines))
+	eligible := false
+	eligibleSubtotal := zero
+	eligibleLeft := zero
+	for i, line := range lines {
+		weights[i] = zero
+		if qualifies(line.product) {
+			eligible = true
+			weights[i] = lineLeft[i]
+			eligibleSubtotal = eligibleSubtotal.Add(line.price.Mul(line.quantity))
+			eligibleLeft = eligibleLeft.Add(lineLeft[i])
+		}
+	}
+	if !eligible {
+		return zero, nil, fmt.Errorf("%w: no items in the cart qualify", ErrCouponNotApplicable)
+	}
+
+	amount := zero
+	switch promotion.Type {
+	case models.PromotionPercentage:
+		amount = eligibleSubtotal.MulRat(big.NewRat(int64(promotion.Percent), 100))
+	case models.PromotionFixed:
+		if amount, err = s.currencyService.Convert(promotion.Amount, currency); err != nil {
+			return zero, nil, err
+		}
+	case models.PromotionBuyXGetY:
+		// The discount falls on the lines with free units, by their value
+		anyFree := false
+		eligibleLeft = zero
+		for i, line := range lines {
+			if !qualifies(line.product) {
+				continue
+			}
+			free := line.price.Mul(line.quantity / (promotion.BuyQuantity + promotion.GetQuantity) * promotion.GetQuantity)
+			anyFree = anyFree || !free.IsZero()
+			if weights[i].Less(free) {
+				free = weights[i]
+			}
+			weights[i] = free
+			amount = amount.Add(free)
+			eligibleLeft = eligibleLeft.Add(free)
+		}
+		if !anyFree {
+			return zero, nil, fmt.Errorf("%w: buy %d of a product to get %d more free", ErrCouponNotApplicable, promotion.BuyQuantity, promotion.GetQuantity)
+		}
+	case models.PromotionFreeShipping:
+		if shippingLeft.IsZero() {
+			return zero, nil, fmt.Errorf("%w: shipping is already free", ErrCouponNotApplicable)
+		}
+		return shippingLeft, nil, nil
+	}
+
+	if eligibleLeft.Less(amount) {
+		amount = eligibleLeft
+	}
+	if amount.IsZero() {
+		return zero, nil, fmt.Errorf("%w: there is nothing left to take off", ErrCouponNotApplicable)
+	}
+	return amount, weights, nil
+}
+
+// allocate shares amount out over lines in proportion to their weights.
+// The shares add up to amount and, as long as amount is no more than the
+// sum of the weights, none is more than its line's weight.
+func allocate(amount models.Money, weights []models.Money) []models.Money {
+	total := models.NewMoney(0, amount.Currency)
+	for _, weight := range weights {
+		total = total.Add(weight)
+	}
+
+	shares := make([]models.Money, len(weights))
+	cumulative := models.NewMoney(0, amount.Currency)
+	allocated := models.NewMoney(0, amount.Currency)
+	for i, weight := range weights {
+		cumulative = cumulative.Add(weight)
+		upTo := amount
+		if cumulative != total {
+			upTo = amount.MulRat(big.NewRat(cumulative.Amount, total.Amount))
+		}
+		shares[i] = upTo.Sub(allocated)
+		allocated = upTo
+	}
+	return shares
+}
+
+// qualifier returns a function that reports whether a product qualifies
+// for a promotion limited to a category, the categories under it, or a
+// brand
+func (s *PromotionService) qualifier(promotion *models.Promotion) (func(*models.Product) bool, error) {
+	var categories map[uint]bool
+	if promotion.CategoryID != nil {
+		ids, err := s.categoryRepo.GetDescendantIDs(*promotion.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+		categories = map[uint]bool{*promotion.CategoryID: true}
+		for _, id := range ids {
+			categories[id] = true
+		}
+	}
+
+	return func(product *models.Product) bool {
+		if categories != nil && !categories[product.CategoryID] {
+			return false
+		}
+		return promotion.Brand == "" || strings.EqualFold(product.Brand, promotion.Brand)
+	}, nil
+}
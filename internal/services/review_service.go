@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"store/internal/models"
+	"store/internal/repository"
+	"strings"
+)
+
+var (
+	// ErrReviewNotFound is returned when a review does not exist
+	ErrReviewNotFound = repository.ErrReviewNotFound
+	// ErrNotVerifiedBuyer is returned when a user reviews a product that has
+	// not been delivered to them
+	ErrNotVerifiedBuyer = errors.New("only customers who received the product can review it")
+	// ErrAlreadyReviewed is returned when a user reviews a product twice
+	ErrAlreadyReviewed = repository.ErrAlreadyReviewed
+	// ErrInvalidReviewStatus is returned for an unknown review status
+	ErrInvalidReviewStatus = errors.New("invalid review status")
+)
+
+// ReviewService provides product review operations
+type ReviewService struct {
+	reviewRepo  *repository.ReviewRepository
+	productRepo *repository.ProductRepository
+}
+
+// NewReviewService creates a new ReviewService
+func NewReviewService(reviewRepo *repository.ReviewRepository, productRepo *repository.ProductRepository) *ReviewService {
+	return &ReviewService{
+		reviewRepo:  reviewRepo,
+		productRepo: productRepo,
+	}
+}
+
+// CreateReview adds a user's review of a product. Only users with a
+// delivered order containing the product can review it, once. The review
+// waits for moderation before it is shown.
+func (s *ReviewService) CreateReview(review *models.Review) error {
+	if _, err := s.productRepo.GetProductByID(review.ProductID); err != nil {
+		return err
+	}
+
+	delivered, err := s.reviewRepo.HasDeliveredOrder(review.UserID, review.ProductID)
+	if err != nil {
+		return err
+	}
+	if !delivered {
+		return ErrNotVerifiedBuyer
+	}
+
+	reviewed, err := s.reviewRepo.HasReviewed(review.UserID, review.ProductID)
+	if err != nil {
+		return err
+	}
+	if reviewed {
+		return ErrAlreadyReviewed
+	}
+
+	review.Title = strings.TrimSpace(review.Title)
+	review.Body = strings.TrimSpace(review.Body)
+	review.Status = models.ReviewStatusPending
+	if err := s.reviewRepo.CreateReview(review); err != nil {
+		return err
+	}
+
+	created, err := s.reviewRepo.GetReviewByID(review.ID)
+	if err != nil {
+		return err
+	}
+	*review = *created
+	return nil
+}
+
+// GetProductReviews retrieves a page of a product's approved reviews, newest
+// first, and the number of them on all pages
+func (s *ReviewService) GetProductReviews(productID uint, page, limit int) ([]models.Review, int64, error) {
+	return s.reviewRepo.GetProductReviews(productID, models.ReviewStatusApproved, page, limit)
+}
+
+// GetReviews retrieves a page of reviews of all products with the given
+// status, oldest first, for moderation
+func (s *ReviewService) GetReviews(status models.ReviewStatus, page, limit int) ([]models.Review, int64, error) {
+	if !status.Valid() {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidReviewStatus, status)
+	}
+	return s.reviewRepo.GetReviewsByStatus(status, page, limit)
+}
+
+// ModerateReview sets the status of a review. Approving a review counts it
+// in its product's rating; rejecting it or sending it back to pending
+// removes it again.
+func (s *ReviewService) ModerateReview(id uint, status models.ReviewStatus) (*models.Review, error) {
+	if !status.Valid() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidReviewStatus, status)
+	}
+
+	review, err := s.reviewRepo.GetReviewByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.reviewRepo.UpdateReviewStatus(review, status); err != nil {
+		return nil, err
+	}
+	review.Status = status
+	return review, nil
+}
+
+// DeleteReview deletes a review
+func (s *ReviewService) DeleteReview(id uint) error {
+	review, err := s.reviewRepo.GetReviewByID(id)
+	if err != nil {
+		return err
+	}
+	return s.reviewRepo.DeleteReview(review)
+}
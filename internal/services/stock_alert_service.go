@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"store/internal/models"
+	"store/internal/repository"
+	"store/pkg/notify"
+	"time"
+)
+
+// ErrInStock is returned when subscribing to a product, or variant, that
+// is in stock
+var ErrInStock = errors.New("product is in stock")
+
+// stockCheckBatch is the number of low-stock products or restocked
+// subscriptions handled at a time by CheckStock
+const stockCheckBatch = 100
+
+// StockAlertService raises low-stock alerts for the store's staff and tells
+// subscribed customers when products are back in stock
+type StockAlertService struct {
+	alertRepo   *repository.StockAlertRepository
+	productRepo *repository.ProductRepository
+	notifier    Notifier
+}
+
+// NewStockAlertService creates a new StockAlertService
+func NewStockAlertService(alertRepo *repository.StockAlertRepository, productRepo *repository.ProductRepository, notifier Notifier) *StockAlertService {
+	return &StockAlertService{
+		alertRepo:   alertRepo,
+		productRepo: productRepo,
+		notifier:    notifier,
+	}
+}
+
+// Subscribe asks for a user to be notified when an out-of-stock product is
+// back in stock. Products with variants are subscribed to by variant.
+// Subscribing twice is the same as subscribing once.
+func (s *StockAlertService) Subscribe(userID, productID uint, variantID *uint) error {
+	product, err := s.productRepo.GetProductByID(productID)
+	if err != nil {
+		return err
+	}
+
+	available := product.Available()
+	switch {
+	case len(product.Variants) > 0 && variantID == nil:
+		return ErrVariantRequired
+	case len(product.Variants) == 0 && variantID != nil:
+		return ErrVariantNotFound
+	case variantID != nil:
+		variant, err := s.productRepo.GetVariantByID(productID, *variantID)
+		if err != nil {
+			return err
+		}
+		available = variant.Available()
+	}
+	if available > 0 {
+		return ErrInStock
+	}
+
+	return s.alertRepo.CreateSubscription(&models.StockSubscription{
+		ProductID: productID,
+		VariantID: variantID,
+		UserID:    userID,
+	})
+}
+
+// Unsubscribe cancels a user's back-in-stock subscription to a product, or
+// variant
+func (s *StockAlertService) Unsubscribe(userID, productID uint, variantID *uint) error {
+	return s.alertRepo.DeleteSubscription(userID, productID, variantID)
+}
+
+// GetAlerts retrieves a page of open, or resolved, stock alerts, newest
+// first, and the number of them on all pages
+func (s *StockAlertService) GetAlerts(open bool, page, limit int) ([]models.StockAlert, int64, error) {
+	return s.alertRepo.GetAlerts(open, page, limit)
+}
+
+// CheckStock raises an alert for each product whose available stock fell
+// to its reorder threshold, resolves the alerts of products that were
+// restocked, and notifies the subscribers of products back in stock. A
+// notification that cannot be delivered is logged and tried again on the
+// next check, without holding up the others.
+func (s *StockAlertService) CheckStock(ctx context.Context) error {
+	now := time.Now()
+	if _, err := s.alertRepo.ResolveAlerts(now); err != nil {
+		return fmt.Errorf("failed to resolve stock alerts: %w", err)
+	}
+
+	var afterID uint
+	for {
+		products, err := s.alertRepo.GetLowStockProducts(afterID, stockCheckBatch)
+		if err != nil {
+			return err
+		}
+		for i := range products {
+			if err := s.raiseAlert(ctx, &products[i]); err != nil {
+				log.Printf("Failed to raise stock alert: %v", err)
+			}
+		}
+		if len(products) < stockCheckBatch {
+			break
+		}
+		afterID = products[len(products)-1].ID
+	}
+
+	afterID = 0
+	for {
+		subscriptions, err := s.alertRepo.GetRestockedSubscriptions(afterID, stockCheckBatch)
+		if err != nil {
+			return err
+		}
+		for i := range subscriptions {
+			if err := s.notifySubscriber(ctx, &subscriptions[i], now); err != nil {
+				log.Printf("Failed to notify subscriber: %v", err)
+			}
+		}
+		if len(subscriptions) < stockCheckBatch {
+			return nil
+		}
+		afterID = subscriptions[len(subscriptions)-1].ID
+	}
+}
+
+// raiseAlert opens a stock alert for a product and tells the staff
+func (s *StockAlertService) raiseAlert(ctx context.Context, product *models.Product) error {
+	err := s.notifier.Notify(ctx, notify.Notification{
+		Kind:    notify.KindLowStock,
+		Subject: fmt.Sprintf("Low stock: %s", product.Name),
+		Body: fmt.Sprintf("%s (SKU %s) has %d available, at or below its reorder threshold of %d.",
+			product.Name, product.SKU, product.Available(), product.ReorderThreshold),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to notify low stock of product %d: %w", product.ID, err)
+	}
+
+	return s.alertRepo.CreateAlert(&models.StockAlert{
+		ProductID: product.ID,
+		Available: product.Available(),
+		Threshold: product.ReorderThreshold,
+	})
+}
+
+// notifySubscriber tells a customer that the product they subscribed to is
+// back in stock
+func (s *StockAlertService) notifySubscriber(ctx context.Context, subscription *models.StockSubscription, now time.Time) error {
+	notification := notify.Notification{
+		Kind:    notify.KindBackInStock,
+		UserID:  subscription.UserID,
+		Subject: fmt.Sprintf("%s is back in stock", subscription.Product.Name),
+		Body:    fmt.Sprintf("%s is available again.", subscription.Product.Name),
+	}
+	if subscription.User != nil {
+		notification.Email = subscription.User.Email
+	}
+
+	if err := s.notifier.Notify(ctx, notification); err != nil {
+		return fmt.Errorf("failed to notify subscription %d: %w", subscription.ID, err)
+	}
+	return s.alertRepo.MarkSubscriptionNotified(subscription.ID, now)
+}
+
+// RunStockWatcher checks stock every interval until ctx is done
+func (s *StockAlertService) RunStockWatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.CheckStock(ctx); err != nil {
+				log.Printf("Failed to check stock: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"store/internal/models"
+	"store/internal/repository"
+)
+
+// ErrInvalidStockAdjustment is returned for a stock adjustment that changes
+// nothing, takes stock below zero or has an unknown reason
+var ErrInvalidStockAdjustment = errors.New("invalid stock adjustment")
+
+// StockAdjustment is a manual change of the stock of a product, or of one
+// of its variants. Either Quantity is the change, negative to take stock
+// out, or Count is the stock counted on hand, and the change is whatever
+// makes the stock match it.
+type StockAdjustment struct {
+	ProductID uint
+	VariantID *uint
+	Quantity  int
+	Count     *int
+	Reason    models.StockMovementReason
+	Reference string
+	Note      string
+}
+
+// StockService keeps the stock ledger
+type StockService struct {
+	db           *repository.Database
+	movementRepo *repository.StockMovementRepository
+}
+
+// NewStockService creates a new StockService
+func NewStockService(db *repository.Database, movementRepo *repository.StockMovementRepository) *StockService {
+	return &StockService{
+		db:           db,
+		movementRepo: movementRepo,
+	}
+}
+
+// AdjustStock applies a manual stock adjustment on behalf of actorID and
+// records it in the stock ledger. Products with variants are adjusted by
+// variant. Stock cannot be taken below what is reserved for unpaid orders.
+func (s *StockService) AdjustStock(adjustment StockAdjustment, actorID uint) (*models.StockMovement, error) {
+	if !adjustment.Reason.Valid() {
+		return nil, fmt.Errorf("%w: unknown reason %s", ErrInvalidStockAdjustment, adjustment.Reason)
+	}
+
+	movement := &models.StockMovement{
+		ProductID: adjustment.ProductID,
+		VariantID: adjustment.VariantID,
+		Reason:    adjustment.Reason,
+		Reference: adjustment.Reference,
+		Note:      adjustment.Note,
+		ActorID:   &actorID,
+	}
+
+	err := s.db.Transaction(func(tx *repository.Database) error {
+		productRepo := repository.NewProductRepository(tx)
+
+		// Lock the product, then the variant, as checkout does
+		products, err := productRepo.GetProductsForUpdate([]uint{adjustment.ProductID})
+		if err != nil {
+			return err
+		}
+		if len(products) == 0 {
+			return ErrProductNotFound
+		}
+		stock, reserved := products[0].Stock, products[0].Reserved
+
+		if adjustment.VariantID != nil {
+			variants, err := productRepo.GetVariantsForUpdate([]uint{*adjustment.VariantID})
+			if err != nil {
+				return err
+			}
+			if len(variants) == 0 || variants[0].ProductID != adjustment.ProductID {
+				return ErrVariantNotFound
+			}
+			stock, reserved = variants[0].Stock, variants[0].Reserved
+		} else {
+			counts, err := productRepo.CountVariants([]uint{adjustment.ProductID})
+			if err != nil {
+				return err
+			}
+			if counts[adjustment.ProductID] > 0 {
+				return ErrVariantRequired
+			}
+		}
+
+		movement.Quantity = adjustment.Quantity
+		if adjustment.Count != nil {
+			movement.Quantity = *adjustment.Count - stock
+		}
+		switch {
+		case movement.Quantity == 0:
+			return fmt.Errorf("%w: stock is already %d", ErrInvalidStockAdjustment, stock)
+		case stock+movement.Quantity < 0:
+			return fmt.Errorf("%w: only %d in stock", ErrInvalidStockAdjustment, stock)
+		case stock+movement.Quantity < reserved:
+			return fmt.Errorf("%w: %d reserved", ErrStockBelowReserved, reserved)
+		}
+
+		if adjustment.VariantID != nil {
+			err = productRepo.AdjustVariantStock(adjustment.ProductID, *adjustment.VariantID, movement.Quantity)
+		} else {
+			err = productRepo.AdjustStock(adjustment.ProductID, movement.Quantity)
+		}
+		if err != nil {
+			return err
+		}
+		return repository.NewStockMovementRepository(tx).CreateMovement(movement)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return movement, nil
+}
+
+// GetMovements retrieves a page of the stock movements of a product, or of
+// one of its variants, newest first, and the number of them on all pages
+func (s *StockService) GetMovements(productID uint, variantID *uint, page, limit int) ([]models.StockMovement, int64, error) {
+	return s.movementRepo.GetMovements(productID, variantID, page, limit)
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"store/config"
+	"store/internal/models"
+	"store/internal/repository"
+	"store/pkg/payment"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// testDatabaseDSN names the environment variable holding the DSN of the
+// Postgres database the database tests run against, e.g.
+// "host=localhost user=postgres password=postgres dbname=store_test
+// sslmode=disable". The tests empty it, so it must be a throwaway database.
+const testDatabaseDSN = "TEST_DATABASE_DSN"
+
+// testRegion is the tax region test orders ship to
+const testRegion = "DE"
+
+// testStore is a store backed by the test database, with a fake payment
+// gateway
+type testStore struct {
+	db       *repository.Database
+	gateway  *payment.FakeGateway
+	payments *PaymentService
+	orders   *OrderService
+	category *models.Category
+}
+
+// newTestDatabase connects to the test database and empties it. The test is
+// skipped when no test database is configured, and fails when the one
+// configured cannot be used.
+func newTestDatabase(t *testing.T) *repository.Database {
+	t.Helper()
+
+	dsn := os.Getenv(testDatabaseDSN)
+	if dsn == "" {
+		t.Skipf("%s not set", testDatabaseDSN)
+	}
+
+	db, err := repository.OpenDatabase(dsn)
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	db.DB.Logger = logger.Discard
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	var tables []string
+	err = db.DB.Raw(`SELECT quote_ident(tablename) FROM pg_tables WHERE schemaname = current_schema()`).Scan(&tables).Error
+	if err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+	if len(tables) > 0 {
+		if err := db.DB.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE").Error; err != nil {
+			t.Fatalf("failed to empty test database: %v", err)
+		}
+	}
+	return db
+}
+
+// newTestStore wires the order and payment services to an empty test
+// database. Orders are placed in USD and taxed in testRegion only.
+func newTestStore(t *testing.T) *testStore {
+	t.Helper()
+
+	db := newTestDatabase(t)
+	orderRepo := repository.NewOrderRepository(db)
+
+	currencyService := NewCurrencyService(repository.NewCurrencyRepository(db), "USD")
+	taxService := NewTaxService(repository.NewTaxRepository(db), false)
+	promotionService := NewPromotionService(repository.NewPromotionRepository(db), repository.NewCategoryRepository(db),
+		currencyService, taxService, models.NewMoney(0, "USD"))
+	gateway := payment.NewFakeGateway()
+	paymentService := NewPaymentService(&config.Config{}, orderRepo, gateway)
+	orderService := NewOrderService(db, orderRepo, repository.NewCartRepository(db), repository.NewProductRepository(db),
+		paymentService, currencyService, promotionService, 30*time.Minute)
+
+	err := taxService.SetRates([]models.TaxRate{{Region: testRegion, TaxClass: models.TaxClassStandard, Rate: "19", Name: "VAT"}})
+	if err != nil {
+		t.Fatalf("failed to create tax rate: %v", err)
+	}
+
+	category := &models.Category{Name: "Test", Slug: "test"}
+	if err := db.DB.Create(category).Error; err != nil {
+		t.Fatalf("failed to create category: %v", err)
+	}
+
+	return &testStore{
+		db:       db,
+		gateway:  gateway,
+		payments: paymentService,
+		orders:   orderService,
+		category: category,
+	}
+}
+
+// createProduct adds a product priced at 10.00 USD with stock in stock
+func (s *testStore) createProduct(t *testing.T, stock int) *models.Product {
+	t.Helper()
+
+	product := &models.Product{
+		Name:         fmt.Sprintf("Product %d", stock),
+		Price:        models.NewMoney(1000, "USD"),
+		CategoryID:   s.category.ID,
+		CategoryName: s.category.Name,
+		TaxClass:     models.TaxClassStandard,
+		Stock:        stock,
+	}
+	if err := s.db.DB.Create(product).Error; err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
+	return product
+}
+
+// createCustomer adds a user with quantity of product in their cart
+func (s *testStore) createCustomer(t *testing.T, product *models.Product, quantity int) uint {
+	t.Helper()
+
+	var count int64
+	if err := s.db.DB.Model(&models.User{}).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count users: %v", err)
+	}
+	user := &models.User{
+		Email:    fmt.Sprintf("customer%d@example.com", count+1),
+		Password: "password",
+		Name:     "Customer",
+		Phone:    "+10000000000",
+		Role:     models.RoleUser,
+	}
+	if err := s.db.DB.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	cart := &models.Cart{
+		UserID: &user.ID,
+		Items: []models.CartItem{{
+			ProductID: product.ID,
+			Quantity:  quantity,
+			Price:     product.Price,
+		}},
+	}
+	if err := s.db.DB.Create(cart).Error; err != nil {
+		t.Fatalf("failed to create cart: %v", err)
+	}
+	return user.ID
+}
+
+// product reloads a product's stock figures
+func (s *testStore) product(t *testing.T, id uint) *models.Product {
+	t.Helper()
+
+	var product models.Product
+	if err := s.db.DB.First(&product, id).Error; err != nil {
+		t.Fatalf("failed to load product %d: %v", id, err)
+	}
+	return &product
+}
+
+// order reloads an order
+func (s *testStore) order(t *testing.T, id uint) *models.Order {
+	t.Helper()
+
+	order, err := s.orders.GetOrderByID(id)
+	if err != nil {
+		t.Fatalf("failed to load order %d: %v", id, err)
+	}
+	return order
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"store/internal/models"
+	"store/internal/repository"
+	"strings"
+)
+
+var (
+	// ErrTaxRateNotFound is returned when a tax rate does not exist
+	ErrTaxRateNotFound = repository.ErrTaxRateNotFound
+	// ErrInvalidTaxRegion is returned for a region that is not a country
+	// code, optionally followed by a subdivision code
+	ErrInvalidTaxRegion = errors.New("invalid tax region")
+	// ErrInvalidTaxRate is returned for a tax rate that cannot be saved as
+	// given
+	ErrInvalidTaxRate = errors.New("invalid tax rate")
+	// ErrUnsupportedTaxRegion is returned when an order ships to a region no
+	// tax rate applies in
+	ErrUnsupportedTaxRegion = errors.New("no tax rates for region")
+)
+
+// taxRegionPattern matches tax regions: an ISO 3166-1 country code,
+// optionally followed by an ISO 3166-2 subdivision code, e.g. "US-CA"
+var taxRegionPattern = regexp.MustCompile(`^[A-Z]{2}(-[A-Z0-9]{1,3})?$`)
+
+// lineTax is the tax on one line of a cart or order
+type lineTax struct {
+	class string
+	rate  string // percentage, as stored
+	tax   models.Money
+}
+
+// TaxService keeps the tax rates and works out the tax of carts and
+// orders. Tax rates are percentages per region and tax class; prices either
+// include tax or have it added on top.
+type TaxService struct {
+	taxRepo          *repository.TaxRepository
+	pricesIncludeTax bool
+}
+
+// NewTaxService creates a new TaxService. With pricesIncludeTax, product
+// prices and the shipping cost are taken to include tax.
+func NewTaxService(taxRepo *repository.TaxRepository, pricesIncludeTax bool) *TaxService {
+	return &TaxService{
+		taxRepo:          taxRepo,
+		pricesIncludeTax: pricesIncludeTax,
+	}
+}
+
+// PricesIncludeTax reports whether prices include tax
+func (s *TaxService) PricesIncludeTax() bool {
+	return s.pricesIncludeTax
+}
+
+// GetRates retrieves all tax rates
+func (s *TaxService) GetRates() ([]models.TaxRate, error) {
+	return s.taxRepo.GetTaxRates()
+}
+
+// SetRates creates or updates tax rates, matching them by region and tax
+// class. Rates not listed are left unchanged.
+func (s *TaxService) SetRates(rates []models.TaxRate) error {
+	for i := range rates {
+		rate := &rates[i]
+
+		region, err := ResolveTaxRegion(rate.Region)
+		if err != nil {
+			return err
+		}
+		rate.Region = region
+
+		rate.TaxClass = normalizeTaxClass(rate.TaxClass)
+		rate.Name = strings.TrimSpace(rate.Name)
+
+		r, ok := new(big.Rat).SetString(rate.Rate)
+		if !ok || r.Sign() < 0 || r.Cmp(big.NewRat(100, 1)) > 0 {
+			return fmt.Errorf("%w: %s for %s in %q must be a percentage between 0 and 100", ErrInvalidTaxRate, rate.Rate, rate.TaxClass, rate.Region)
+		}
+		rate.Rate = r.FloatString(4)
+	}
+
+	return s.taxRepo.SaveTaxRates(rates)
+}
+
+// DeleteRate deletes a tax rate
+func (s *TaxService) DeleteRate(id uint) error {
+	return s.taxRepo.DeleteTaxRate(id)
+}
+
+// ResolveTaxRegion normalises a tax region. An empty region means
+// wherever no other rate applies.
+func ResolveTaxRegion(region string) (string, error) {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if region != "" && !taxRegionPattern.MatchString(region) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTaxRegion, region)
+	}
+	return region, nil
+}
+
+// normalizeTaxClass makes tax classes case-insensitive; an empty class is
+// the standard one
+func normalizeTaxClass(class string) string {
+	class = strings.ToLower(strings.TrimSpace(class))
+	if class == "" {
+		return models.TaxClassStandard
+	}
+	return class
+}
+
+// checkRegion makes sure some tax rate applies in region, so orders
+// shipped there are not left untaxed by mistake
+func (s *TaxService) checkRegion(region string) error {
+	rates, err := s.rates(region)
+	if err != nil {
+		return err
+	}
+	if len(rates) == 0 {
+		return fmt.Errorf("%w %q", ErrUnsupportedTaxRegion, region)
+	}
+	return nil
+}
+
+// rates retrieves the tax rates that apply in a region, keyed by tax class.
+// The rate of a subdivision applies before that of its country, and that of
+// a country before the rate for everywhere else.
+func (s *TaxService) rates(region string) (map[string]models.TaxRate, error) {
+	regions := []string{region}
+	if country, _, ok := strings.Cut(region, "-"); ok {
+		regions = append(regions, country)
+	}
+	if region != "" {
+		regions = append(regions, "")
+	}
+
+	rates, err := s.taxRepo.GetTaxRatesForRegions(regions)
+	if err != nil {
+		return nil, err
+	}
+
+	byClass := make(map[string]models.TaxRate, len(rates))
+	for _, rate := range rates {
+		if existing, ok := byClass[rate.TaxClass]; !ok || len(rate.Region) > len(existing.Region) {
+			byClass[rate.TaxClass] = rate
+		}
+	}
+	return byClass, nil
+}
+
+// apply works out the tax of a priced cart or order in region and sets
+// pricing.Tax and the tax of each line. Each line is taxed after what the
+// item discounts that apply to it took off it, and shipping after free
+// shipping discounts. Without a rate for a tax class, it is not taxed.
+func (s *TaxService) apply(pricing *Pricing, lines []basketLine, region string) error {
+	rates, err := s.rates(region)
+	if err != nil {
+		return err
+	}
+
+	currency := pricing.Subtotal.Currency
+	shippingDiscount := models.NewMoney(0, currency)
+	for _, discount := range pricing.Discounts {
+		if discount.Type == models.PromotionFreeShipping {
+			shippingDiscount = shippingDiscount.Add(discount.Amount)
+		}
+	}
+
+	pricing.Tax = models.NewMoney(0, currency)
+	pricing.lineTaxes = make([]lineTax, len(lines))
+	for i, line := range lines {
+		taxable := line.price.Mul(line.quantity).Sub(pricing.lineDiscounts[i])
+
+		class := normalizeTaxClass(line.product.TaxClass)
+		tax, rate, err := s.taxOn(taxable, rates[class])
+		if err != nil {
+			return err
+		}
+		pricing.lineTaxes[i] = lineTax{class: class, rate: rate, tax: tax}
+		pricing.Tax = pricing.Tax.Add(tax)
+	}
+
+	tax, _, err := s.taxOn(pricing.Shipping.Sub(shippingDiscount), rates[models.TaxClassShipping])
+	if err != nil {
+		return err
+	}
+	pricing.Tax = pricing.Tax.Add(tax)
+	return nil
+}
+
+// taxOn works out the tax on an amount at a rate, which is the zero
+// TaxRate when none applies. It also returns the rate as stored.
+func (s *TaxService) taxOn(amount models.Money, rate models.TaxRate) (models.Money, string, error) {
+	if rate.Rate == "" {
+		return models.NewMoney(0, amount.Currency), "0", nil
+	}
+
+	percent, ok := new(big.Rat).SetString(rate.Rate)
+	if !ok {
+		return models.Money{}, "", fmt.Errorf("invalid tax rate for %s in %q: %s", rate.TaxClass, rate.Region, rate.Rate)
+	}
+
+	// Tax included in a price is rate / (100 + rate) of it
+	base := big.NewRat(100, 1)
+	if s.pricesIncludeTax {
+		base.Add(base, percent)
+	}
+	return amount.MulRat(new(big.Rat).Quo(percent, base)), rate.Rate, nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"log"
 	"store/internal/models"
 	"store/internal/repository"
 	"store/pkg/auth"
@@ -9,15 +10,17 @@ import (
 
 // UserService provides user-related operations
 type UserService struct {
-	userRepo   *repository.UserRepository
-	jwtService *auth.JWTService
+	userRepo    *repository.UserRepository
+	jwtService  *auth.JWTService
+	cartService *CartService
 }
 
 // NewUserService creates a new UserService
-func NewUserService(userRepo *repository.UserRepository, jwtService *auth.JWTService) *UserService {
+func NewUserService(userRepo *repository.UserRepository, jwtService *auth.JWTService, cartService *CartService) *UserService {
 	return &UserService{
-		userRepo:   userRepo,
-		jwtService: jwtService,
+		userRepo:    userRepo,
+		jwtService:  jwtService,
+		cartService: cartService,
 	}
 }
 
@@ -38,26 +41,38 @@ func (s *UserService) RegisterUser(user *models.User) error {
 	return s.userRepo.CreateUser(user)
 }
 
-// LoginUser authenticates a user and returns a JWT token
-func (s *UserService) LoginUser(email, password string) (string, error) {
+// LoginUser authenticates a user and returns a JWT token. The guest cart
+// with guestCartToken, if any, is merged into the user's cart; cartMerged
+// reports whether that succeeded, so the guest keeps the token otherwise
+// and the merge is tried again at the next login.
+func (s *UserService) LoginUser(email, password, guestCartToken string) (token string, cartMerged bool, err error) {
 	// Get the user
 	user, err := s.userRepo.GetUserByEmail(email)
 	if err != nil {
-		return "", errors.New("invalid email or password")
+		return "", false, errors.New("invalid email or password")
 	}
 
 	// Verify password
 	if err := user.ComparePassword(password); err != nil {
-		return "", errors.New("invalid email or password")
+		return "", false, errors.New("invalid email or password")
 	}
 
 	// Generate token
-	token, err := s.jwtService.GenerateToken(user)
+	token, err = s.jwtService.GenerateToken(user)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
-	return token, nil
+	// Keep what the user put in their cart before signing in. The login
+	// stands even if that fails.
+	if guestCartToken != "" {
+		if err := s.cartService.MergeGuestCart(user.ID, guestCartToken); err != nil {
+			log.Printf("Failed to merge guest cart into the cart of user %d: %v", user.ID, err)
+			return token, false, nil
+		}
+	}
+
+	return token, true, nil
 }
 
 // GetUserByID retrieves a user by ID
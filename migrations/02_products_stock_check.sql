@@ -0,0 +1,9 @@
+-- Stock can never go negative, even if a concurrent checkout slips past the
+-- application-level checks
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_products_stock') THEN
+        ALTER TABLE products
+            ADD CONSTRAINT chk_products_stock CHECK (stock >= 0);
+    END IF;
+END $$;
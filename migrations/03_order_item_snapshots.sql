@@ -0,0 +1,18 @@
+-- Products get an optional, unique SKU
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sku VARCHAR(100);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_products_sku ON products(sku) WHERE sku <> '';
+
+-- Order items keep a snapshot of the product at purchase time
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS product_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS product_sku VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS product_image_url VARCHAR(512);
+
+-- Backfill snapshots for existing order items from the current products
+UPDATE order_items oi
+SET product_name      = p.name,
+    product_sku       = p.sku,
+    product_image_url = p.image_url
+FROM products p
+WHERE p.id = oi.product_id
+  AND oi.product_name = '';
@@ -0,0 +1,11 @@
+-- Processed payment provider webhook events, used to apply each event once
+CREATE TABLE IF NOT EXISTS payment_events (
+    id SERIAL PRIMARY KEY,
+    event_id VARCHAR(255) UNIQUE NOT NULL,
+    type VARCHAR(100) NOT NULL,
+    payment_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_events_payment_id ON payment_events(payment_id);
+CREATE INDEX IF NOT EXISTS idx_orders_payment_id ON orders(payment_id);
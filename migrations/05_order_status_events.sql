@@ -0,0 +1,20 @@
+-- Timeline of order status changes
+CREATE TABLE IF NOT EXISTS order_status_events (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    actor_id INT,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_id) REFERENCES orders(id),
+    FOREIGN KEY (actor_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_events_order_id ON order_status_events(order_id);
+
+-- Existing orders start their history with their current status
+INSERT INTO order_status_events (order_id, to_status, reason, created_at)
+SELECT id, status, 'imported', created_at
+FROM orders
+WHERE NOT EXISTS (SELECT 1 FROM order_status_events e WHERE e.order_id = orders.id);
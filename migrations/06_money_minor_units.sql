@@ -0,0 +1,52 @@
+-- Store money as integer minor units plus a currency code instead of
+-- DECIMAL(10, 2). Existing amounts are assumed to be in USD (two decimals)
+-- and are rounded half away from zero, matching models.Money.
+--
+-- The application migrates its schema on startup, so the new columns may
+-- already exist when this runs. Amounts are only converted while the old
+-- columns are still there, so running it again is safe.
+
+-- Products
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS price_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS price_currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'products' AND column_name = 'price') THEN
+        UPDATE products SET price_amount = ROUND(price * 100) WHERE price IS NOT NULL;
+        UPDATE products SET price_currency = 'USD' WHERE price_currency = '';
+        ALTER TABLE products DROP COLUMN price;
+    END IF;
+END $$;
+ALTER TABLE products ALTER COLUMN price_currency DROP DEFAULT;
+DROP INDEX IF EXISTS idx_products_price;
+CREATE INDEX IF NOT EXISTS idx_products_price_amount ON products(price_amount);
+
+-- Orders
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS total_currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'orders' AND column_name = 'total_amount') = 'numeric' THEN
+        ALTER TABLE orders ALTER COLUMN total_amount TYPE BIGINT USING ROUND(total_amount * 100);
+        UPDATE orders SET total_currency = 'USD' WHERE total_currency = '';
+    END IF;
+END $$;
+ALTER TABLE orders ALTER COLUMN total_currency DROP DEFAULT;
+
+-- Order items
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS price_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS price_currency VARCHAR(3) NOT NULL DEFAULT 'USD';
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'order_items' AND column_name = 'price') THEN
+        UPDATE order_items SET price_amount = ROUND(price * 100) WHERE price IS NOT NULL;
+        UPDATE order_items SET price_currency = 'USD' WHERE price_currency = '';
+        ALTER TABLE order_items DROP COLUMN price;
+    END IF;
+END $$;
+ALTER TABLE order_items ALTER COLUMN price_currency DROP DEFAULT;
@@ -0,0 +1,25 @@
+-- Multi-currency pricing: product prices stay in the base currency, with
+-- optional fixed prices per currency; other currencies are converted at the
+-- exchange rates below. Orders record the rate they were placed at.
+
+-- Exchange rates: units of the currency per unit of the base currency
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    currency VARCHAR(3) PRIMARY KEY,
+    rate NUMERIC(20, 10) NOT NULL CHECK (rate > 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-currency price overrides
+CREATE TABLE IF NOT EXISTS product_prices (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    currency VARCHAR(3) NOT NULL,
+    amount BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_prices_product_currency ON product_prices(product_id, currency);
+
+-- Orders placed so far were in the base currency. The application may
+-- already have added the column on startup.
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(20, 10) NOT NULL DEFAULT 1;
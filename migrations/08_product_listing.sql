@@ -0,0 +1,22 @@
+-- Product listing: units sold for sorting by popularity, and indexes
+-- matching each sort order (ties broken by id) for keyset pagination.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS sold_count INT NOT NULL DEFAULT 0;
+
+-- Count what has been sold so far, leaving out cancelled orders. The
+-- column may have been added empty by the application on startup, so this
+-- runs either way.
+UPDATE products p
+SET sold_count = s.quantity
+FROM (
+    SELECT oi.product_id, SUM(oi.quantity) AS quantity
+    FROM order_items oi
+    JOIN orders o ON o.id = oi.order_id
+    WHERE o.status <> 'cancelled'
+    GROUP BY oi.product_id
+) s
+WHERE s.product_id = p.id;
+
+CREATE INDEX IF NOT EXISTS idx_products_sold_count ON products(sold_count, id);
+CREATE INDEX IF NOT EXISTS idx_products_created_at ON products(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_products_price_amount_id ON products(price_amount, id);
+CREATE INDEX IF NOT EXISTS idx_products_name ON products(name, id);
@@ -0,0 +1,11 @@
+-- Full-text product search. The russian configuration stems Cyrillic words
+-- as Russian and Latin words as English. Names weigh most, then brand and
+-- category, then description. The application may already have added the
+-- column on startup.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(brand, '') || ' ' || coalesce(category, '')), 'B') ||
+    setweight(to_tsvector('russian', coalesce(description, '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN (search_vector);
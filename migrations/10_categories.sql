@@ -0,0 +1,58 @@
+-- Categories become their own table, nested through parent_id. Products
+-- reference their category by id; products.category keeps a copy of the
+-- category's name for full-text search.
+--
+-- The application migrates its schema on startup and cannot add the
+-- required category_id to a products table that has rows, so run this
+-- before starting the new version. Running it again is safe.
+CREATE TABLE IF NOT EXISTS categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    parent_id INT REFERENCES categories(id) ON DELETE RESTRICT,
+    sort_order INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id INT REFERENCES categories(id) ON DELETE RESTRICT;
+
+-- One top-level category per distinct category string, ignoring case and
+-- surrounding spaces. The most common spelling becomes the name. Products
+-- without a category go to "Uncategorized". Slugs that collide get a
+-- numeric suffix; admins can rename slugs and nest categories afterwards.
+-- Only products without a category yet are looked at, and names that
+-- already have a category are skipped.
+WITH names AS (
+    SELECT DISTINCT ON (lower(name)) name
+    FROM (
+        SELECT COALESCE(NULLIF(trim(category), ''), 'Uncategorized') AS name, COUNT(*) AS uses
+        FROM products
+        WHERE category_id IS NULL
+        GROUP BY 1
+    ) spellings
+    WHERE NOT EXISTS (SELECT 1 FROM categories c WHERE lower(c.name) = lower(spellings.name))
+    ORDER BY lower(name), uses DESC, name
+), slugs AS (
+    SELECT name,
+           COALESCE(NULLIF(trim(BOTH '-' FROM lower(regexp_replace(name, '[^[:alnum:]]+', '-', 'g'))), ''), 'category') AS slug
+    FROM names
+), numbered AS (
+    SELECT name, slug, row_number() OVER (PARTITION BY slug ORDER BY name) AS n
+    FROM slugs
+)
+INSERT INTO categories (name, slug)
+SELECT name, CASE WHEN n = 1 THEN slug ELSE slug || '-' || n END
+FROM numbered
+ON CONFLICT (slug) DO NOTHING;
+
+UPDATE products p
+SET category_id = c.id, category = c.name
+FROM categories c
+WHERE p.category_id IS NULL
+  AND lower(c.name) = lower(COALESCE(NULLIF(trim(p.category), ''), 'Uncategorized'));
+
+ALTER TABLE products ALTER COLUMN category_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_products_category_id ON products(category_id);
@@ -0,0 +1,26 @@
+-- Product variants, e.g. sizes and colours, each with its own SKU, price
+-- and stock. A product with variants has the sum of their stock as its own.
+CREATE TABLE IF NOT EXISTS product_variants (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku VARCHAR(100),
+    options JSONB NOT NULL,
+    price_amount BIGINT,
+    stock INT DEFAULT 0 CONSTRAINT chk_product_variants_stock CHECK (stock >= 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_variants_product_id ON product_variants(product_id);
+CREATE INDEX IF NOT EXISTS idx_product_variants_deleted_at ON product_variants(deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_variants_sku ON product_variants(sku) WHERE sku <> '';
+
+-- Cart lines and order lines can point at a variant. The application may
+-- already have added the columns on startup.
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS variant_id INT REFERENCES product_variants(id);
+CREATE INDEX IF NOT EXISTS idx_cart_items_variant_id ON cart_items(variant_id);
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS variant_id INT REFERENCES product_variants(id),
+    ADD COLUMN IF NOT EXISTS variant_options JSONB;
@@ -0,0 +1,17 @@
+-- Product image galleries. Each image is stored as the re-encoded original
+-- and small, medium and large thumbnails; files holds their storage keys and
+-- urls their public URLs. The first image by position is the main image,
+-- copied to products.image_url.
+CREATE TABLE IF NOT EXISTS product_images (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    position INT NOT NULL DEFAULT 0,
+    alt_text TEXT,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    files JSONB NOT NULL,
+    urls JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_images_product_id ON product_images(product_id);
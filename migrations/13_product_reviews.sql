@@ -0,0 +1,25 @@
+-- Product reviews by customers who received the product. Only approved
+-- reviews count towards the product's average rating and review count.
+CREATE TABLE IF NOT EXISTS reviews (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    rating INT NOT NULL CONSTRAINT chk_reviews_rating CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(255),
+    body TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reviews_product_user ON reviews(product_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_reviews_user_id ON reviews(user_id);
+CREATE INDEX IF NOT EXISTS idx_reviews_status ON reviews(status);
+
+-- The application may already have added these on startup
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS rating NUMERIC(3,2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS review_count INT NOT NULL DEFAULT 0;
+
+-- Sorting by rating, ties broken by id
+CREATE INDEX IF NOT EXISTS idx_products_rating ON products(rating, id);
@@ -0,0 +1,38 @@
+-- Stock is reserved when an order is placed and only taken out of stock
+-- when it is paid. Reserved counts the stock held by active reservations;
+-- the stock available to sell is stock - reserved. The application may
+-- already have added the columns and their checks on startup.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS reserved INT NOT NULL DEFAULT 0;
+ALTER TABLE product_variants ADD COLUMN IF NOT EXISTS reserved INT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_products_reserved') THEN
+        ALTER TABLE products
+            ADD CONSTRAINT chk_products_reserved CHECK (reserved >= 0);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_product_variants_reserved') THEN
+        ALTER TABLE product_variants
+            ADD CONSTRAINT chk_product_variants_reserved CHECK (reserved >= 0);
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id),
+    product_id INT NOT NULL REFERENCES products(id),
+    variant_id INT REFERENCES product_variants(id),
+    quantity INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_order_id ON stock_reservations(order_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_product_id ON stock_reservations(product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_variant_id ON stock_reservations(variant_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_expires_at ON stock_reservations(expires_at);
+
+-- Orders placed before this migration took their stock when they were
+-- placed and have no reservations; cancelling them restocks their items.
@@ -0,0 +1,33 @@
+-- Ledger of every change of product and variant stock: sales, restocks,
+-- manual adjustments, returns and cancellations. Quantity is the change,
+-- negative when stock went down; stock_after is the stock it left.
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id),
+    variant_id INT REFERENCES product_variants(id),
+    quantity INT NOT NULL,
+    stock_after INT NOT NULL,
+    reason VARCHAR(20) NOT NULL,
+    reference VARCHAR(100),
+    note TEXT,
+    actor_id INT REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product_id ON stock_movements(product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_variant_id ON stock_movements(variant_id);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_reference ON stock_movements(reference);
+CREATE INDEX IF NOT EXISTS idx_stock_movements_created_at ON stock_movements(created_at);
+
+-- Open the ledger with the stock on hand, so that the movements of every
+-- product and variant add up to its stock
+INSERT INTO stock_movements (product_id, quantity, stock_after, reason, note)
+SELECT p.id, p.stock, p.stock, 'adjustment', 'opening balance'
+FROM products p
+WHERE p.stock <> 0 AND p.deleted_at IS NULL
+  AND NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.deleted_at IS NULL);
+
+INSERT INTO stock_movements (product_id, variant_id, quantity, stock_after, reason, note)
+SELECT v.product_id, v.id, v.stock, v.stock, 'adjustment', 'opening balance'
+FROM product_variants v
+WHERE v.stock <> 0 AND v.deleted_at IS NULL;
@@ -0,0 +1,54 @@
+-- Low-stock alerts for the staff, back-in-stock subscriptions for
+-- customers, and the outbox their notifications are queued in. The
+-- application may already have added the reorder threshold and its check
+-- on startup.
+ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_threshold INT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_products_reorder_threshold') THEN
+        ALTER TABLE products
+            ADD CONSTRAINT chk_products_reorder_threshold CHECK (reorder_threshold >= 0);
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS stock_alerts (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    available INT NOT NULL,
+    threshold INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolved_at TIMESTAMP
+);
+
+-- At most one open alert per product
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_alerts_open ON stock_alerts(product_id) WHERE resolved_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_stock_alerts_resolved_at ON stock_alerts(resolved_at);
+
+CREATE TABLE IF NOT EXISTS stock_subscriptions (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    variant_id INT REFERENCES product_variants(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    notified_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_subscriptions_product_id ON stock_subscriptions(product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_subscriptions_variant_id ON stock_subscriptions(variant_id);
+CREATE INDEX IF NOT EXISTS idx_stock_subscriptions_user_id ON stock_subscriptions(user_id);
+CREATE INDEX IF NOT EXISTS idx_stock_subscriptions_notified_at ON stock_subscriptions(notified_at);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(30) NOT NULL,
+    user_id INT REFERENCES users(id),
+    email VARCHAR(255),
+    subject VARCHAR(255) NOT NULL,
+    body TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_sent_at ON notifications(sent_at);
@@ -0,0 +1,11 @@
+-- Carts of visitors who have not signed in. A guest cart has no user and is
+-- found by the token handed to the guest; it is merged into the user's cart
+-- when the guest signs in, or deleted once it has been idle for
+-- GUEST_CART_TTL. The application may already have added the token on
+-- startup.
+ALTER TABLE carts
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS guest_token VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_carts_guest_token ON carts(guest_token) WHERE guest_token <> '';
+CREATE INDEX IF NOT EXISTS idx_carts_user_id ON carts(user_id);
@@ -0,0 +1,16 @@
+-- The price a cart item was added at, in the store currency, so the cart
+-- can warn when the price changes. Existing items take their product's, or
+-- variant's, current price. Items that already have a price keep it, so
+-- running this again is safe.
+ALTER TABLE cart_items
+    ADD COLUMN IF NOT EXISTS price_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS price_currency VARCHAR(3) NOT NULL DEFAULT '';
+
+UPDATE cart_items i
+SET price_amount = COALESCE(
+        (SELECT v.price_amount FROM product_variants v WHERE v.id = i.variant_id),
+        p.price_amount),
+    price_currency = p.price_currency
+FROM products p
+WHERE p.id = i.product_id
+  AND i.price_currency = '';
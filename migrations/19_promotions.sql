@@ -0,0 +1,69 @@
+-- Promotions and coupons, the discount lines they leave on orders, and the
+-- breakdown of order totals into subtotal, discount and shipping. Existing
+-- orders had neither discounts nor shipping, so their subtotal is their
+-- total. Orders that already have a subtotal keep it, so running this again
+-- is safe.
+CREATE TABLE IF NOT EXISTS promotions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    code VARCHAR(50) NOT NULL DEFAULT '',
+    type VARCHAR(20) NOT NULL,
+    percent INT NOT NULL DEFAULT 0,
+    amount_amount BIGINT NOT NULL DEFAULT 0,
+    amount_currency VARCHAR(3) NOT NULL,
+    buy_quantity INT NOT NULL DEFAULT 0,
+    get_quantity INT NOT NULL DEFAULT 0,
+    min_subtotal_amount BIGINT NOT NULL DEFAULT 0,
+    min_subtotal_currency VARCHAR(3) NOT NULL,
+    category_id INT REFERENCES categories(id),
+    brand VARCHAR(255),
+    per_user_limit INT NOT NULL DEFAULT 0,
+    usage_limit INT NOT NULL DEFAULT 0,
+    usage_count INT NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    active BOOLEAN NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+-- Coupon codes are unique among promotions that were not deleted
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promotions_code ON promotions(code) WHERE code <> '' AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_promotions_deleted_at ON promotions(deleted_at);
+
+CREATE TABLE IF NOT EXISTS order_discounts (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL REFERENCES orders(id),
+    promotion_id INT NOT NULL REFERENCES promotions(id),
+    code VARCHAR(50),
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    amount_amount BIGINT NOT NULL DEFAULT 0,
+    amount_currency VARCHAR(3) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_discounts_order_id ON order_discounts(order_id);
+CREATE INDEX IF NOT EXISTS idx_order_discounts_promotion_id ON order_discounts(promotion_id);
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS subtotal_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS subtotal_currency VARCHAR(3) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS discount_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS discount_currency VARCHAR(3) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS shipping_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS shipping_currency VARCHAR(3) NOT NULL DEFAULT '';
+UPDATE orders
+SET subtotal_amount = total_amount,
+    subtotal_currency = total_currency,
+    discount_currency = total_currency,
+    shipping_currency = total_currency
+WHERE subtotal_currency = '';
+ALTER TABLE orders
+    ALTER COLUMN subtotal_currency DROP DEFAULT,
+    ALTER COLUMN discount_currency DROP DEFAULT,
+    ALTER COLUMN shipping_currency DROP DEFAULT;
+
+ALTER TABLE carts
+    ADD COLUMN IF NOT EXISTS coupon_code VARCHAR(50) NOT NULL DEFAULT '';
@@ -0,0 +1,36 @@
+-- Tax rates per region and tax class, the tax class of products, and the
+-- tax charged on orders and each of their items. Existing orders were not
+-- charged any tax. Running this again is safe.
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id SERIAL PRIMARY KEY,
+    region VARCHAR(10) NOT NULL,
+    tax_class VARCHAR(50) NOT NULL,
+    rate NUMERIC(7,4) NOT NULL,
+    name VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One rate per tax class in a region; an empty region is everywhere else
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tax_rates_region_class ON tax_rates(region, tax_class);
+
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS tax_class VARCHAR(50) NOT NULL DEFAULT 'standard';
+
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS tax_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_currency VARCHAR(3) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tax_region VARCHAR(10) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS prices_include_tax BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE orders SET tax_currency = total_currency WHERE tax_currency = '';
+ALTER TABLE orders
+    ALTER COLUMN tax_currency DROP DEFAULT;
+
+ALTER TABLE order_items
+    ADD COLUMN IF NOT EXISTS tax_class VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS tax_rate NUMERIC(7,4) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_amount BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS tax_currency VARCHAR(3) NOT NULL DEFAULT '';
+UPDATE order_items SET tax_currency = price_currency WHERE tax_currency = '';
+ALTER TABLE order_items
+    ALTER COLUMN tax_currency DROP DEFAULT;
@@ -0,0 +1,7 @@
+-- Refunds of cancelled paid orders are requested after the cancellation is
+-- saved; refund_due marks the orders still waiting for one
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS refund_due BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS refund_error TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_orders_refund_due ON orders(refund_due);
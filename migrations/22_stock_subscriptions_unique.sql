@@ -0,0 +1,14 @@
+-- A user has at most one pending back-in-stock subscription per product, or
+-- variant. Product subscriptions have no variant, hence the COALESCE.
+DELETE FROM stock_subscriptions s
+USING stock_subscriptions d
+WHERE s.notified_at IS NULL
+  AND d.notified_at IS NULL
+  AND d.user_id = s.user_id
+  AND d.product_id = s.product_id
+  AND COALESCE(d.variant_id, 0) = COALESCE(s.variant_id, 0)
+  AND d.id < s.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stock_subscriptions_pending
+    ON stock_subscriptions(user_id, product_id, COALESCE(variant_id, 0))
+    WHERE notified_at IS NULL;
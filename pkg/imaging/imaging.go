@@ -0,0 +1,143 @@
+// Package imaging decodes, orients, resizes and encodes uploaded images
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+// Image formats, as reported by the image package
+const (
+	JPEG = "jpeg"
+	PNG  = "png"
+	WebP = "webp"
+)
+
+// jpegQuality is the quality images are encoded as JPEG with
+const jpegQuality = 85
+
+var (
+	// ErrUnsupportedFormat is returned for data that is not a JPEG, PNG or
+	// WebP image
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooManyPixels is returned for an image whose dimensions are too
+	// large to decode safely
+	ErrTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// formats maps the content types we accept to their image format
+var formats = map[string]string{
+	"image/jpeg": JPEG,
+	"image/png":  PNG,
+	"image/webp": WebP,
+}
+
+// Detect returns the format of an image from its first bytes, regardless
+// of what the uploader claims it is
+func Detect(data []byte) (string, error) {
+	format, ok := formats[http.DetectContentType(data)]
+	if !ok {
+		return "", ErrUnsupportedFormat
+	}
+	return format, nil
+}
+
+// Decode decodes a JPEG, PNG or WebP image of at most maxPixels pixels.
+// The dimensions are checked before the pixels are decoded, so that a small
+// file claiming to be a huge image is rejected cheaply. A JPEG is turned
+// upright according to its EXIF orientation.
+func Decode(data []byte, maxPixels int) (image.Image, string, error) {
+	format, err := Detect(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d", ErrTooManyPixels, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+
+	if format == JPEG {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, format, nil
+}
+
+// OutputFormat returns the format to store an image decoded from format
+// in. JPEG and PNG images keep their format. WebP cannot be encoded, so
+// WebP images become JPEG, or PNG if they have transparency.
+func OutputFormat(img image.Image, format string) string {
+	if format != WebP {
+		return format
+	}
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return JPEG
+	}
+	return PNG
+}
+
+// ContentType returns the content type of an image format
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// Extension returns the file extension of an image format
+func Extension(format string) string {
+	if format == JPEG {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// Encode writes img in format. Only the pixels are written, so any
+// metadata of the uploaded file, such as EXIF, is left behind.
+func Encode(w io.Writer, img image.Image, format string) error {
+	switch format {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case PNG:
+		return png.Encode(w, img)
+	default:
+		return fmt.Errorf("%w: cannot encode %s", ErrUnsupportedFormat, format)
+	}
+}
+
+// Fit scales img down to fit within a size×size square, keeping its aspect
+// ratio. Images that already fit are returned as they are.
+func Fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Notification kinds
+const (
+	KindLowStock    = "low_stock"
+	KindBackInStock = "back_in_stock"
+)
+
+// Notification is a message to a customer, or to the store's staff when
+// UserID is 0
+type Notification struct {
+	Kind    string
+	UserID  uint
+	Email   string
+	Subject string
+	Body    string
+}
+
+// LogNotifier writes notifications to the log instead of delivering them,
+// for local development
+type LogNotifier struct{}
+
+// NewLogNotifier creates a new LogNotifier
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+// Notify logs the notification
+func (n *LogNotifier) Notify(_ context.Context, notification Notification) error {
+	recipient := notification.Email
+	if notification.UserID == 0 {
+		recipient = "staff"
+	}
+	log.Printf("Notification %s to %s: %s - %s", notification.Kind, recipient, notification.Subject, notification.Body)
+	return nil
+}
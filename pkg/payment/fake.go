@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FakeGateway is an in-process gateway for tests and local development.
+// It never talks to the network and remembers every intent it creates.
+type FakeGateway struct {
+	mu      sync.Mutex
+	nextID  int
+	intents map[string]IntentRequest
+	byKey   map[string]*Intent
+	refunds []RefundRequest
+}
+
+// NewFakeGateway creates a new FakeGateway
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		intents: make(map[string]IntentRequest),
+		byKey:   make(map[string]*Intent),
+	}
+}
+
+// CreatePaymentIntent records the request and returns a new fake intent.
+// Repeating a request with the same idempotency key returns the same intent.
+func (g *FakeGateway) CreatePaymentIntent(_ context.Context, req IntentRequest) (*Intent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if req.IdempotencyKey != "" {
+		if intent, ok := g.byKey[req.IdempotencyKey]; ok {
+			return intent, nil
+		}
+	}
+
+	g.nextID++
+	id := fmt.Sprintf("pi_fake_%d", g.nextID)
+	intent := &Intent{
+		ID:           id,
+		ClientSecret: id + "_secret_fake",
+		Status:       "requires_payment_method",
+		Provider:     "fake",
+	}
+
+	g.intents[id] = req
+	if req.IdempotencyKey != "" {
+		g.byKey[req.IdempotencyKey] = intent
+	}
+	return intent, nil
+}
+
+// Intent returns the request an intent was created from
+func (g *FakeGateway) Intent(id string) (IntentRequest, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	req, ok := g.intents[id]
+	return req, ok
+}
+
+// Refund records a refund of an intent created by this gateway
+func (g *FakeGateway) Refund(_ context.Context, req RefundRequest) (*Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.intents[req.PaymentID]; !ok {
+		return nil, errors.New("no such payment intent: " + req.PaymentID)
+	}
+
+	g.refunds = append(g.refunds, req)
+	return &Refund{
+		ID:     fmt.Sprintf("re_fake_%d", len(g.refunds)),
+		Status: "succeeded",
+	}, nil
+}
+
+// Refunds returns the refunds requested so far
+func (g *FakeGateway) Refunds() []RefundRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]RefundRequest(nil), g.refunds...)
+}
@@ -0,0 +1,35 @@
+// Package payment contains clients for payment providers
+package payment
+
+// IntentRequest describes a payment to be collected for an order
+type IntentRequest struct {
+	OrderID uint
+	// Amount is in the currency's minor units (e.g. cents)
+	Amount   int64
+	Currency string
+	// IdempotencyKey makes retries of the same request return the same intent
+	IdempotencyKey string
+}
+
+// Intent is a payment intent created with a provider
+type Intent struct {
+	ID           string
+	ClientSecret string
+	Status       string
+	Provider     string
+}
+
+// RefundRequest describes a refund of a payment
+type RefundRequest struct {
+	// PaymentID is the ID of the payment intent to refund
+	PaymentID string
+	// Amount is in minor units; zero refunds the whole payment
+	Amount         int64
+	IdempotencyKey string
+}
+
+// Refund is a refund created with a provider
+type Refund struct {
+	ID     string
+	Status string
+}
@@ -0,0 +1,133 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStripeURL is the base URL of the Stripe API
+const DefaultStripeURL = "https://api.stripe.com"
+
+// StripeGateway talks to the Stripe REST API, or to any server speaking the
+// same protocol such as stripe-mock
+type StripeGateway struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewStripeGateway creates a new StripeGateway. An empty baseURL uses the
+// real Stripe API.
+func NewStripeGateway(apiKey, baseURL string) *StripeGateway {
+	if baseURL == "" {
+		baseURL = DefaultStripeURL
+	}
+	return &StripeGateway{
+		apiKey:  apiKey,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// stripeIntent is the subset of a Stripe PaymentIntent object we use
+type stripeIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret"`
+	Status       string `json:"status"`
+}
+
+// stripeError is the error body returned by the Stripe API
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// CreatePaymentIntent creates a PaymentIntent and returns its client secret
+func (g *StripeGateway) CreatePaymentIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(req.Amount, 10))
+	form.Set("currency", strings.ToLower(req.Currency))
+	form.Set("automatic_payment_methods[enabled]", "true")
+	form.Set("metadata[order_id]", strconv.FormatUint(uint64(req.OrderID), 10))
+
+	var intent stripeIntent
+	if err := g.post(ctx, "/v1/payment_intents", form, req.IdempotencyKey, &intent); err != nil {
+		return nil, err
+	}
+
+	return &Intent{
+		ID:           intent.ID,
+		ClientSecret: intent.ClientSecret,
+		Status:       intent.Status,
+		Provider:     "stripe",
+	}, nil
+}
+
+// stripeRefund is the subset of a Stripe Refund object we use
+type stripeRefund struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// Refund refunds a payment intent, fully or partially
+func (g *StripeGateway) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", req.PaymentID)
+	if req.Amount > 0 {
+		form.Set("amount", strconv.FormatInt(req.Amount, 10))
+	}
+
+	var refund stripeRefund
+	if err := g.post(ctx, "/v1/refunds", form, req.IdempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+
+	return &Refund{ID: refund.ID, Status: refund.Status}, nil
+}
+
+// post sends a form-encoded request to the Stripe API and decodes the
+// JSON response into out
+func (g *StripeGateway) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	if g.apiKey == "" {
+		return errors.New("stripe API key not configured")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build stripe request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+g.apiKey)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr stripeError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error.Message == "" {
+			return fmt.Errorf("stripe returned status %d", resp.StatusCode)
+		}
+		return fmt.Errorf("stripe error: %s", apiErr.Error.Message)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode stripe response: %w", err)
+	}
+	return nil
+}
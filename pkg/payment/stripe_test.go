@@ -0,0 +1,201 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// stripeRequest is a request received by a stub Stripe server
+type stripeRequest struct {
+	method         string
+	path           string
+	contentType    string
+	authorization  string
+	idempotencyKey string
+	form           url.Values
+}
+
+// newStripeServer starts a stub Stripe server that records each request and
+// answers with status and body
+func newStripeServer(t *testing.T, status int, body string) (*httptest.Server, *[]stripeRequest) {
+	t.Helper()
+
+	var requests []stripeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		requests = append(requests, stripeRequest{
+			method:         r.Method,
+			path:           r.URL.Path,
+			contentType:    r.Header.Get("Content-Type"),
+			authorization:  r.Header.Get("Authorization"),
+			idempotencyKey: r.Header.Get("Idempotency-Key"),
+			form:           r.PostForm,
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestStripeCreatePaymentIntent(t *testing.T) {
+	server, requests := newStripeServer(t, http.StatusOK,
+		`{"id":"pi_123","client_secret":"pi_123_secret_456","status":"requires_payment_method"}`)
+	gateway := NewStripeGateway("sk_test", server.URL+"/")
+
+	intent, err := gateway.CreatePaymentIntent(context.Background(), IntentRequest{
+		OrderID:        42,
+		Amount:         1999,
+		Currency:       "USD",
+		IdempotencyKey: "order-42-intent",
+	})
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent: %v", err)
+	}
+
+	want := Intent{ID: "pi_123", ClientSecret: "pi_123_secret_456", Status: "requires_payment_method", Provider: "stripe"}
+	if *intent != want {
+		t.Errorf("intent = %+v, want %+v", *intent, want)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.method != http.MethodPost || req.path != "/v1/payment_intents" {
+		t.Errorf("request = %s %s, want POST /v1/payment_intents", req.method, req.path)
+	}
+	if req.contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("Content-Type = %q", req.contentType)
+	}
+	if req.authorization != "Bearer sk_test" {
+		t.Errorf("Authorization = %q", req.authorization)
+	}
+	if req.idempotencyKey != "order-42-intent" {
+		t.Errorf("Idempotency-Key = %q, want %q", req.idempotencyKey, "order-42-intent")
+	}
+	for key, value := range map[string]string{
+		"amount":                             "1999",
+		"currency":                           "usd",
+		"automatic_payment_methods[enabled]": "true",
+		"metadata[order_id]":                 "42",
+	} {
+		if got := req.form.Get(key); got != value {
+			t.Errorf("form %s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestStripeRefund(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        RefundRequest
+		wantAmount string
+	}{
+		{
+			name:       "full",
+			req:        RefundRequest{PaymentID: "pi_123", IdempotencyKey: "order-42-refund"},
+			wantAmount: "",
+		},
+		{
+			name:       "partial",
+			req:        RefundRequest{PaymentID: "pi_123", Amount: 500, IdempotencyKey: "order-42-refund"},
+			wantAmount: "500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newStripeServer(t, http.StatusOK, `{"id":"re_789","status":"succeeded"}`)
+			gateway := NewStripeGateway("sk_test", server.URL)
+
+			refund, err := gateway.Refund(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Refund: %v", err)
+			}
+			if refund.ID != "re_789" || refund.Status != "succeeded" {
+				t.Errorf("refund = %+v", *refund)
+			}
+
+			if len(*requests) != 1 {
+				t.Fatalf("got %d requests, want 1", len(*requests))
+			}
+			req := (*requests)[0]
+			if req.path != "/v1/refunds" {
+				t.Errorf("path = %q, want /v1/refunds", req.path)
+			}
+			if req.idempotencyKey != "order-42-refund" {
+				t.Errorf("Idempotency-Key = %q", req.idempotencyKey)
+			}
+			if got := req.form.Get("payment_intent"); got != "pi_123" {
+				t.Errorf("form payment_intent = %q, want pi_123", got)
+			}
+			if got := req.form.Get("amount"); got != tt.wantAmount {
+				t.Errorf("form amount = %q, want %q", got, tt.wantAmount)
+			}
+		})
+	}
+}
+
+func TestStripeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{
+			name:    "error body",
+			status:  http.StatusPaymentRequired,
+			body:    `{"error":{"type":"card_error","code":"card_declined","message":"Your card was declined."}}`,
+			wantErr: "stripe error: Your card was declined.",
+		},
+		{
+			name:    "no error body",
+			status:  http.StatusInternalServerError,
+			body:    `oops`,
+			wantErr: "stripe returned status 500",
+		},
+		{
+			name:    "invalid response",
+			status:  http.StatusOK,
+			body:    `{`,
+			wantErr: "failed to decode stripe response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := newStripeServer(t, tt.status, tt.body)
+			gateway := NewStripeGateway("sk_test", server.URL)
+
+			_, err := gateway.CreatePaymentIntent(context.Background(), IntentRequest{OrderID: 1, Amount: 100, Currency: "usd"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CreatePaymentIntent error = %v, want %q", err, tt.wantErr)
+			}
+			_, err = gateway.Refund(context.Background(), RefundRequest{PaymentID: "pi_123"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Refund error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStripeWithoutAPIKey(t *testing.T) {
+	server, requests := newStripeServer(t, http.StatusOK, `{}`)
+	gateway := NewStripeGateway("", server.URL)
+
+	if _, err := gateway.CreatePaymentIntent(context.Background(), IntentRequest{OrderID: 1, Amount: 100, Currency: "usd"}); err == nil {
+		t.Error("CreatePaymentIntent succeeded without an API key")
+	}
+	if len(*requests) != 0 {
+		t.Errorf("got %d requests, want none", len(*requests))
+	}
+}
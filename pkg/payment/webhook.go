@@ -0,0 +1,164 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event types reported by the payment provider
+const (
+	EventPaymentSucceeded = "payment_intent.succeeded"
+	EventPaymentFailed    = "payment_intent.payment_failed"
+	EventChargeRefunded   = "charge.refunded"
+)
+
+// SignatureHeader is the HTTP header carrying the webhook signature
+const SignatureHeader = "Stripe-Signature"
+
+// DefaultWebhookTolerance is how old a signed webhook may be before it is
+// rejected as a possible replay
+const DefaultWebhookTolerance = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned when a webhook signature does not verify
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrWebhookNotConfigured is returned when no webhook secret is set
+	ErrWebhookNotConfigured = errors.New("webhook secret not configured")
+)
+
+// Event is a webhook notification from the payment provider
+type Event struct {
+	ID   string
+	Type string
+	// PaymentID is the ID of the payment intent the event refers to
+	PaymentID string
+	// OrderID is the order the payment intent was created for, from its
+	// metadata; 0 when the event does not say
+	OrderID uint
+	// Provider names the payment provider that sent the event
+	Provider string
+	// Amount is in minor units: what the payment intent is for, or for
+	// refund events how much of the charge has been refunded in all
+	Amount int64
+	// Currency is the upper-case currency code of Amount
+	Currency string
+}
+
+// webhookEvent is the subset of a Stripe event object we use
+type webhookEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID             string            `json:"id"`
+			Object         string            `json:"object"`
+			PaymentIntent  string            `json:"payment_intent"`
+			Amount         int64             `json:"amount"`
+			AmountRefunded int64             `json:"amount_refunded"`
+			Currency       string            `json:"currency"`
+			Metadata       map[string]string `json:"metadata"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// ParseWebhook verifies the signature header of a webhook payload and
+// decodes the event. The header has the form "t=<unix time>,v1=<hex hmac>",
+// where the HMAC-SHA256 is computed over "<unix time>.<payload>" with the
+// webhook secret.
+func ParseWebhook(payload []byte, header, secret string, tolerance time.Duration) (*Event, error) {
+	if err := verifySignature(payload, header, secret, tolerance, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var raw webhookEvent
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if raw.ID == "" || raw.Type == "" {
+		return nil, errors.New("invalid webhook payload: missing event id or type")
+	}
+
+	event := &Event{
+		ID:        raw.ID,
+		Type:      raw.Type,
+		PaymentID: raw.Data.Object.ID,
+		Provider:  "stripe",
+		Amount:    raw.Data.Object.Amount,
+		Currency:  strings.ToUpper(raw.Data.Object.Currency),
+	}
+	// Charge events point at their payment intent
+	if raw.Data.Object.Object == "charge" {
+		event.PaymentID = raw.Data.Object.PaymentIntent
+	}
+	if raw.Type == EventChargeRefunded {
+		event.Amount = raw.Data.Object.AmountRefunded
+	}
+	// Intents carry the order they were created for
+	if orderID, err := strconv.ParseUint(raw.Data.Object.Metadata["order_id"], 10, 32); err == nil {
+		event.OrderID = uint(orderID)
+	}
+
+	return event, nil
+}
+
+// SignWebhook returns a signature header for payload, as the provider would
+// send it. It is used by stub servers and tests.
+func SignWebhook(payload []byte, secret string, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + computeSignature(payload, t, secret)
+}
+
+func verifySignature(payload []byte, header, secret string, tolerance time.Duration, now time.Time) error {
+	if secret == "" {
+		return ErrWebhookNotConfigured
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 && now.Sub(time.Unix(unix, 0)).Abs() > tolerance {
+		return ErrInvalidSignature
+	}
+
+	expected := computeSignature(payload, timestamp, secret)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func computeSignature(payload []byte, timestamp, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,117 @@
+package payment
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func TestParseWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    Event
+	}{
+		{
+			name:    "payment intent",
+			payload: `{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_123","object":"payment_intent","amount":1999,"currency":"usd","metadata":{"order_id":"42"}}}}`,
+			want:    Event{ID: "evt_1", Type: EventPaymentSucceeded, PaymentID: "pi_123", OrderID: 42, Provider: "stripe", Amount: 1999, Currency: "USD"},
+		},
+		{
+			name:    "charge",
+			payload: `{"id":"evt_2","type":"charge.refunded","data":{"object":{"id":"ch_456","object":"charge","payment_intent":"pi_123","amount":1999,"amount_refunded":500,"currency":"usd"}}}`,
+			want:    Event{ID: "evt_2", Type: EventChargeRefunded, PaymentID: "pi_123", Provider: "stripe", Amount: 500, Currency: "USD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := []byte(tt.payload)
+			header := SignWebhook(payload, testWebhookSecret, time.Now())
+
+			event, err := ParseWebhook(payload, header, testWebhookSecret, DefaultWebhookTolerance)
+			if err != nil {
+				t.Fatalf("ParseWebhook: %v", err)
+			}
+			if *event != tt.want {
+				t.Errorf("event = %+v, want %+v", *event, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWebhookRejects(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_123"}}}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		secret  string
+		wantErr error
+	}{
+		{
+			name:    "wrong secret",
+			payload: payload,
+			header:  SignWebhook(payload, "whsec_other", now),
+			secret:  testWebhookSecret,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "tampered payload",
+			payload: []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_999"}}}`),
+			header:  SignWebhook(payload, testWebhookSecret, now),
+			secret:  testWebhookSecret,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "malformed header",
+			payload: payload,
+			header:  "v1=deadbeef",
+			secret:  testWebhookSecret,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "too old",
+			payload: payload,
+			header:  SignWebhook(payload, testWebhookSecret, now.Add(-DefaultWebhookTolerance-time.Minute)),
+			secret:  testWebhookSecret,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "too far in the future",
+			payload: payload,
+			header:  SignWebhook(payload, testWebhookSecret, now.Add(DefaultWebhookTolerance+time.Minute)),
+			secret:  testWebhookSecret,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "no secret",
+			payload: payload,
+			header:  SignWebhook(payload, "", now),
+			secret:  "",
+			wantErr: ErrWebhookNotConfigured,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWebhook(tt.payload, tt.header, tt.secret, DefaultWebhookTolerance)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseWebhook error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseWebhookWithinTolerance(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_123"}}}`)
+	header := SignWebhook(payload, testWebhookSecret, time.Now().Add(-DefaultWebhookTolerance+time.Minute))
+
+	if _, err := ParseWebhook(payload, header, testWebhookSecret, DefaultWebhookTolerance); err != nil {
+		t.Errorf("ParseWebhook: %v", err)
+	}
+}